@@ -6,9 +6,25 @@ CREATE TABLE users (
   first_name VARCHAR(255),
   last_name VARCHAR(255),
   email TEXT UNIQUE NOT NULL,
-  password_hash TEXT NOT NULL
+  password_hash TEXT NOT NULL,
+  -- the CalDAV collection tag, see todos_calendar_tag, taken from calendar_tags whenever any of the user's todos changes
+  calendar_tag BIGINT NOT NULL DEFAULT 0
 );
 
+CREATE SEQUENCE calendar_tags;
+
+CREATE TABLE lists (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  user_id INTEGER REFERENCES users(id),
+  is_inbox BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, name)
+);
+
+-- each user has at most one inbox
+CREATE UNIQUE INDEX lists_user_id_inbox_idx ON lists (user_id) WHERE is_inbox;
+
 CREATE TABLE todos (
   id SERIAL PRIMARY KEY,
   title TEXT,
@@ -18,17 +34,186 @@ CREATE TABLE todos (
   due_at TIMESTAMP,
   user_id INTEGER REFERENCES users(id),
   completed_at TIMESTAMP,
-  is_done BOOLEAN NOT NULL DEFAULT FALSE
-);
-
--- @TODO: Implement a todo tagging system
--- 
--- CREATE TABLE tags(
---   id SERIAL PRIMARY KEY,
---   name VARCHAR(50) NOT NULL
--- );
--- 
--- CREATE TABLE todos_tags(
---   tag_id INTEGER REFERENCES tags(id),
---   todo_id INTEGER REFERENCES todos(id)
--- );
+  is_done BOOLEAN NOT NULL DEFAULT FALSE,
+  recurrence TEXT,
+  parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+  -- 0 none, 1 low, 2 medium, 3 high, 4 urgent
+  priority SMALLINT NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 4),
+  -- fractional rank for manual ordering, compared bytewise
+  position TEXT COLLATE "C" NOT NULL,
+  list_id INTEGER REFERENCES lists(id),
+  -- bumped by every change, see todos_version, and used as the todo's ETag
+  version INTEGER NOT NULL DEFAULT 1,
+  -- set while the todo is in the trash
+  deleted_at TIMESTAMP,
+  -- the iCalendar UID and resource name given by the CalDAV client which created the todo, if any
+  ical_uid TEXT,
+  caldav_name TEXT,
+  search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(note, '')), 'B')
+  ) STORED
+);
+
+CREATE INDEX todos_search_vector_idx ON todos USING GIN (search_vector);
+
+CREATE FUNCTION bump_todo_version() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.version := OLD.version + 1;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todos_version BEFORE UPDATE ON todos
+FOR EACH ROW EXECUTE FUNCTION bump_todo_version();
+
+-- every write to a todo, including deleting and purging it, gives its owner a new calendar tag
+CREATE FUNCTION bump_calendar_tag() RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE users SET calendar_tag = nextval('calendar_tags')
+  WHERE id IN (NEW.user_id, OLD.user_id);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todos_calendar_tag AFTER INSERT OR UPDATE OR DELETE ON todos
+FOR EACH ROW EXECUTE FUNCTION bump_calendar_tag();
+CREATE INDEX todos_parent_id_idx ON todos (parent_id);
+CREATE INDEX todos_user_id_position_idx ON todos (user_id, position);
+CREATE INDEX todos_list_id_idx ON todos (list_id);
+CREATE INDEX todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE UNIQUE INDEX todos_user_id_caldav_name_idx ON todos (user_id, caldav_name) WHERE caldav_name IS NOT NULL;
+
+CREATE TABLE tags (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(50) NOT NULL,
+  user_id INTEGER REFERENCES users(id),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  UNIQUE (user_id, name)
+);
+
+CREATE TABLE todos_tags (
+  tag_id INTEGER REFERENCES tags(id) ON DELETE CASCADE,
+  todo_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+  PRIMARY KEY (tag_id, todo_id)
+);
+
+-- a todo's tags are its categories in CalDAV, so tagging it also gives its owner a new calendar tag
+CREATE FUNCTION bump_tagged_calendar_tag() RETURNS TRIGGER AS $$
+BEGIN
+  UPDATE users SET calendar_tag = nextval('calendar_tags')
+  WHERE id IN (SELECT user_id FROM todos WHERE id IN (NEW.todo_id, OLD.todo_id));
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todos_tags_calendar_tag AFTER INSERT OR UPDATE OR DELETE ON todos_tags
+FOR EACH ROW EXECUTE FUNCTION bump_tagged_calendar_tag();
+
+-- tagging a todo is announced as an update by its owner, who is the only one who can tag it
+CREATE FUNCTION notify_tagged_todo() RETURNS TRIGGER AS $$
+DECLARE
+  tagged todos%ROWTYPE;
+BEGIN
+  SELECT * INTO tagged FROM todos WHERE id = COALESCE(NEW.todo_id, OLD.todo_id) AND deleted_at IS NULL;
+  IF FOUND THEN
+    PERFORM notify_todo_change(tagged.id, tagged.user_id, 'updated');
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todos_tags_notify AFTER INSERT OR DELETE ON todos_tags
+FOR EACH ROW EXECUTE FUNCTION notify_tagged_todo();
+
+CREATE TABLE shares (
+  id SERIAL PRIMARY KEY,
+  owner_id INTEGER NOT NULL REFERENCES users(id),
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  todo_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+  list_id INTEGER REFERENCES lists(id) ON DELETE CASCADE,
+  role TEXT NOT NULL CHECK (role IN ('viewer', 'editor')),
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  CHECK ((todo_id IS NULL) <> (list_id IS NULL)),
+  UNIQUE (user_id, todo_id),
+  UNIQUE (user_id, list_id)
+);
+
+CREATE TABLE comments (
+  id SERIAL PRIMARY KEY,
+  todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  body TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  modified_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX comments_todo_id_idx ON comments (todo_id);
+
+CREATE TABLE attachments (
+  id SERIAL PRIMARY KEY,
+  todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id),
+  filename TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size BIGINT NOT NULL CHECK (size > 0),
+  storage_key TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX attachments_todo_id_idx ON attachments (todo_id);
+
+CREATE TABLE todo_events (
+  id SERIAL PRIMARY KEY,
+  todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id), -- who made the change
+  -- created, updated, completed, reopened, moved, deleted or restored
+  action TEXT NOT NULL,
+  -- the changed fields, each with its value before and after, e.g. {"dueAt": {"before": null, "after": "..."}}
+  changes JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX todo_events_todo_id_idx ON todo_events (todo_id);
+
+-- changes are announced on the todo_changes channel, which every instance of the API listens on. Postgres only
+-- delivers the notification once the transaction making the change commits.
+CREATE FUNCTION notify_todo_change(changed_id INTEGER, actor_id INTEGER, event_type TEXT) RETURNS VOID AS $$
+BEGIN
+  PERFORM pg_notify('todo_changes',
+    json_build_object('type', event_type, 'todoId', changed_id, 'actorId', actor_id)::text);
+END;
+$$ LANGUAGE plpgsql;
+
+-- every change recorded in a todo's history is announced, as one of the types of event sent to clients
+CREATE FUNCTION notify_todo_event() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM notify_todo_change(NEW.todo_id, NEW.user_id, CASE NEW.action
+    WHEN 'created' THEN 'created'
+    WHEN 'restored' THEN 'created'
+    WHEN 'completed' THEN 'completed'
+    WHEN 'deleted' THEN 'deleted'
+    ELSE 'updated'
+  END);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER todo_events_notify AFTER INSERT ON todo_events
+FOR EACH ROW EXECUTE FUNCTION notify_todo_event();
+
+CREATE TABLE feed_tokens (
+  -- each user has at most one feed token, replaced whenever a new one is created
+  user_id INTEGER PRIMARY KEY REFERENCES users(id),
+  -- the SHA-256 of the token, which is only shown to the user when it's created
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE caldav_passwords (
+  -- each user has at most one CalDAV password, replaced whenever a new one is created
+  user_id INTEGER PRIMARY KEY REFERENCES users(id),
+  -- the SHA-256 of the password, which is only shown to the user when it's created
+  password_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,224 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of event
+const (
+	Created   = "created"
+	Updated   = "updated"
+	Completed = "completed"
+	Deleted   = "deleted"
+	// Reset tells a subscriber that it has missed events which can't be replayed, so must refetch its todos
+	Reset = "reset"
+)
+
+// Event is a change to a todo, sent to each of the users who can see the todo
+type Event struct {
+	ID      string // set by the hub, see Hub.Subscribe
+	Type    string
+	TodoID  uint
+	ActorID uint                   // the user who made the change
+	Todo    map[string]interface{} // the serialized todo after the change, when it's known
+	users   []uint                 // who the event is sent to
+}
+
+// Data is the body of the event sent to clients
+func (e *Event) Data() map[string]interface{} {
+	data := map[string]interface{}{
+		"todoId":  e.TodoID,
+		"actorId": e.ActorID,
+	}
+	if e.Todo != nil {
+		data["todo"] = e.Todo
+	}
+	return data
+}
+
+// Publisher is where changes to todos are published
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Audience finds the users who can see a todo
+type Audience func(todoID uint) ([]uint, error)
+
+// Subscription receives the events for a single user until it is closed
+type Subscription struct {
+	userID uint
+	events chan Event
+}
+
+// Events is closed when the subscription is, including when the subscriber falls too far behind
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Hub fans out events to the subscribers of the users who can see each todo. Recent events are kept so that
+// subscribers which reconnect can resume from the last event they received.
+type Hub struct {
+	audience   Audience
+	bufferSize int
+	epoch      string     // distinguishes the ids of this hub's events from those of a hub before a restart
+	queue      chan Event // published events waiting for their audience to be found
+
+	mu          sync.Mutex
+	sequence    uint64
+	history     []Event // the most recent events, oldest first
+	historySize int
+	subscribers map[uint]map[*Subscription]bool
+}
+
+// NewHub makes a hub which keeps historySize events for resuming, and buffers up to bufferSize events
+// for each subscriber. Without an audience, events are only sent to the user who made the change.
+func NewHub(audience Audience, historySize, bufferSize int) *Hub {
+	h := &Hub{
+		audience:    audience,
+		bufferSize:  bufferSize,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		queue:       make(chan Event, historySize),
+		historySize: historySize,
+		subscribers: make(map[uint]map[*Subscription]bool),
+	}
+	go h.run()
+	return h
+}
+
+// Publish queues an event to be sent to the subscribers of every user who can see the todo. Finding who can see it
+// is left to the hub, so that publishing doesn't hold up the request which made the change. When the queue is full
+// the event is dropped rather than blocking the publisher.
+func (h *Hub) Publish(e Event) {
+	select {
+	case h.queue <- e:
+	default:
+		log.Println("Error publishing an event, the queue is full:\t", e.Type, e.TodoID)
+	}
+}
+
+// run delivers queued events in the order they were published
+func (h *Hub) run() {
+	for e := range h.queue {
+		h.deliver(e)
+	}
+}
+
+// deliver sends an event to the subscribers of every user who can see the todo
+func (h *Hub) deliver(e Event) {
+	users := []uint{e.ActorID}
+	if h.audience != nil {
+		audience, err := h.audience(e.TodoID)
+		if err != nil {
+			log.Println("Error finding the audience of an event:\t", err)
+		}
+		if len(audience) > 0 {
+			users = audience
+		}
+	}
+	e.users = users
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sequence++
+	e.ID = fmt.Sprintf("%s-%d", h.epoch, h.sequence)
+	h.history = append(h.history, e)
+	if len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+
+	for _, userID := range users {
+		for s := range h.subscribers[userID] {
+			select {
+			case s.events <- e:
+			default:
+				// the subscriber has fallen too far behind, so drop it rather than hold up everyone else.
+				// It can resume from the last event it received.
+				h.unsubscribe(s)
+			}
+		}
+	}
+}
+
+// Reset tells every subscriber that it may have missed events, e.g. because the hub stopped hearing about changes
+// for a while, so must refetch its todos. Subscribers which resume from before the reset are reset too.
+func (h *Hub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sequence++
+	e := Event{ID: fmt.Sprintf("%s-%d", h.epoch, h.sequence), Type: Reset}
+	h.history = nil
+	for _, subscriptions := range h.subscribers {
+		for s := range subscriptions {
+			select {
+			case s.events <- e:
+			default:
+				h.unsubscribe(s)
+			}
+		}
+	}
+}
+
+// Subscribe starts receiving the events for a user. Given the id of the last event a previous subscription received,
+// it also returns the events which have happened since, or a single Reset event when they can't all be replayed.
+func (h *Hub) Subscribe(userID uint, lastEventID string) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := &Subscription{userID: userID, events: make(chan Event, h.bufferSize)}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*Subscription]bool)
+	}
+	h.subscribers[userID][s] = true
+
+	if len(lastEventID) == 0 {
+		return s, nil
+	}
+	reset := []Event{{ID: fmt.Sprintf("%s-%d", h.epoch, h.sequence), Type: Reset}}
+	parts := strings.SplitN(lastEventID, "-", 2)
+	if len(parts) != 2 || parts[0] != h.epoch {
+		return s, reset
+	}
+	last, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || last > h.sequence {
+		return s, reset
+	}
+	// events are numbered consecutively, so the history holds the sequence numbers from first to h.sequence
+	first := h.sequence - uint64(len(h.history)) + 1
+	if last+1 < first {
+		return s, reset
+	}
+
+	missed := make([]Event, 0)
+	for _, e := range h.history[last+1-first:] {
+		for _, id := range e.users {
+			if id == userID {
+				missed = append(missed, e)
+				break
+			}
+		}
+	}
+	return s, missed
+}
+
+// Unsubscribe stops a subscription, closing its events
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribe(s)
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	if !h.subscribers[s.userID][s] {
+		return
+	}
+	delete(h.subscribers[s.userID], s)
+	if len(h.subscribers[s.userID]) == 0 {
+		delete(h.subscribers, s.userID)
+	}
+	close(s.events)
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHubPublish(t *testing.T) {
+	t.Log(`Should send events to the subscribers of every user who can see the todo`)
+	audience := func(todoID uint) ([]uint, error) {
+		if todoID == 1 {
+			return []uint{1, 2}, nil
+		}
+		return nil, nil
+	}
+	hub := NewHub(audience, 10, 2)
+	owner, _ := hub.Subscribe(1, "")
+	teammate, _ := hub.Subscribe(2, "")
+	stranger, _ := hub.Subscribe(3, "")
+
+	hub.Publish(Event{Type: Updated, TodoID: 1, ActorID: 1})
+	hub.Publish(Event{Type: Created, TodoID: 2, ActorID: 1})
+
+	// events are delivered in order, so once the owner has both the teammate has had every event meant for them
+	if e := <-owner.Events(); e.Type != Updated || e.TodoID != 1 {
+		t.Errorf("Expected the owner to receive the update but received %+v", e)
+	}
+	if e := <-owner.Events(); e.Type != Created {
+		t.Errorf("Expected the owner to receive the creation without an audience but received %+v", e)
+	}
+	if e := <-teammate.Events(); e.Type != Updated {
+		t.Errorf("Expected the teammate to receive the update but received %+v", e)
+	}
+	if len(teammate.Events()) != 0 || len(stranger.Events()) != 0 {
+		t.Errorf("Expected only the users who can see a todo to receive its events")
+	}
+
+	t.Log(`Should drop subscribers which fall too far behind`)
+	for i := 0; i < 3; i++ {
+		hub.deliver(Event{Type: Updated, TodoID: 1, ActorID: 1})
+	}
+	count := 0
+	for range teammate.Events() {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("Expected the teammate's buffered events before being dropped but received %d", count)
+	}
+	hub.Unsubscribe(teammate) // unsubscribing twice is harmless
+}
+
+func TestHubPublishFull(t *testing.T) {
+	t.Log(`Should drop events rather than block when the queue is full`)
+	finding := make(chan bool)
+	audience := func(todoID uint) ([]uint, error) {
+		<-finding
+		return nil, nil
+	}
+	hub := NewHub(audience, 1, 1)
+	defer close(finding)
+
+	published := make(chan bool)
+	go func() {
+		// the first event is being delivered and the second fills the queue
+		for i := uint(1); i <= 3; i++ {
+			hub.Publish(Event{Type: Updated, TodoID: i, ActorID: 1})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected publishing to a full queue not to block")
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	t.Log(`Should replay the events a subscriber missed since its last event`)
+	hub := NewHub(nil, 3, 10)
+	first, _ := hub.Subscribe(1, "")
+	hub.deliver(Event{Type: Created, TodoID: 1, ActorID: 1})
+	last := <-first.Events()
+	hub.Unsubscribe(first)
+
+	hub.deliver(Event{Type: Updated, TodoID: 1, ActorID: 1})
+	hub.deliver(Event{Type: Updated, TodoID: 2, ActorID: 2})
+	hub.deliver(Event{Type: Deleted, TodoID: 1, ActorID: 1})
+
+	_, missed := hub.Subscribe(1, last.ID)
+	if len(missed) != 2 || missed[0].Type != Updated || missed[1].Type != Deleted {
+		t.Errorf("Expected the two missed events but received %+v", missed)
+	}
+
+	t.Log(`Should reset subscribers whose events can no longer be replayed`)
+	hub.deliver(Event{Type: Updated, TodoID: 1, ActorID: 1})
+	for _, lastEventID := range []string{last.ID, "elsewhere-1", "nonsense"} {
+		if _, missed = hub.Subscribe(1, lastEventID); len(missed) != 1 || missed[0].Type != Reset {
+			t.Errorf("%s: expected a reset but received %+v", lastEventID, missed)
+		}
+	}
+	if _, missed = hub.Subscribe(1, ""); missed != nil {
+		t.Errorf("Expected nothing to replay for a new subscriber but received %+v", missed)
+	}
+}
+
+func TestHubReset(t *testing.T) {
+	t.Log(`Should reset every subscriber, and those resuming from before the reset`)
+	hub := NewHub(nil, 10, 10)
+	first, _ := hub.Subscribe(1, "")
+	second, _ := hub.Subscribe(2, "")
+	hub.deliver(Event{Type: Created, TodoID: 1, ActorID: 1})
+	last := <-first.Events()
+
+	hub.Reset()
+	for _, s := range []*Subscription{first, second} {
+		if e := <-s.Events(); e.Type != Reset {
+			t.Errorf("Expected a reset but received %+v", e)
+		}
+	}
+	if _, missed := hub.Subscribe(1, last.ID); len(missed) != 1 || missed[0].Type != Reset {
+		t.Errorf("Expected a reset but received %+v", missed)
+	}
+}
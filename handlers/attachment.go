@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"github.com/vancelongwill/gotodos/storage"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a type alias for convenience
+type Attachment = models.Attachment
+
+// AttachmentStore is the datastore API for attachments
+type AttachmentStore interface {
+	DBCreateAttachment
+	DBGetAttachments
+	DBOpenAttachment
+	DBDeleteAttachment
+}
+
+// multipartOverhead allows for the boundaries and headers around the uploaded file
+const multipartOverhead = 1 << 16
+
+// getAttachmentIDFromContext reads an attachment ID from the attachmentId url parameter
+func getAttachmentIDFromContext(c *gin.Context) (uint, bool) {
+	attachmentID, err := StringToUint(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Can't convert attachment id in url to uint",
+		})
+		return 0, false
+	}
+	return attachmentID, true
+}
+
+// sniffContentType detects the type of an uploaded file from its first 512 bytes, rather than trusting the client
+func sniffContentType(file multipart.File) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// DBCreateAttachment represents the part of the datalayer responsible for attaching files to todos
+type DBCreateAttachment interface {
+	CreateAttachment(a *Attachment, content io.Reader) error
+}
+
+// UploadAttachment returns a function which handles multipart uploads of a file, in the "file" field,
+// to a todo the current User can edit. Files larger than maxSize bytes are rejected.
+func UploadAttachment(db DBCreateAttachment, maxSize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		tooLarge := gin.H{
+			"status":  http.StatusRequestEntityTooLarge,
+			"message": fmt.Sprintf("Attachments must be no larger than %d bytes", maxSize),
+		}
+		if c.Request.ContentLength > maxSize+multipartOverhead {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+		header, err := c.FormFile("file")
+		if err != nil && strings.Contains(err.Error(), "request body too large") {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+		if header.Size > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			log.Println("Error opening an uploaded attachment:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to read upload"})
+			return
+		}
+		defer file.Close()
+
+		contentType, err := sniffContentType(file)
+		if err != nil {
+			log.Println("Error detecting the content type of an attachment:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to read upload"})
+			return
+		}
+
+		attachment := Attachment{
+			TodoID:      todoID,
+			UserID:      userID,
+			Filename:    filepath.Base(header.Filename),
+			ContentType: contentType,
+			Size:        header.Size,
+		}
+		switch err := db.CreateAttachment(&attachment, file); err {
+		case nil:
+		case models.ErrorEmptyAttachment:
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+			return
+		case models.ErrorNoBlobStore:
+			c.JSON(http.StatusNotImplemented, gin.H{"status": http.StatusNotImplemented, "message": err.Error()})
+			return
+		case sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo"})
+			return
+		default:
+			log.Println("Error creating an attachment:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to save attachment"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "Attachment uploaded successfully!",
+			"resourceId": attachment.ID,
+			"data":       attachment.Serialize(),
+		})
+	}
+}
+
+// DBGetAttachments represents the part of the datalayer responsible for listing the attachments on a todo
+type DBGetAttachments interface {
+	GetAttachments(todoID, userID uint) ([]*Attachment, error)
+}
+
+// GetAttachments returns a function which handles requests for the attachments on a todo the current User can see
+func GetAttachments(db DBGetAttachments) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		attachments, err := db.GetAttachments(todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching attachments",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(attachments))
+		for i, item := range attachments {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBOpenAttachment represents the part of the datalayer responsible for reading the contents of an attachment
+type DBOpenAttachment interface {
+	OpenAttachment(attachmentID, todoID, userID uint) (*Attachment, io.ReadCloser, error)
+}
+
+// DownloadAttachment returns a function which handles requests to download an attachment on a todo the current User can see
+func DownloadAttachment(db DBOpenAttachment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		attachmentID, ok := getAttachmentIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		attachment, content, err := db.OpenAttachment(attachmentID, todoID, userID)
+		if err == sql.ErrNoRows || err == storage.ErrorBlobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find attachment"})
+			return
+		} else if err == models.ErrorNoBlobStore {
+			c.JSON(http.StatusNotImplemented, gin.H{"status": http.StatusNotImplemented, "message": err.Error()})
+			return
+		} else if err != nil {
+			log.Println("Error reading an attachment:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to read attachment"})
+			return
+		}
+		defer content.Close()
+
+		c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+			"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}),
+			"X-Content-Type-Options": "nosniff",
+		})
+	}
+}
+
+// DBDeleteAttachment represents the part of the datalayer responsible for deleting an attachment
+type DBDeleteAttachment interface {
+	DeleteAttachment(attachmentID, todoID, userID uint) (uint, error)
+}
+
+// DeleteAttachment returns a function which handles requests to delete an attachment from a todo the current User can edit
+func DeleteAttachment(db DBDeleteAttachment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		attachmentID, ok := getAttachmentIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		deletedAttachmentID, err := db.DeleteAttachment(attachmentID, todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find attachment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Attachment deleted successfully!", "resourceId": deletedAttachmentID})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockAttachments struct {
+	err         error
+	contentType *string // records the content type passed to CreateAttachment
+}
+
+func (db mockAttachments) CreateAttachment(a *Attachment, content io.Reader) error {
+	a.ID = 1
+	if db.contentType != nil {
+		*db.contentType = a.ContentType
+	}
+	return db.err
+}
+
+func (db mockAttachments) GetAttachments(todoID, userID uint) ([]*Attachment, error) {
+	return []*Attachment{{ID: 1, TodoID: todoID, UserID: userID, Filename: "notes.txt", CreatedAt: time.Now()}}, db.err
+}
+
+func (db mockAttachments) OpenAttachment(attachmentID, todoID, userID uint) (*Attachment, io.ReadCloser, error) {
+	if db.err != nil {
+		return nil, nil, db.err
+	}
+	attachment := &Attachment{ID: attachmentID, TodoID: todoID, Filename: "my notes.txt", ContentType: "text/plain", Size: 5}
+	return attachment, ioutil.NopCloser(bytes.NewBufferString("hello")), nil
+}
+
+func (db mockAttachments) DeleteAttachment(attachmentID, todoID, userID uint) (uint, error) {
+	return attachmentID, db.err
+}
+
+// multipartBody builds an upload of the given content in the named field
+func multipartBody(field string, content []byte) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile(field, "../notes.txt")
+	part.Write(content)
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func TestUploadAttachment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var contentType string
+	tests := []struct {
+		db           DBCreateAttachment
+		field        string
+		content      []byte
+		expectedCode int
+	}{
+		{mockAttachments{contentType: &contentType}, "file", []byte("hello"), http.StatusCreated},
+		{mockAttachments{}, "upload", []byte("hello"), http.StatusBadRequest},
+		{mockAttachments{}, "file", bytes.Repeat([]byte("a"), 101), http.StatusRequestEntityTooLarge},
+		{mockAttachments{err: sql.ErrNoRows}, "file", []byte("hello"), http.StatusNotFound},
+		{mockAttachments{err: models.ErrorNoBlobStore}, "file", []byte("hello"), http.StatusNotImplemented},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "5"}}
+		body, formType := multipartBody(test.field, test.content)
+		req, _ := http.NewRequest("POST", "http://example.com/", body)
+		req.Header.Set("Content-Type", formType)
+		mockContext.Request = req
+		UploadAttachment(test.db, 100)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.field, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+	if contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the content type to be sniffed but received %s", contentType)
+	}
+}
+
+func TestUploadAttachmentContentLength(t *testing.T) {
+	t.Log(`should reject uploads whose declared length is too large before reading them`)
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "5"}}
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewBuffer(make([]byte, 100+multipartOverhead+1)))
+	mockContext.Request = req
+	UploadAttachment(mockAttachments{}, 100)(mockContext)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d but received %d", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "5"}, {Key: "attachmentId", Value: "1"}}
+	mockContext.Request, _ = http.NewRequest("GET", "http://example.com/", nil)
+	DownloadAttachment(mockAttachments{})(mockContext)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "hello" {
+		t.Errorf("Expected the attachment content but received %d %s", recorder.Code, recorder.Body)
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != `attachment; filename="my notes.txt"` {
+		t.Errorf("Unexpected Content-Disposition %s", disposition)
+	}
+	if recorder.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("Expected downloads not to be sniffed by browsers")
+	}
+}
+
+func TestAttachmentHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		attachmentID string
+		expectedCode int
+	}{
+		{GetAttachments(mockAttachments{}), "", http.StatusOK},
+		{DownloadAttachment(mockAttachments{err: sql.ErrNoRows}), "1", http.StatusNotFound},
+		{DownloadAttachment(mockAttachments{}), "first", http.StatusBadRequest},
+		{DeleteAttachment(mockAttachments{}), "1", http.StatusOK},
+		{DeleteAttachment(mockAttachments{err: models.ErrorRowsUnaffected}), "1", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "5"}, {Key: "attachmentId", Value: test.attachmentID}}
+		mockContext.Request, _ = http.NewRequest("GET", "http://example.com/", nil)
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.attachmentID, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "5"}}
+	GetAttachments(mockAttachments{})(mockContext)
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || len(response.Data) != 1 {
+		t.Errorf("Expected one attachment but received %s", recorder.Body)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxBatchSize is the most operations a single batch may contain
+const maxBatchSize = 100
+
+// DBRunBatch represents the part of the datalayer responsible for applying many changes to todos at once
+type DBRunBatch interface {
+	RunBatch(userID uint, ops []models.BatchOperation, atomic bool, currentTime time.Time) ([]models.BatchResult, error)
+}
+
+// batchOperation is a single operation in the body of a batch request
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      uint            `json:"id"`      // the todo to change, unused when creating
+	Todo    json.RawMessage `json:"todo"`    // the todo to create, or a merge patch when updating
+	After   *uint           `json:"after"`   // when moving, the todo to place this one directly after
+	Before  *uint           `json:"before"`  // when moving, the todo to place this one directly before
+	TagID   uint            `json:"tagId"`   // the tag to attach
+	Version int             `json:"version"` // when updating or deleting, the version from the todo's ETag which it must still be at
+}
+
+// toOperation validates the operation and converts it for the datalayer
+func (body batchOperation) toOperation(userID uint) (models.BatchOperation, error) {
+	op := models.BatchOperation{Action: body.Op, TodoID: body.ID, Version: body.Version}
+	if body.Op != models.BatchCreate && body.ID == 0 {
+		return op, fmt.Errorf("`id` is required")
+	}
+
+	var err error
+	switch body.Op {
+	case models.BatchCreate:
+		var todo newTodo
+		if err = json.Unmarshal(body.Todo, &todo); err != nil {
+			return op, fmt.Errorf("`todo` must be a todo")
+		}
+		op.Todo, err = todo.toTodo(userID)
+	case models.BatchUpdate:
+		op.Patch, err = parseTodoPatch(body.Todo)
+		op.Patch.Version = body.Version
+	case models.BatchMove:
+		if body.After == nil && body.Before == nil {
+			err = fmt.Errorf("at least one of after or before must be given")
+		}
+		op.AfterID, op.BeforeID = body.After, body.Before
+	case models.BatchTag:
+		if body.TagID == 0 {
+			err = fmt.Errorf("`tagId` is required")
+		}
+		op.TagID = body.TagID
+	case models.BatchComplete, models.BatchReopen, models.BatchDelete:
+	default:
+		err = models.ErrorInvalidBatchAction
+	}
+	return op, err
+}
+
+// batchStatus is the status code of an operation in a batch, matching the endpoint for the same change
+func batchStatus(action string, err error) int {
+	if err == nil && action == models.BatchCreate {
+		return http.StatusCreated
+	}
+	return errorStatus(err)
+}
+
+// errorStatus is the HTTP status code matching an error from the datalayer
+func errorStatus(err error) int {
+	switch err {
+	case nil:
+		return http.StatusOK
+	case sql.ErrNoRows, models.ErrorRowsUnaffected:
+		return http.StatusNotFound
+	case models.ErrorEmptyTodo, models.ErrorListNotFound, models.ErrorParentNotFound, models.ErrorInvalidBatchAction,
+		models.ErrorInvalidPrevious:
+		return http.StatusBadRequest
+	case models.ErrorHasSubtasks, models.ErrorHasOpenSubtasks, models.ErrorInvalidMove:
+		return http.StatusConflict
+	case models.ErrorVersionMismatch:
+		return http.StatusPreconditionFailed
+	case models.ErrorBatchRolledBack:
+		return http.StatusFailedDependency
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RunBatch returns a function which handles requests to apply a list of operations to the current User's todos in a single transaction.
+// Each operation has its own result, and an atomic batch is rolled back entirely when any operation fails.
+func RunBatch(db DBRunBatch) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Atomic     bool             `json:"atomic"`
+			Operations []batchOperation `json:"operations" binding:"required"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+		if len(body.Operations) == 0 || len(body.Operations) > maxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: a batch must contain between 1 and %d operations", maxBatchSize),
+			})
+			return
+		}
+
+		ops := make([]models.BatchOperation, len(body.Operations))
+		for i, operation := range body.Operations {
+			op, err := operation.toOperation(userID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": fmt.Sprintf("Bad request: operation %d: %s", i, err.Error()),
+				})
+				return
+			}
+			ops[i] = op
+		}
+
+		results, err := db.RunBatch(userID, ops, body.Atomic, time.Now())
+		if err != nil {
+			log.Println("Error applying a batch:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to apply batch",
+			})
+			return
+		}
+
+		status, message := http.StatusOK, "Batch applied successfully!"
+		data := make([]map[string]interface{}, len(results))
+		for i, result := range results {
+			itemStatus := batchStatus(ops[i].Action, result.Err)
+			item := map[string]interface{}{"status": itemStatus}
+			if result.TodoID != 0 {
+				item["resourceId"] = result.TodoID
+			}
+			if result.Todo != nil {
+				item["data"] = result.Todo.Serialize()
+			}
+			if itemStatus == http.StatusInternalServerError {
+				log.Println("Error applying a batch operation:\t", result.Err)
+				item["message"] = "Unable to apply operation"
+			} else if result.Err != nil {
+				item["message"] = result.Err.Error()
+			}
+			if result.Err == nil {
+				publish(c, batchEventType(ops[i]), result.TodoID, result.Todo)
+			}
+			if body.Atomic && result.Err != nil && result.Err != models.ErrorBatchRolledBack {
+				status, message = itemStatus, "Batch was rolled back"
+			}
+			data[i] = item
+		}
+
+		c.JSON(status, gin.H{"status": status, "message": message, "data": data})
+	}
+}
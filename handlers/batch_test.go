@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockBatch fails any operation on todo 404, rolling back the others when the batch is atomic
+type mockBatch struct{}
+
+func (db mockBatch) RunBatch(userID uint, ops []models.BatchOperation, atomic bool, currentTime time.Time) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(ops))
+	failed := false
+	for i, op := range ops {
+		results[i].TodoID = op.TodoID
+		if op.TodoID == 404 {
+			results[i].Err = models.ErrorRowsUnaffected
+			failed = true
+		} else if op.Action != models.BatchDelete && op.Action != models.BatchTag {
+			results[i].Todo = &Todo{ID: op.TodoID, UserID: userID}
+		}
+	}
+	if atomic && failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = models.BatchResult{TodoID: ops[i].TodoID, Err: models.ErrorBatchRolledBack}
+			}
+		}
+	}
+	return results, nil
+}
+
+func TestRunBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		body          string
+		expectedCode  int
+		expectedItems []int
+	}{
+		{`{"operations": [{"op": "create", "todo": {"title": "buy milk"}}, {"op": "complete", "id": 2},
+			{"op": "update", "id": 3, "todo": {"priority": "high"}}, {"op": "move", "id": 3, "after": 2},
+			{"op": "tag", "id": 3, "tagId": 1}, {"op": "reopen", "id": 2}, {"op": "delete", "id": 4}]}`,
+			http.StatusOK, []int{http.StatusCreated, 200, 200, 200, 200, 200, 200}},
+		{`{"operations": [{"op": "complete", "id": 2}, {"op": "delete", "id": 404}]}`,
+			http.StatusOK, []int{http.StatusOK, http.StatusNotFound}},
+		{`{"atomic": true, "operations": [{"op": "complete", "id": 2}, {"op": "delete", "id": 404}]}`,
+			http.StatusNotFound, []int{http.StatusFailedDependency, http.StatusNotFound}},
+		{`{"operations": []}`, http.StatusBadRequest, nil},
+		{`{"operations": [{"op": "archive", "id": 2}]}`, http.StatusBadRequest, nil},
+		{`{"operations": [{"op": "complete"}]}`, http.StatusBadRequest, nil},
+		{`{"operations": [{"op": "update", "id": 2, "todo": {"userId": 2}}]}`, http.StatusBadRequest, nil},
+		{`{"operations": [{"op": "move", "id": 2}]}`, http.StatusBadRequest, nil},
+		{`{"operations": [{"op": "create", "todo": {"title": "buy milk", "priority": "soon"}}]}`, http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		RunBatch(mockBatch{})(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.body, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+		if test.expectedItems == nil {
+			continue
+		}
+		var response struct {
+			Data []struct {
+				Status int `json:"status"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || len(response.Data) != len(test.expectedItems) {
+			t.Errorf("%s: expected %d results but received %s", test.body, len(test.expectedItems), recorder.Body)
+			continue
+		}
+		for i, item := range response.Data {
+			if item.Status != test.expectedItems[i] {
+				t.Errorf("%s: expected operation %d to have status %d but received %d",
+					test.body, i, test.expectedItems[i], item.Status)
+			}
+		}
+	}
+}
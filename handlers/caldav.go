@@ -0,0 +1,641 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"github.com/vancelongwill/gotodos/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CalendarObject is a type alias for convenience
+type CalendarObject = models.CalendarObject
+
+// XML namespaces of the properties used by CalDAV clients
+const (
+	davNamespace            = "DAV:"
+	calDAVNamespace         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+const (
+	caldavCollection = "todos"   // the name of the collection holding each user's todos
+	maxCalendarSize  = 256 << 10 // the largest calendar object accepted, in bytes
+)
+
+// CalDAVStore is the datastore API for syncing todos with CalDAV clients
+type CalDAVStore interface {
+	DBReadCalendar
+	DBPutCalendarObject
+	DBDeleteCalendarObject
+}
+
+// DBReadCalendar represents the part of the datalayer responsible for reading a user's todos as a calendar
+type DBReadCalendar interface {
+	GetCalendarObjects(userID uint, names []string) ([]*CalendarObject, error)
+	GetCalendarTag(userID uint) (string, error)
+}
+
+// DBAuthenticateCalendarUser represents the part of the datalayer responsible for checking the credentials of CalDAV clients
+type DBAuthenticateCalendarUser interface {
+	AuthenticateCalendarUser(email, password string) (uint, error)
+}
+
+// CalendarCredentials returns a function which checks the email and CalDAV password sent by a CalDAV client,
+// for use with middleware.AuthorizeBasic
+func CalendarCredentials(db DBAuthenticateCalendarUser) func(email, password string) (uint, bool, error) {
+	return func(email, password string) (uint, bool, error) {
+		userID, err := db.AuthenticateCalendarUser(email, password)
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return userID, err == nil, err
+	}
+}
+
+// CalDAVPassword is a type alias for convenience
+type CalDAVPassword = models.CalDAVPassword
+
+// DBCreateCalDAVPassword represents the part of the datalayer responsible for creating CalDAV passwords
+type DBCreateCalDAVPassword interface {
+	CreateCalDAVPassword(userID uint) (*CalDAVPassword, error)
+}
+
+// CreateCalDAVPassword returns a function which handles requests to create a new CalDAV password for the current
+// User, revoking any they had before
+func CreateCalDAVPassword(db DBCreateCalDAVPassword) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		password, err := db.CreateCalDAVPassword(userID)
+		if err != nil {
+			log.Println("Error creating a CalDAV password:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to create CalDAV password",
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "CalDAV password created successfully!",
+			"data":    password.Serialize(),
+		})
+	}
+}
+
+// DBRevokeCalDAVPassword represents the part of the datalayer responsible for revoking CalDAV passwords
+type DBRevokeCalDAVPassword interface {
+	RevokeCalDAVPassword(userID uint) error
+}
+
+// RevokeCalDAVPassword returns a function which handles requests to revoke the current User's CalDAV password
+func RevokeCalDAVPassword(db DBRevokeCalDAVPassword) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		if err := db.RevokeCalDAVPassword(userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find CalDAV password"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "CalDAV password revoked successfully!"})
+	}
+}
+
+// davProperty is a WebDAV property of a resource, with its value as XML
+type davProperty struct {
+	name  xml.Name
+	value string
+}
+
+// davResource is a resource described in a multistatus response, either by its properties or by a status
+// when it doesn't exist
+type davResource struct {
+	href   string
+	props  []davProperty
+	status int
+}
+
+// davPropNames reads the names of the properties requested in a <prop> element
+type davPropNames []xml.Name
+
+// UnmarshalXML implements xml.Unmarshaler
+func (p *davPropNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			*p = append(*p, t.Name)
+			if err = d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// davPropfind is the body of a PROPFIND request, which requests all properties when it has no <prop> element
+type davPropfind struct {
+	Prop davPropNames `xml:"DAV: prop"`
+}
+
+// davReport is the body of a REPORT request, either a calendar-query or a calendar-multiget
+type davReport struct {
+	XMLName xml.Name
+	Prop    davPropNames `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+	Filter  struct {
+		CompFilter struct {
+			CompFilters []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// matchesTodos reports whether a calendar-query's filter can match VTODOs. Other filters, such as time ranges,
+// aren't applied, so clients receive every todo and filter them themselves.
+func (r *davReport) matchesTodos() bool {
+	filters := r.Filter.CompFilter.CompFilters
+	for _, filter := range filters {
+		if strings.ToUpper(filter.Name) == componentTodo {
+			return true
+		}
+	}
+	return len(filters) == 0
+}
+
+// xmlText escapes text for use in XML
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davProp makes a property, whose value is XML using the D, C & CS prefixes of the multistatus response
+func davProp(space, local, value string) davProperty {
+	return davProperty{xml.Name{Space: space, Local: local}, value}
+}
+
+// davHref is the XML value of a property holding a url
+func davHref(href string) string {
+	return "<D:href>" + xmlText(href) + "</D:href>"
+}
+
+// caldavTarget finds which resource a request is for from the `path` param, one of the home collection,
+// the todos collection, or a todo within it, or none when the path doesn't match any of them
+func caldavTarget(c *gin.Context) (home, collection bool, name string) {
+	parts := strings.SplitN(strings.Trim(c.Param("path"), "/"), "/", 2)
+	switch {
+	case len(parts[0]) == 0:
+		return true, false, ""
+	case parts[0] != caldavCollection:
+		return false, false, ""
+	case len(parts) == 1:
+		return false, true, ""
+	}
+	if len(parts[1]) > 255 || strings.Contains(parts[1], "/") {
+		return false, false, ""
+	}
+	return false, false, parts[1]
+}
+
+// caldavPrivileges are what the user may do with the resources of their own calendar
+const caldavPrivileges = `<D:privilege><D:read/></D:privilege><D:privilege><D:write/></D:privilege>` +
+	`<D:privilege><D:write-content/></D:privilege><D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>`
+
+// homeResource describes the user's home collection, which is also their principal, holding their calendar
+func homeResource(root string) davResource {
+	home := root + "/"
+	return davResource{href: home, props: []davProperty{
+		davProp(davNamespace, "resourcetype", "<D:collection/>"),
+		davProp(davNamespace, "displayname", "gotodos"),
+		davProp(davNamespace, "current-user-principal", davHref(home)),
+		davProp(davNamespace, "principal-URL", davHref(home)),
+		davProp(calDAVNamespace, "calendar-home-set", davHref(home)),
+		davProp(davNamespace, "current-user-privilege-set", "<D:privilege><D:read/></D:privilege>"),
+	}}
+}
+
+// collectionResource describes the calendar collection holding the user's todos, with the tag which changes
+// whenever they do
+func collectionResource(root, ctag string) davResource {
+	return davResource{href: root + "/" + caldavCollection + "/", props: []davProperty{
+		davProp(davNamespace, "resourcetype", "<D:collection/><C:calendar/>"),
+		davProp(davNamespace, "displayname", "Todos"),
+		davProp(davNamespace, "current-user-principal", davHref(root+"/")),
+		davProp(davNamespace, "current-user-privilege-set", caldavPrivileges),
+		davProp(davNamespace, "supported-report-set",
+			"<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>"+
+				"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>"),
+		davProp(calDAVNamespace, "supported-calendar-component-set", `<C:comp name="VTODO"/>`),
+		davProp(calendarServerNamespace, "getctag", xmlText(ctag)),
+	}}
+}
+
+// calendarData renders a todo as an iCalendar object, including what clients need to edit it
+func calendarData(o *CalendarObject) string {
+	w := icalWriter{sync: true}
+	w.beginCalendar("")
+	w.todo(o, componentTodo)
+	w.endCalendar()
+	return w.String()
+}
+
+// objectHref is the url of a todo in the calendar collection
+func objectHref(root, name string) string {
+	return root + "/" + caldavCollection + "/" + url.PathEscape(name)
+}
+
+// objectResource describes a todo in the calendar collection
+func objectResource(root string, o *CalendarObject) davResource {
+	return davResource{href: objectHref(root, o.Name), props: []davProperty{
+		davProp(davNamespace, "resourcetype", ""),
+		davProp(davNamespace, "getetag", xmlText(todoETag(o.Todo))),
+		davProp(davNamespace, "getcontenttype", "text/calendar; charset=utf-8; component=VTODO"),
+		davProp(davNamespace, "getlastmodified", o.Todo.ModifiedAt.UTC().Format(http.TimeFormat)),
+		davProp(calDAVNamespace, "calendar-data", xmlText(calendarData(o))),
+	}}
+}
+
+// writeMultistatus responds with the requested properties of each resource, or all but their calendar data
+// when none were requested
+func writeMultistatus(c *gin.Context, resources []davResource, requested davPropNames) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<D:multistatus xmlns:D="` + davNamespace + `" xmlns:C="` + calDAVNamespace +
+		`" xmlns:CS="` + calendarServerNamespace + `">`)
+
+	writeProps := func(props []davProperty, status int) {
+		b.WriteString("<D:propstat><D:prop>")
+		for _, p := range props {
+			fmt.Fprintf(&b, `<%s xmlns="%s">%s</%[1]s>`, p.name.Local, xmlText(p.name.Space), p.value)
+		}
+		fmt.Fprintf(&b, "</D:prop><D:status>HTTP/1.1 %d %s</D:status></D:propstat>", status, http.StatusText(status))
+	}
+
+	for _, resource := range resources {
+		b.WriteString("<D:response>" + davHref(resource.href))
+		if resource.status != 0 {
+			fmt.Fprintf(&b, "<D:status>HTTP/1.1 %d %s</D:status></D:response>", resource.status, http.StatusText(resource.status))
+			continue
+		}
+
+		found, missing := make([]davProperty, 0), make([]davProperty, 0)
+		if len(requested) == 0 {
+			for _, p := range resource.props {
+				if p.name.Local != "calendar-data" {
+					found = append(found, p)
+				}
+			}
+		}
+		for _, name := range requested {
+			property := davProperty{name: name}
+			for _, p := range resource.props {
+				if p.name == name {
+					property = p
+				}
+			}
+			if property.value == "" && property.name.Local != "resourcetype" {
+				missing = append(missing, property)
+			} else {
+				found = append(found, property)
+			}
+		}
+		if len(found) > 0 || len(missing) == 0 {
+			writeProps(found, http.StatusOK)
+		}
+		if len(missing) > 0 {
+			writeProps(missing, http.StatusNotFound)
+		}
+		b.WriteString("</D:response>")
+	}
+
+	b.WriteString("</D:multistatus>")
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+// davError responds with a WebDAV error body naming the precondition which failed, e.g. "C:valid-calendar-data"
+func davError(c *gin.Context, status int, condition string) {
+	c.Data(status, "application/xml; charset=utf-8", []byte(xml.Header+
+		`<D:error xmlns:D="`+davNamespace+`" xmlns:C="`+calDAVNamespace+`"><`+condition+`/></D:error>`))
+}
+
+// readDAVBody decodes the XML body of a request into v, leaving it unchanged when the body is empty.
+// It responds with 400 Bad Request when the body can't be decoded.
+func readDAVBody(c *gin.Context, v interface{}) bool {
+	body, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxCalendarSize))
+	if err == nil && len(bytes.TrimSpace(body)) > 0 {
+		err = xml.Unmarshal(body, v)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Bad request: invalid XML body"})
+		return false
+	}
+	return true
+}
+
+// caldavNotFound responds with 404 Not Found for a path which isn't one of the CalDAV resources
+func caldavNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Not found"})
+}
+
+// caldavError responds with 500 Internal Server Error after failing to read or write a calendar
+func caldavError(c *gin.Context, err error) {
+	log.Println("Error syncing calendar:\t", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Error syncing calendar"})
+}
+
+// CalDAVOptions handles OPTIONS requests, telling clients that CalDAV is supported
+func CalDAVOptions(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	c.Header("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	c.Status(http.StatusOK)
+}
+
+// CalDAVPropfind returns a function which handles PROPFIND requests for the properties of the current User's
+// CalDAV resources, which are served under root. Unless the Depth header is 0, the members of a collection are
+// included along with it.
+func CalDAVPropfind(db DBReadCalendar, root string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		var find davPropfind
+		if !readDAVBody(c, &find) {
+			return
+		}
+		home, collection, name := caldavTarget(c)
+		depth := c.GetHeader("Depth") != "0"
+
+		var resources []davResource
+		if home {
+			resources = append(resources, homeResource(root))
+		}
+		if collection || (home && depth) {
+			ctag, err := db.GetCalendarTag(userID)
+			if err != nil {
+				caldavError(c, err)
+				return
+			}
+			resources = append(resources, collectionResource(root, ctag))
+		}
+		if (collection && depth) || len(name) > 0 {
+			var names []string
+			if len(name) > 0 {
+				names = []string{name}
+			}
+			objects, err := db.GetCalendarObjects(userID, names)
+			if err != nil {
+				caldavError(c, err)
+				return
+			}
+			if len(name) > 0 && len(objects) == 0 {
+				caldavNotFound(c)
+				return
+			}
+			for _, o := range objects {
+				resources = append(resources, objectResource(root, o))
+			}
+		}
+		if len(resources) == 0 {
+			caldavNotFound(c)
+			return
+		}
+		writeMultistatus(c, resources, find.Prop)
+	}
+}
+
+// CalDAVReport returns a function which handles calendar-query and calendar-multiget REPORT requests for the
+// current User's todos, which are served under root
+func CalDAVReport(db DBReadCalendar, root string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		if _, collection, _ := caldavTarget(c); !collection {
+			caldavNotFound(c)
+			return
+		}
+		var report davReport
+		if !readDAVBody(c, &report) {
+			return
+		}
+
+		var names []string
+		hrefs := make(map[string]string) // the href requested for each name, which is used in the response
+		switch {
+		case report.XMLName == xml.Name{Space: calDAVNamespace, Local: "calendar-multiget"}:
+			names = make([]string, 0, len(report.Hrefs))
+			for _, href := range report.Hrefs {
+				if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+					prefix := root + "/" + caldavCollection + "/"
+					if name := strings.TrimPrefix(u.Path, prefix); name != u.Path && len(name) > 0 {
+						names = append(names, name)
+						hrefs[name] = strings.TrimSpace(href)
+					}
+				}
+			}
+		case report.XMLName == xml.Name{Space: calDAVNamespace, Local: "calendar-query"}:
+			if !report.matchesTodos() {
+				writeMultistatus(c, nil, report.Prop)
+				return
+			}
+		default:
+			davError(c, http.StatusForbidden, "D:supported-report")
+			return
+		}
+
+		objects, err := db.GetCalendarObjects(userID, names)
+		if err != nil {
+			caldavError(c, err)
+			return
+		}
+		resources := make([]davResource, 0, len(objects))
+		for _, o := range objects {
+			resources = append(resources, objectResource(root, o))
+			delete(hrefs, o.Name)
+		}
+		for _, href := range hrefs {
+			resources = append(resources, davResource{href: href, status: http.StatusNotFound})
+		}
+		writeMultistatus(c, resources, report.Prop)
+	}
+}
+
+// CalDAVGet returns a function which handles requests for one of the current User's todos as an iCalendar object
+func CalDAVGet(db DBReadCalendar) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		_, _, name := caldavTarget(c)
+		if len(name) == 0 {
+			caldavNotFound(c)
+			return
+		}
+
+		objects, err := db.GetCalendarObjects(userID, []string{name})
+		if err != nil {
+			caldavError(c, err)
+			return
+		}
+		if len(objects) == 0 {
+			caldavNotFound(c)
+			return
+		}
+
+		etag := todoETag(objects[0].Todo)
+		c.Header("ETag", etag)
+		if notModified(c, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(calendarData(objects[0])))
+	}
+}
+
+// DBPutCalendarObject represents the part of the datalayer responsible for creating & replacing todos from CalDAV clients
+type DBPutCalendarObject interface {
+	PutCalendarObject(o *CalendarObject, version int, mustCreate bool, currentTime time.Time) (bool, error)
+}
+
+// CalDAVPut returns a function which handles requests to create or replace one of the current User's todos with
+// the VTODO in the body. `If-None-Match: *` only creates a todo, and If-Match only replaces the todo at that version.
+func CalDAVPut(db DBPutCalendarObject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		_, _, name := caldavTarget(c)
+		if len(name) == 0 {
+			caldavNotFound(c)
+			return
+		}
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarSize))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status":  http.StatusRequestEntityTooLarge,
+				"message": fmt.Sprintf("Calendar objects may be at most %d bytes", maxCalendarSize),
+			})
+			return
+		}
+		o, err := parseVTodo(data)
+		if err == errorNotTodo {
+			davError(c, http.StatusForbidden, "C:supported-calendar-component")
+			return
+		} else if err != nil {
+			davError(c, http.StatusForbidden, "C:valid-calendar-data")
+			return
+		}
+		o.Name = name
+		o.Todo.UserID = userID
+
+		created, err := db.PutCalendarObject(o, version, strings.TrimSpace(c.GetHeader("If-None-Match")) == "*", time.Now())
+		switch err {
+		case nil:
+		case models.ErrorVersionMismatch:
+			c.JSON(http.StatusPreconditionFailed, gin.H{
+				"status":  http.StatusPreconditionFailed,
+				"message": "Todo has been changed since it was fetched",
+			})
+			return
+		case models.ErrorEmptyTodo:
+			davError(c, http.StatusForbidden, "C:valid-calendar-object-resource")
+			return
+		case models.ErrorReservedCalendarName:
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"message": err.Error(),
+			})
+			return
+		default:
+			caldavError(c, err)
+			return
+		}
+
+		eventType := events.Updated
+		if created {
+			eventType = events.Created
+		}
+		publish(c, eventType, o.Todo.ID, o.Todo)
+
+		// the todo is stored as its fields rather than as the client sent it, so there's no ETag for the client
+		// to keep its own copy with, see RFC 4791 section 5.3.4
+		if created {
+			c.Status(http.StatusCreated)
+		} else {
+			c.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// DBDeleteCalendarObject represents the part of the datalayer responsible for deleting todos from CalDAV clients
+type DBDeleteCalendarObject interface {
+	DeleteCalendarObject(userID uint, name string, version int) (uint, error)
+}
+
+// CalDAVDelete returns a function which handles requests to move one of the current User's todos to the trash
+func CalDAVDelete(db DBDeleteCalendarObject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		_, _, name := caldavTarget(c)
+		if len(name) == 0 {
+			caldavNotFound(c)
+			return
+		}
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+
+		todoID, err := db.DeleteCalendarObject(userID, name, version)
+		switch err {
+		case nil:
+			publish(c, events.Deleted, todoID, nil)
+			c.Status(http.StatusNoContent)
+		case sql.ErrNoRows, models.ErrorRowsUnaffected:
+			caldavNotFound(c)
+		case models.ErrorVersionMismatch:
+			c.JSON(http.StatusPreconditionFailed, gin.H{
+				"status":  http.StatusPreconditionFailed,
+				"message": "Todo has been changed since it was fetched",
+			})
+		default:
+			caldavError(c, err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockCalendar is a CalDAV store holding a user's todos in memory
+type mockCalendar struct {
+	objects map[string]*CalendarObject
+}
+
+func (db *mockCalendar) GetCalendarObjects(userID uint, names []string) ([]*CalendarObject, error) {
+	objects := make([]*CalendarObject, 0)
+	for name, o := range db.objects {
+		if names == nil {
+			objects = append(objects, o)
+		}
+		for _, n := range names {
+			if n == name {
+				objects = append(objects, o)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (db *mockCalendar) GetCalendarTag(userID uint) (string, error) {
+	return "1-1", nil
+}
+
+func (db *mockCalendar) PutCalendarObject(o *CalendarObject, version int, mustCreate bool, currentTime time.Time) (bool, error) {
+	existing, ok := db.objects[o.Name]
+	if (ok && mustCreate) || (!ok && version != 0) || (ok && version != 0 && version != existing.Todo.Version) {
+		return false, models.ErrorVersionMismatch
+	}
+	o.Todo.Version = 1
+	if ok {
+		o.Todo.Version = existing.Todo.Version + 1
+	}
+	db.objects[o.Name] = o
+	return !ok, nil
+}
+
+func (db *mockCalendar) DeleteCalendarObject(userID uint, name string, version int) (uint, error) {
+	o, ok := db.objects[name]
+	if !ok {
+		return 0, models.ErrorRowsUnaffected
+	}
+	delete(db.objects, name)
+	return o.Todo.ID, nil
+}
+
+type mockCalDAVPassword struct {
+	err error
+}
+
+func (db mockCalDAVPassword) CreateCalDAVPassword(userID uint) (*CalDAVPassword, error) {
+	return &CalDAVPassword{UserID: userID, Password: "abc123"}, db.err
+}
+
+func (db mockCalDAVPassword) RevokeCalDAVPassword(userID uint) error {
+	return db.err
+}
+
+// caldavEngine serves a CalDAV store as main does, without authorization
+func caldavEngine(db CalDAVStore) *gin.Engine {
+	engine := gin.New()
+	caldav := engine.Group("/caldav")
+	caldav.Use(func(c *gin.Context) { c.Set("userID", uint(1)) })
+	caldav.OPTIONS("/*path", CalDAVOptions)
+	caldav.Handle("PROPFIND", "/*path", CalDAVPropfind(db, "/caldav"))
+	caldav.Handle("REPORT", "/*path", CalDAVReport(db, "/caldav"))
+	caldav.GET("/*path", CalDAVGet(db))
+	caldav.PUT("/*path", CalDAVPut(db))
+	caldav.DELETE("/*path", CalDAVDelete(db))
+	return engine
+}
+
+const newVTodo = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:abc@example.com\r\n" +
+	"SUMMARY:buy milk\\, eggs\r\nDESCRIPTION:semi skimmed\\ntwo pints\r\nDUE;TZID=UTC:20190322T170000\r\nPRIORITY:2\r\n" +
+	"CATEGORIES:groceries,shops\r\nBEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:ignored\r\nEND:VALARM\r\n" +
+	"END:VTODO\r\nEND:VCALENDAR\r\n"
+
+func TestCalDAVSync(t *testing.T) {
+	t.Log(`Should let a CalDAV client discover, create, read, update and delete todos`)
+	gin.SetMode(gin.TestMode)
+	db := &mockCalendar{objects: make(map[string]*CalendarObject)}
+	engine := caldavEngine(db)
+
+	steps := []struct {
+		method, path, body string
+		headers            map[string]string
+		expectedCode       int
+		expected           []string
+	}{
+		{"OPTIONS", "/caldav/", "", nil, http.StatusOK, nil},
+		{"PROPFIND", "/caldav/", `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+			`<d:prop><d:current-user-principal/><c:calendar-home-set/></d:prop></d:propfind>`,
+			map[string]string{"Depth": "0"}, http.StatusMultiStatus, []string{
+				`<current-user-principal xmlns="DAV:"><D:href>/caldav/</D:href></current-user-principal>`,
+				`<calendar-home-set xmlns="urn:ietf:params:xml:ns:caldav"><D:href>/caldav/</D:href></calendar-home-set>`}},
+		{"PUT", "/caldav/todos/abc.ics", newVTodo, map[string]string{"If-None-Match": "*"}, http.StatusCreated, nil},
+		{"PUT", "/caldav/todos/abc.ics", newVTodo, map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed, nil},
+		{"PROPFIND", "/caldav/todos/", `<d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">` +
+			`<d:prop><d:resourcetype/><d:getetag/><cs:getctag/><d:unknown/></d:prop></d:propfind>`,
+			map[string]string{"Depth": "1"}, http.StatusMultiStatus, []string{
+				`<D:href>/caldav/todos/</D:href><D:propstat><D:prop><resourcetype xmlns="DAV:"><D:collection/><C:calendar/></resourcetype>`,
+				`<getctag xmlns="http://calendarserver.org/ns/">1-1</getctag>`,
+				`<D:href>/caldav/todos/abc.ics</D:href>`, `<getetag xmlns="DAV:">&#34;0-1&#34;</getetag>`,
+				`<unknown xmlns="DAV:"></unknown></D:prop><D:status>HTTP/1.1 404 Not Found</D:status>`}},
+		{"REPORT", "/caldav/todos/", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+			`<d:prop><d:getetag/><c:calendar-data/></d:prop><d:href>/caldav/todos/abc.ics</d:href>` +
+			`<d:href>/caldav/todos/gone.ics</d:href></c:calendar-multiget>`,
+			nil, http.StatusMultiStatus, []string{
+				`UID:abc@example.com`, `SUMMARY:buy milk\, eggs`, `DUE:20190322T170000Z`, `PRIORITY:3`,
+				`CATEGORIES:groceries,shops`, `STATUS:NEEDS-ACTION`,
+				`<D:href>/caldav/todos/gone.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>`}},
+		{"REPORT", "/caldav/todos/", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+			`<d:prop><d:getetag/></d:prop><c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/>` +
+			`</c:comp-filter></c:filter></c:calendar-query>`,
+			nil, http.StatusMultiStatus, []string{`<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:CS="http://calendarserver.org/ns/"></D:multistatus>`}},
+		{"REPORT", "/caldav/todos/", `<d:sync-collection xmlns:d="DAV:"/>`, nil, http.StatusForbidden, nil},
+		{"GET", "/caldav/todos/abc.ics", "", map[string]string{"If-None-Match": "*"}, http.StatusNotModified, nil},
+		{"PUT", "/caldav/todos/abc.ics", strings.Replace(newVTodo, "PRIORITY:2\r\n", "STATUS:COMPLETED\r\n", 1),
+			map[string]string{"If-Match": `"0-1"`}, http.StatusNoContent, nil},
+		{"GET", "/caldav/todos/abc.ics", "", nil, http.StatusOK, []string{"BEGIN:VTODO", "STATUS:COMPLETED"}},
+		{"PUT", "/caldav/todos/abc.ics", newVTodo, map[string]string{"If-Match": `"0-1"`}, http.StatusPreconditionFailed, nil},
+		{"PUT", "/caldav/todos/event.ics", strings.Replace(newVTodo, "VTODO", "VEVENT", -1), nil, http.StatusForbidden,
+			[]string{"supported-calendar-component"}},
+		{"PUT", "/caldav/todos/bad.ics", "not a calendar", nil, http.StatusForbidden, []string{"valid-calendar-data"}},
+		{"DELETE", "/caldav/todos/abc.ics", "", nil, http.StatusNoContent, nil},
+		{"GET", "/caldav/todos/abc.ics", "", nil, http.StatusNotFound, nil},
+		{"PROPFIND", "/caldav/elsewhere/", "", nil, http.StatusNotFound, nil},
+	}
+
+	for _, step := range steps {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(step.method, step.path, strings.NewReader(step.body))
+		for name, value := range step.headers {
+			req.Header.Set(name, value)
+		}
+		engine.ServeHTTP(recorder, req)
+
+		if recorder.Code != step.expectedCode {
+			t.Errorf("%s %s: expected status code %d but received %d", step.method, step.path, step.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+			continue
+		}
+		for _, expected := range step.expected {
+			if !strings.Contains(recorder.Body.String(), expected) {
+				t.Errorf("%s %s: expected the response to contain %s but received %s", step.method, step.path, expected, recorder.Body)
+			}
+		}
+	}
+}
+
+func TestCalDAVPasswordHandlers(t *testing.T) {
+	t.Log(`Should create and revoke the current user's CalDAV password`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		expectedCode int
+		expected     string
+	}{
+		{CreateCalDAVPassword(mockCalDAVPassword{}), http.StatusCreated, `"password":"abc123"`},
+		{CreateCalDAVPassword(mockCalDAVPassword{errors.New("connection refused")}), http.StatusInternalServerError, ""},
+		{RevokeCalDAVPassword(mockCalDAVPassword{}), http.StatusOK, ""},
+		{RevokeCalDAVPassword(mockCalDAVPassword{models.ErrorRowsUnaffected}), http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("expected status code %d but received %d", test.expectedCode, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), test.expected) {
+			t.Errorf("expected the response to contain %s but received %s", test.expected, recorder.Body)
+		}
+	}
+}
+
+func TestParseVTodo(t *testing.T) {
+	t.Log(`Should map the properties of a VTODO onto a todo`)
+	o, err := parseVTodo([]byte(strings.Replace(newVTodo, "PRIORITY:2\r\n",
+		"STATUS:COMPLETED\r\nCOMPLETED:20190321T093000Z\r\nRRULE:FREQ=WEEKLY\r\nX-LONG:folded\r\n  line\r\n", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := o.Todo
+	if o.UID != "abc@example.com" || todo.Title.String != "buy milk, eggs" || todo.Note.String != "semi skimmed\ntwo pints" {
+		t.Errorf("Expected the UID, title and note to be read but received %+v", o)
+	}
+	dueAt := time.Date(2019, time.March, 22, 17, 0, 0, 0, time.UTC)
+	if !todo.DueAt.Time.Equal(dueAt) || !todo.IsDone || !todo.CompletedAt.Valid || todo.Recurrence.String != "FREQ=WEEKLY" {
+		t.Errorf("Expected the due date, completion and recurrence to be read but received %+v", todo)
+	}
+	if len(todo.Tags) != 2 || todo.Tags[1].Name != "shops" {
+		t.Errorf("Expected two tags but received %+v", todo.Tags)
+	}
+
+	if _, err = parseVTodo([]byte(strings.Replace(newVTodo, "UID:abc@example.com\r\n", "", 1))); err != errorMissingUID {
+		t.Errorf("Expected errorMissingUID but received %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"time"
+)
+
+// Comment is a type alias for convenience
+type Comment = models.Comment
+
+// CommentStore is the datastore API for comments
+type CommentStore interface {
+	DBCreateComment
+	DBGetComments
+	DBUpdateComment
+	DBDeleteComment
+}
+
+// getCommentIDFromContext reads a comment ID from the commentId url parameter
+func getCommentIDFromContext(c *gin.Context) (uint, bool) {
+	commentID, err := StringToUint(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Can't convert comment id in url to uint",
+		})
+		return 0, false
+	}
+	return commentID, true
+}
+
+// DBCreateComment represents the part of the datalayer responsible for commenting on todos
+type DBCreateComment interface {
+	CreateComment(c *Comment) error
+}
+
+// CreateComment returns a function which handles requests to comment on a todo the current User can see
+func CreateComment(db DBCreateComment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Body string `json:"body" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+
+		comment := Comment{TodoID: todoID, Author: User{ID: userID}, Body: body.Body}
+		if err := db.CreateComment(&comment); err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to save comment",
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "Comment created successfully!",
+			"resourceId": comment.ID,
+			"data":       comment.Serialize(),
+		})
+	}
+}
+
+// DBGetComments represents the part of the datalayer responsible for getting the comments on a todo
+type DBGetComments interface {
+	GetComments(todoID, userID uint) ([]*Comment, error)
+}
+
+// GetComments returns a function which handles requests for the comments on a todo the current User can see
+func GetComments(db DBGetComments) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		comments, err := db.GetComments(todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching comments",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(comments))
+		for i, item := range comments {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBUpdateComment represents the part of the datalayer responsible for editing a comment
+type DBUpdateComment interface {
+	UpdateComment(c Comment) (*Comment, error)
+}
+
+// UpdateComment returns a function which handles requests to edit one of the current User's comments
+func UpdateComment(db DBUpdateComment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		commentID, ok := getCommentIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Body string `json:"body" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Bad request",
+			})
+			return
+		}
+
+		comment := Comment{ID: commentID, TodoID: todoID, Author: User{ID: userID}, Body: body.Body, ModifiedAt: time.Now()}
+		if _, err := db.UpdateComment(comment); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find comment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Comment updated successfully!", "resourceId": commentID})
+	}
+}
+
+// DBDeleteComment represents the part of the datalayer responsible for deleting a comment
+type DBDeleteComment interface {
+	DeleteComment(commentID, todoID, userID uint) (uint, error)
+}
+
+// DeleteComment returns a function which handles requests to delete a comment, by its author or the todo's owner
+func DeleteComment(db DBDeleteComment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		commentID, ok := getCommentIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		deletedCommentID, err := db.DeleteComment(commentID, todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find comment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Comment deleted successfully!", "resourceId": deletedCommentID})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockComments struct {
+	err error
+}
+
+func (db mockComments) CreateComment(c *Comment) error {
+	c.ID = 1
+	return db.err
+}
+
+func (db mockComments) GetComments(todoID, userID uint) ([]*Comment, error) {
+	return []*Comment{{ID: 1, TodoID: todoID, Body: "on it", Author: User{ID: userID}}}, db.err
+}
+
+func (db mockComments) UpdateComment(c Comment) (*Comment, error) {
+	return &c, db.err
+}
+
+func (db mockComments) DeleteComment(commentID, todoID, userID uint) (uint, error) {
+	return commentID, db.err
+}
+
+func TestCommentHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		commentID    string
+		body         string
+		expectedCode int
+	}{
+		{CreateComment(mockComments{}), "", `{"body": "on it"}`, http.StatusCreated},
+		{CreateComment(mockComments{}), "", `{"body": ""}`, http.StatusBadRequest},
+		{CreateComment(mockComments{sql.ErrNoRows}), "", `{"body": "on it"}`, http.StatusNotFound},
+		{GetComments(mockComments{}), "", ``, http.StatusOK},
+		{UpdateComment(mockComments{}), "1", `{"body": "done"}`, http.StatusOK},
+		{UpdateComment(mockComments{models.ErrorRowsUnaffected}), "1", `{"body": "done"}`, http.StatusNotFound},
+		{UpdateComment(mockComments{}), "first", `{"body": "done"}`, http.StatusBadRequest},
+		{DeleteComment(mockComments{}), "1", ``, http.StatusOK},
+		{DeleteComment(mockComments{models.ErrorRowsUnaffected}), "1", ``, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "5"}, {Key: "commentId", Value: test.commentID}}
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.body, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// todoETag is the entity tag of a todo, made from its id and version, so that it's the same whichever response
+// the todo comes from and only changes along with the todo
+func todoETag(t *Todo) string {
+	return fmt.Sprintf(`"%d-%d"`, t.ID, t.Version)
+}
+
+// ifMatchVersion reads the version of a todo required by the If-Match header, which is zero when there is no header
+// or it matches any version. It responds with 412 Precondition Failed when the header can't match a single version.
+func ifMatchVersion(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return 0, true
+	}
+	var todoID uint
+	var version int
+	_, err := fmt.Sscanf(header, `"%d-%d"`, &todoID, &version)
+	if err != nil || version <= 0 || header != fmt.Sprintf(`"%d-%d"`, todoID, version) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"status":  http.StatusPreconditionFailed,
+			"message": "If-Match must be a single entity tag from a todo's ETag header",
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+// notModified reports whether the If-None-Match header matches an entity tag, so that the client's copy is still current
+func notModified(c *gin.Context, etag string) bool {
+	for _, tag := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireIfMatch returns a function which, when required, refuses requests to change a todo without an If-Match header,
+// so that clients can't overwrite changes they haven't seen
+func RequireIfMatch(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if required && len(c.GetHeader("If-Match")) == 0 {
+			c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+				"status":  http.StatusPreconditionRequired,
+				"message": "If-Match header is required, use the ETag of the todo",
+			})
+		}
+	}
+}
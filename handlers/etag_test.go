@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// mockVersioned holds a single todo at version 3
+type mockVersioned struct{}
+
+func (db mockVersioned) GetTodo(todoID, userID uint) (*Todo, error) {
+	return &Todo{ID: todoID, UserID: userID, Version: 3}, nil
+}
+
+func (db mockVersioned) UpdateTodo(t Todo) (*Todo, error) {
+	if t.Version != 0 && t.Version != 3 {
+		return nil, models.ErrorVersionMismatch
+	}
+	t.Version = 4
+	return &t, nil
+}
+
+func TestGetTodoNotModified(t *testing.T) {
+	t.Log(`Should respond not modified when the client's copy of a todo is current`)
+	gin.SetMode(gin.TestMode)
+	etag := todoETag(&Todo{ID: 1, UserID: 1, Version: 3})
+	tests := []struct {
+		ifNoneMatch  string
+		expectedCode int
+	}{
+		{``, http.StatusOK},
+		{etag, http.StatusNotModified},
+		{`W/` + etag, http.StatusNotModified},
+		{`"1-2", ` + etag, http.StatusNotModified},
+		{`*`, http.StatusNotModified},
+		{`"1-2"`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("If-None-Match", test.ifNoneMatch)
+		mockContext.Request = req
+		GetTodo(mockVersioned{})(mockContext)
+		mockContext.Writer.WriteHeaderNow()
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.ifNoneMatch, test.expectedCode, recorder.Code)
+		}
+		if header := recorder.Header().Get("ETag"); header != etag {
+			t.Errorf("Expected ETag %s but received %s", etag, header)
+		}
+	}
+}
+
+func TestTodoETag(t *testing.T) {
+	t.Log(`Should make the ETag of a todo from its id and version, whatever else the response holds`)
+	todo := Todo{ID: 1, UserID: 1, Version: 3}
+	full := todo
+	full.Tags = []Tag{{Name: "groceries"}}
+	full.Subtasks = []*Todo{{ID: 2, IsDone: true}}
+
+	if etag := todoETag(&todo); etag != `"1-3"` || todoETag(&full) != etag {
+		t.Errorf(`Expected the ETag "1-3" but received %s and %s`, etag, todoETag(&full))
+	}
+}
+
+func TestUpdateTodoIfMatch(t *testing.T) {
+	t.Log(`Should only update a todo when If-Match holds its current ETag`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		ifMatch      string
+		expectedCode int
+	}{
+		{``, http.StatusOK},
+		{`*`, http.StatusOK},
+		{`"1-3"`, http.StatusOK},
+		{todoETag(&Todo{ID: 1, UserID: 1, Version: 3}), http.StatusOK},
+		{`"1-2"`, http.StatusPreconditionFailed},
+		{`"3"`, http.StatusPreconditionFailed},
+		{`"1-3-0123456789abcdef"`, http.StatusPreconditionFailed},
+		{`W/"1-3"`, http.StatusPreconditionFailed},
+		{`"1-2", "1-3"`, http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+		req, _ := http.NewRequest("PUT", "http://example.com/",
+			bytes.NewBuffer([]byte(`{"title": "test title","note": "test note"}`)))
+		req.Header.Set("If-Match", test.ifMatch)
+		mockContext.Request = req
+		UpdateTodo(mockVersioned{})(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.ifMatch, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+		if etag := recorder.Header().Get("ETag"); recorder.Code == http.StatusOK && etag != `"1-4"` {
+			t.Errorf("Expected the ETag of version 4 but received %s", etag)
+		}
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	t.Log(`Should refuse changes without If-Match only when it is required`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		required     bool
+		ifMatch      string
+		expectedCode int
+	}{
+		{false, ``, http.StatusOK},
+		{true, ``, http.StatusPreconditionRequired},
+		{true, `"3"`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		req, _ := http.NewRequest("DELETE", "http://example.com/", nil)
+		req.Header.Set("If-Match", test.ifMatch)
+		mockContext.Request = req
+		RequireIfMatch(test.required)(mockContext)
+		mockContext.Writer.WriteHeaderNow()
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%v %s: expected status code %d but received %d", test.required, test.ifMatch, test.expectedCode, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"time"
+)
+
+const (
+	publisherKey      = "publisher"
+	eventsRetry       = 3 * time.Second  // how long clients wait before reconnecting
+	eventsKeepAlive   = 30 * time.Second // how often a comment is sent, so that idle connections aren't closed by proxies
+	lastEventIDHeader = "Last-Event-ID"
+)
+
+// PublishEvents is middleware which lets the handlers after it publish changes to todos
+func PublishEvents(p events.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(publisherKey, p)
+		c.Next()
+	}
+}
+
+// publish tells anyone who can see a todo that the current User has changed it, if there's a publisher to tell them.
+// The todo is included when it's known, so that clients needn't fetch it, along with the creation of its next
+// occurrence if the change completed a recurring todo.
+func publish(c *gin.Context, eventType string, todoID uint, todo *Todo) {
+	p, ok := c.Get(publisherKey)
+	if !ok {
+		return
+	}
+	publisher, ok := p.(events.Publisher)
+	if !ok {
+		return
+	}
+	value, _ := c.Get("userID")
+	userID, ok := value.(uint)
+	if !ok {
+		return
+	}
+	e := events.Event{Type: eventType, TodoID: todoID, ActorID: userID}
+	if todo != nil {
+		e.Todo = todo.Serialize()
+	}
+	publisher.Publish(e)
+	if todo != nil && todo.NextOccurrence != nil {
+		publisher.Publish(events.Event{Type: events.Created, TodoID: todo.NextOccurrence.ID, ActorID: userID,
+			Todo: todo.NextOccurrence.Serialize()})
+	}
+}
+
+// patchEventType is the type of event for a patch, which completes the todo if it marks it as done
+func patchEventType(patch models.TodoPatch) string {
+	if patch.IsDone != nil && *patch.IsDone {
+		return events.Completed
+	}
+	return events.Updated
+}
+
+// batchEventType is the type of event for an operation in a batch
+func batchEventType(op models.BatchOperation) string {
+	switch op.Action {
+	case models.BatchCreate:
+		return events.Created
+	case models.BatchComplete:
+		return events.Completed
+	case models.BatchDelete:
+		return events.Deleted
+	case models.BatchUpdate:
+		return patchEventType(op.Patch)
+	}
+	return events.Updated
+}
+
+// Subscriber is where the events for a user are received from
+type Subscriber interface {
+	Subscribe(userID uint, lastEventID string) (*events.Subscription, []events.Event)
+	Unsubscribe(s *events.Subscription)
+}
+
+// writeEvent writes an event in the text/event-stream format
+func writeEvent(c *gin.Context, e events.Event) error {
+	data, err := json.Marshal(e.Data())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// StreamEvents returns a function which handles requests for a stream of server-sent events about changes to the
+// current User's todos and those shared with them. A client which reconnects with the `Last-Event-ID` header, or the
+// `lastEventId` query param, is sent the events it missed, or a reset event if they are no longer known.
+func StreamEvents(hub Subscriber) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		lastEventID := c.GetHeader(lastEventIDHeader)
+		if len(lastEventID) == 0 {
+			lastEventID = c.Query("lastEventId")
+		}
+
+		subscription, missed := hub.Subscribe(userID, lastEventID)
+		defer hub.Unsubscribe(subscription)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // stop nginx from holding on to events
+		c.Status(http.StatusOK)
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", eventsRetry/time.Millisecond)
+		for _, e := range missed {
+			if err := writeEvent(c, e); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case e, ok := <-subscription.Events():
+				if !ok {
+					// dropped for falling behind, the client will reconnect and resume
+					return
+				}
+				if err := writeEvent(c, e); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+					return
+				}
+			}
+			c.Writer.Flush()
+		}
+	}
+}
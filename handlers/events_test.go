@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockPublisher struct {
+	events []events.Event
+}
+
+func (p *mockPublisher) Publish(e events.Event) {
+	p.events = append(p.events, e)
+}
+
+type mockRecurring struct{}
+
+func (db mockRecurring) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	return &Todo{ID: todoID, UserID: userID, IsDone: true, NextOccurrence: &Todo{ID: todoID + 1, UserID: userID}}, nil
+}
+
+func TestPublishEvents(t *testing.T) {
+	t.Log("Should publish an event when a todo is changed successfully, but not when it fails")
+	gin.SetMode(gin.TestMode)
+	publisher := &mockPublisher{}
+	tests := []struct {
+		handler gin.HandlerFunc
+		todoID  string
+	}{
+		{RestoreTodo(mockTrash{}), "4"},
+		{RestoreTodo(mockTrash{errorNotTodo}), "5"},
+		{MarkTodoAsComplete(mockRecurring{}), "6"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(recorder)
+		engine.Use(func(c *gin.Context) { c.Set("userID", uint(1)) }, PublishEvents(publisher))
+		engine.POST("/:id", test.handler)
+		req, _ := http.NewRequest("POST", "/"+test.todoID, nil)
+		engine.ServeHTTP(recorder, req)
+	}
+
+	t.Log("Should publish the creation of the next occurrence of a completed recurring todo")
+	expected := []events.Event{
+		{Type: events.Created, TodoID: 4, ActorID: 1},
+		{Type: events.Completed, TodoID: 6, ActorID: 1},
+		{Type: events.Created, TodoID: 7, ActorID: 1},
+	}
+	if len(publisher.events) != len(expected) {
+		t.Fatalf("Expected %d events but received %+v", len(expected), publisher.events)
+	}
+	for i, e := range publisher.events {
+		if e.Type != expected[i].Type || e.TodoID != expected[i].TodoID || e.ActorID != expected[i].ActorID {
+			t.Errorf("Expected %+v but received %+v", expected[i], e)
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	t.Log("Should send the events missed since the last event id, or a reset when they're unknown")
+	gin.SetMode(gin.TestMode)
+	hub := events.NewHub(nil, 10, 10)
+	subscription, _ := hub.Subscribe(1, "")
+	hub.Publish(events.Event{Type: events.Created, TodoID: 1, ActorID: 1})
+	hub.Publish(events.Event{Type: events.Deleted, TodoID: 2, ActorID: 2})
+	hub.Publish(events.Event{Type: events.Completed, TodoID: 3, ActorID: 1})
+	first := <-subscription.Events()
+	<-subscription.Events() // the hub delivers events in order, so every event is known once the last has arrived
+	hub.Unsubscribe(subscription)
+
+	tests := []struct {
+		lastEventID string
+		expected    []string
+		unexpected  []string
+	}{
+		{first.ID, []string{"event: completed", `"todoId":3`}, []string{"event: created", "event: deleted"}},
+		{"unknown-1", []string{"event: reset"}, []string{"event: completed"}},
+		{"", []string{"retry: 3000"}, []string{"event:"}},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(recorder)
+		engine.Use(func(c *gin.Context) { c.Set("userID", uint(1)) })
+		engine.GET("/events", StreamEvents(hub))
+
+		// the client has already gone, so the stream ends once the missed events are sent
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, _ := http.NewRequest("GET", "/events", nil)
+		req.Header.Set("Last-Event-ID", test.lastEventID)
+		engine.ServeHTTP(recorder, req.WithContext(ctx))
+
+		body := recorder.Body.String()
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "text/event-stream" {
+			t.Errorf("%s: expected an event stream but received %d %s", test.lastEventID, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		for _, s := range test.expected {
+			if !strings.Contains(body, s) {
+				t.Errorf("%s: expected %q in %q", test.lastEventID, s, body)
+			}
+		}
+		for _, s := range test.unexpected {
+			if strings.Contains(body, s) {
+				t.Errorf("%s: unexpected %q in %q", test.lastEventID, s, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBExportTodos represents the part of the datalayer responsible for reading all of a user's todos
+type DBExportTodos interface {
+	ExportTodos(userID uint, each func(*Todo) error) error
+}
+
+// todoExporter writes todos in one of the export formats. begin is always called before any todos are written,
+// and end after them all unless exporting failed.
+type todoExporter interface {
+	begin() error
+	write(t *Todo) error
+	end() error
+}
+
+// exportFormats maps the formats accepted by the export endpoint onto their content types & exporters
+var exportFormats = map[string]struct {
+	contentType string
+	exporter    func(w io.Writer) todoExporter
+}{
+	"json": {"application/json; charset=utf-8", func(w io.Writer) todoExporter { return &jsonExporter{w: w} }},
+	"csv":  {"text/csv; charset=utf-8", func(w io.Writer) todoExporter { return &csvExporter{w: csv.NewWriter(w)} }},
+	"md":   {"text/markdown; charset=utf-8", func(w io.Writer) todoExporter { return &markdownExporter{w: w} }},
+}
+
+// jsonExporter writes todos as a JSON array, serialized as they are by the rest of the API
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExporter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExporter) write(t *Todo) error {
+	data, err := json.Marshal(t.Serialize())
+	if err != nil {
+		return err
+	}
+	separator := "\n"
+	if e.count > 0 {
+		separator = ",\n"
+	}
+	e.count++
+	if _, err = io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExporter) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+// csvHeader names the columns of a CSV export
+var csvHeader = []string{"id", "title", "note", "isDone", "completedAt", "dueAt", "priority", "recurrence",
+	"parentId", "listId", "tags", "createdAt", "modifiedAt"}
+
+// csvExporter writes todos as CSV with a header row, with multiple tags separated by commas
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvExporter) write(t *Todo) error {
+	formatTime := func(valid bool, tm time.Time) string {
+		if !valid {
+			return ""
+		}
+		return tm.Format(time.RFC3339)
+	}
+	formatID := func(valid bool, id int64) string {
+		if !valid {
+			return ""
+		}
+		return strconv.FormatInt(id, 10)
+	}
+	tags := make([]string, len(t.Tags))
+	for i, tag := range t.Tags {
+		tags[i] = tag.Name
+	}
+
+	err := e.w.Write([]string{
+		strconv.FormatUint(uint64(t.ID), 10),
+		t.Title.String,
+		t.Note.String,
+		strconv.FormatBool(t.IsDone),
+		formatTime(t.CompletedAt.Valid, t.CompletedAt.Time),
+		formatTime(t.DueAt.Valid, t.DueAt.Time),
+		t.Priority.String(),
+		t.Recurrence.String,
+		formatID(t.ParentID.Valid, t.ParentID.Int64),
+		formatID(t.ListID.Valid, t.ListID.Int64),
+		strings.Join(tags, ","),
+		formatTime(true, t.CreatedAt),
+		formatTime(true, t.ModifiedAt),
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush() // stream each row rather than buffering the whole export
+	return e.w.Error()
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// markdownExporter writes todos as a GitHub style checklist, with each todo's details after its title
+// and its note indented beneath it
+type markdownExporter struct {
+	w io.Writer
+}
+
+func (e *markdownExporter) begin() error {
+	_, err := io.WriteString(e.w, "# Todos\n\n")
+	return err
+}
+
+func (e *markdownExporter) write(t *Todo) error {
+	var line strings.Builder
+	if t.IsDone {
+		line.WriteString("- [x] ")
+	} else {
+		line.WriteString("- [ ] ")
+	}
+	title := t.Title.String
+	if len(title) == 0 {
+		title = "(untitled)"
+	}
+	line.WriteString(strings.Join(strings.Fields(title), " "))
+	if t.DueAt.Valid {
+		line.WriteString(" · due " + t.DueAt.Time.Format("2006-01-02"))
+	}
+	if t.Priority != models.PriorityNone {
+		line.WriteString(" · " + t.Priority.String() + " priority")
+	}
+	for _, tag := range t.Tags {
+		line.WriteString(" #" + strings.Join(strings.Fields(tag.Name), "-"))
+	}
+	line.WriteString("\n")
+	if len(t.Note.String) > 0 {
+		for _, noteLine := range strings.Split(strings.TrimRight(t.Note.String, "\n"), "\n") {
+			line.WriteString("  " + noteLine + "\n")
+		}
+	}
+	_, err := io.WriteString(e.w, line.String())
+	return err
+}
+
+func (e *markdownExporter) end() error {
+	return nil
+}
+
+// ExportTodos returns a function which handles requests to download all of the current User's todos,
+// streaming them as JSON, CSV or a Markdown checklist according to the `format` query param
+func ExportTodos(db DBExportTodos) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		name := c.Query("format")
+		if len(name) == 0 {
+			name = "json"
+		}
+		format, ok := exportFormats[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "`format` query param must be json, csv or md",
+			})
+			return
+		}
+
+		// the response is only started once the first todos have been read,
+		// so that an error reading them can still be reported
+		exporter := format.exporter(c.Writer)
+		started := false
+		start := func() error {
+			started = true
+			c.Header("Content-Type", format.contentType)
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="todos.%s"`, name))
+			c.Status(http.StatusOK)
+			return exporter.begin()
+		}
+
+		err := db.ExportTodos(userID, func(t *Todo) error {
+			if !started {
+				if err := start(); err != nil {
+					return err
+				}
+			}
+			if err := exporter.write(t); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		})
+		if err == nil && !started {
+			err = start()
+		}
+		if err == nil {
+			err = exporter.end()
+		}
+		if err != nil && !started {
+			log.Println("Error exporting todos:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error exporting todos",
+			})
+		} else if err != nil {
+			// the response can't be changed once it has started, so the export is left incomplete
+			log.Println("Error exporting todos, the export is incomplete:\t", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockExport struct {
+	err error
+}
+
+func (db mockExport) ExportTodos(userID uint, each func(*Todo) error) error {
+	if db.err != nil {
+		return db.err
+	}
+	dueAt := time.Date(2019, time.March, 22, 17, 0, 0, 0, time.UTC)
+	todos := []*Todo{
+		{ID: 1, UserID: userID, Title: models.MakeNullString("buy milk"), Note: models.MakeNullString("semi skimmed\ntwo pints"),
+			DueAt: pq.NullTime{Time: dueAt, Valid: true}, Priority: models.PriorityHigh,
+			Tags: []Tag{{ID: 1, Name: "groceries"}, {ID: 2, Name: "shops"}}},
+		{ID: 2, UserID: userID, Title: models.MakeNullString("post letter, first class"), IsDone: true,
+			ParentID: sql.NullInt64{Int64: 1, Valid: true}},
+	}
+	for _, todo := range todos {
+		if err := each(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportTodos(t *testing.T) {
+	t.Log(`Should export all of a user's todos in the requested format`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		db           mockExport
+		format       string
+		expectedCode int
+		expected     []string
+	}{
+		{mockExport{}, "", http.StatusOK, []string{`[` + "\n" + `{"createdAt"`, `"title":"buy milk"}`, `"isDone":true`, "\n]\n"}},
+		{mockExport{}, "json", http.StatusOK, []string{`"tags":[{`}},
+		{mockExport{}, "csv", http.StatusOK, []string{
+			"id,title,note,isDone,completedAt,dueAt,priority,recurrence,parentId,listId,tags,createdAt,modifiedAt\n",
+			"1,buy milk,\"semi skimmed\ntwo pints\",false,,2019-03-22T17:00:00Z,high,,,,\"groceries,shops\",",
+			"2,\"post letter, first class\",,true,,,none,,1,,,"}},
+		{mockExport{}, "md", http.StatusOK, []string{"# Todos\n\n",
+			"- [ ] buy milk · due 2019-03-22 · high priority #groceries #shops\n  semi skimmed\n  two pints\n",
+			"- [x] post letter, first class\n"}},
+		{mockExport{}, "xml", http.StatusBadRequest, nil},
+		{mockExport{errors.New("connection refused")}, "csv", http.StatusInternalServerError, nil},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		req, _ := http.NewRequest("GET", "http://example.com/?format="+test.format, nil)
+		mockContext.Request = req
+		ExportTodos(test.db)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.format, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(recorder.Body.String(), expected) {
+				t.Errorf("%s: expected the export to contain %q but received %s", test.format, expected, recorder.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// FeedToken is a type alias for convenience
+type FeedToken = models.FeedToken
+
+// FeedStore is the datastore API for calendar feeds
+type FeedStore interface {
+	DBCreateFeedToken
+	DBRevokeFeedToken
+	DBGetFeed
+}
+
+// DBCreateFeedToken represents the part of the datalayer responsible for creating feed tokens
+type DBCreateFeedToken interface {
+	CreateFeedToken(userID uint) (*FeedToken, error)
+}
+
+// CreateFeedToken returns a function which handles requests to create a new calendar feed token for the current
+// User, revoking any they had before. The response includes the feed's url, relative to feedPath.
+func CreateFeedToken(db DBCreateFeedToken, feedPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		feedToken, err := db.CreateFeedToken(userID)
+		if err != nil {
+			log.Println("Error creating feed token:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to create feed token",
+			})
+			return
+		}
+
+		data := feedToken.Serialize()
+		data["url"] = path.Join(feedPath, feedToken.Token+".ics")
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Feed token created successfully!",
+			"data":    data,
+		})
+	}
+}
+
+// DBRevokeFeedToken represents the part of the datalayer responsible for revoking feed tokens
+type DBRevokeFeedToken interface {
+	RevokeFeedToken(userID uint) error
+}
+
+// RevokeFeedToken returns a function which handles requests to revoke the current User's calendar feed token
+func RevokeFeedToken(db DBRevokeFeedToken) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		if err := db.RevokeFeedToken(userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find feed token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Feed token revoked successfully!"})
+	}
+}
+
+// DBGetFeed represents the part of the datalayer responsible for reading a calendar feed
+type DBGetFeed interface {
+	GetFeedUser(token string) (uint, error)
+	GetDueTodos(userID uint) ([]*Todo, error)
+}
+
+// GetFeed returns a function which handles requests for the iCalendar feed of the todos with a due date belonging
+// to the owner of the `token` param. The token takes the place of the usual authorization, since calendar apps
+// can't log in. Todos are VEVENTs unless the `component` query param is `vtodo`.
+func GetFeed(db DBGetFeed) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		component := componentEvent
+		switch strings.ToLower(c.Query("component")) {
+		case "", "vevent":
+		case "vtodo":
+			component = componentTodo
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "`component` query param must be vevent or vtodo",
+			})
+			return
+		}
+
+		userID, err := db.GetFeedUser(strings.TrimSuffix(c.Param("token"), ".ics"))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find feed"})
+			return
+		}
+		var todos []*Todo
+		if err == nil {
+			todos, err = db.GetDueTodos(userID)
+		}
+		if err != nil {
+			log.Println("Error getting feed:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching feed",
+			})
+			return
+		}
+
+		var w icalWriter
+		w.beginCalendar("Todos")
+		for _, todo := range todos {
+			w.todo(&CalendarObject{Todo: todo, UID: models.DefaultTodoUID(todo.ID)}, component)
+		}
+		w.endCalendar()
+
+		c.Header("Cache-Control", "private, max-age=300")
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(w.String()))
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockFeed struct {
+	err error
+}
+
+func (db mockFeed) CreateFeedToken(userID uint) (*FeedToken, error) {
+	return &FeedToken{UserID: userID, Token: "abc123"}, db.err
+}
+
+func (db mockFeed) RevokeFeedToken(userID uint) error {
+	return db.err
+}
+
+func (db mockFeed) GetFeedUser(token string) (uint, error) {
+	if token != "abc123" {
+		return 0, sql.ErrNoRows
+	}
+	return 1, nil
+}
+
+func (db mockFeed) GetDueTodos(userID uint) ([]*Todo, error) {
+	dueAt := time.Date(2019, time.March, 22, 17, 0, 0, 0, time.UTC)
+	completedAt := time.Date(2019, time.March, 21, 9, 30, 0, 0, time.UTC)
+	return []*Todo{
+		{ID: 1, UserID: userID, Title: models.MakeNullString("buy milk; eggs, bread"), Version: 3,
+			Note: models.MakeNullString("semi skimmed\ntwo pints"), DueAt: pq.NullTime{Time: dueAt, Valid: true},
+			Priority: models.PriorityHigh, Tags: []Tag{{Name: "groceries"}, {Name: "shops"}}},
+		{ID: 2, UserID: userID, Title: models.MakeNullString("post letter"), IsDone: true,
+			DueAt: pq.NullTime{Time: dueAt, Valid: true}, CompletedAt: pq.NullTime{Time: completedAt, Valid: true}},
+	}, db.err
+}
+
+func TestGetFeed(t *testing.T) {
+	t.Log(`Should render the todos of the token's owner as iCalendar components`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		db           mockFeed
+		token        string
+		query        string
+		expectedCode int
+		expected     []string
+	}{
+		{mockFeed{}, "abc123.ics", "", http.StatusOK, []string{
+			"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+			"BEGIN:VEVENT\r\nUID:todo-1@gotodos\r\n",
+			"SEQUENCE:2\r\nSUMMARY:buy milk\\; eggs\\, bread\r\nDESCRIPTION:semi skimmed\\ntwo pints\r\nPRIORITY:3\r\n",
+			"CATEGORIES:groceries,shops\r\nDTSTART:20190322T170000Z\r\n",
+			"SUMMARY:✓ post letter\r\n",
+			"END:VCALENDAR\r\n"}},
+		{mockFeed{}, "abc123.ics", "?component=vtodo", http.StatusOK, []string{
+			"BEGIN:VTODO\r\n", "DUE:20190322T170000Z\r\nSTATUS:NEEDS-ACTION\r\n",
+			"SUMMARY:post letter\r\n", "STATUS:COMPLETED\r\nPERCENT-COMPLETE:100\r\nCOMPLETED:20190321T093000Z\r\n"}},
+		{mockFeed{}, "abc123.ics", "?component=vjournal", http.StatusBadRequest, nil},
+		{mockFeed{}, "revoked.ics", "", http.StatusNotFound, nil},
+		{mockFeed{errors.New("connection refused")}, "abc123.ics", "", http.StatusInternalServerError, nil},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Params = []gin.Param{{Key: "token", Value: test.token}}
+		mockContext.Request, _ = http.NewRequest("GET", "http://example.com/"+test.token+test.query, nil)
+		GetFeed(test.db)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s%s: expected status code %d but received %d", test.token, test.query, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(recorder.Body.String(), expected) {
+				t.Errorf("%s%s: expected the feed to contain %q but received %q", test.token, test.query, expected, recorder.Body)
+			}
+		}
+	}
+}
+
+func TestICalLineFolding(t *testing.T) {
+	t.Log(`Should fold long content lines without splitting characters`)
+	var w icalWriter
+	w.text("SUMMARY", strings.Repeat("é", 50))
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\r\n"), "\r\n ")
+	if len(lines) != 2 || len(lines[0]) > icalLineLength || strings.Join(lines, "") != "SUMMARY:"+strings.Repeat("é", 50) {
+		t.Errorf("Expected the line to be folded in two but received %q", w.String())
+	}
+
+	t.Log(`Should keep continuation lines, including their leading space, within the line length`)
+	w.Reset()
+	w.text("SUMMARY", strings.Repeat("a", 300))
+	for _, line := range strings.Split(strings.TrimSuffix(w.String(), "\r\n"), "\r\n") {
+		if len(line) > icalLineLength {
+			t.Errorf("Expected lines of at most %d bytes but received %d: %q", icalLineLength, len(line), line)
+		}
+	}
+}
+
+func TestFeedTokenHandlers(t *testing.T) {
+	t.Log(`Should create and revoke the current user's feed token`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		expectedCode int
+		expected     string
+	}{
+		{CreateFeedToken(mockFeed{}, "/api/v1/feeds"), http.StatusCreated, `"url":"/api/v1/feeds/abc123.ics"`},
+		{CreateFeedToken(mockFeed{errors.New("connection refused")}, "/api/v1/feeds"), http.StatusInternalServerError, ""},
+		{RevokeFeedToken(mockFeed{}), http.StatusOK, ""},
+		{RevokeFeedToken(mockFeed{models.ErrorRowsUnaffected}), http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("expected status code %d but received %d", test.expectedCode, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), test.expected) {
+			t.Errorf("expected the response to contain %s but received %s", test.expected, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+)
+
+// TodoEvent is a type alias for convenience
+type TodoEvent = models.TodoEvent
+
+// DBGetTodoHistory represents the part of the datalayer responsible for getting the changes made to a todo
+type DBGetTodoHistory interface {
+	GetTodoHistory(todoID, userID uint) ([]*TodoEvent, error)
+}
+
+// GetTodoHistory returns a function which handles requests for the history of a todo the current User can see
+func GetTodoHistory(db DBGetTodoHistory) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		events, err := db.GetTodoHistory(todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching history",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(events))
+		for i, item := range events {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
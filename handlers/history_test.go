@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockHistory struct {
+	err error
+}
+
+func (db mockHistory) GetTodoHistory(todoID, userID uint) ([]*TodoEvent, error) {
+	return []*TodoEvent{{ID: 1, TodoID: todoID, Action: models.EventCreated, Actor: User{ID: userID}}}, db.err
+}
+
+func TestGetTodoHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		db           mockHistory
+		todoID       string
+		expectedCode int
+	}{
+		{mockHistory{}, "5", http.StatusOK},
+		{mockHistory{}, "first", http.StatusBadRequest},
+		{mockHistory{models.ErrorRowsUnaffected}, "5", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: test.todoID}}
+		GetTodoHistory(test.db)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.todoID, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || len(response.Data) != 1 ||
+			response.Data[0]["action"] != models.EventCreated {
+			t.Errorf("Expected the created event but received %s", recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vancelongwill/gotodos/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iCalendar (RFC 5545) component types which todos can be rendered as
+const (
+	componentTodo  = "VTODO"  // a task, shown by apps with a todo list
+	componentEvent = "VEVENT" // a zero length event at the due time, shown by every calendar app
+)
+
+const (
+	icalProductID  = "-//gotodos//gotodos//EN"
+	icalTimeFormat = "20060102T150405Z"
+	icalLineLength = 75 // the longest a content line may be, in bytes, before it is folded
+)
+
+// icalPriorities maps priorities onto the iCalendar scale, where 1 is the highest, 9 the lowest and 0 undefined
+var icalPriorities = map[models.Priority]int{
+	models.PriorityUrgent: 1,
+	models.PriorityHigh:   3,
+	models.PriorityMedium: 5,
+	models.PriorityLow:    9,
+}
+
+// icalTextEscaper escapes the characters with special meaning in iCalendar TEXT values
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalWriter builds an iCalendar object a content line at a time
+type icalWriter struct {
+	strings.Builder
+	// sync writes each todo's recurrence and parent too, for clients which edit todos rather than only show them
+	sync bool
+}
+
+// line writes a content line, folding it onto continuation lines without splitting a UTF-8 sequence
+func (w *icalWriter) line(name, value string) {
+	line := name + ":" + value
+	limit := icalLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards their length
+		limit = icalLineLength - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// text writes a content line with a TEXT value
+func (w *icalWriter) text(name, value string) {
+	w.line(name, icalTextEscaper.Replace(value))
+}
+
+// time writes a content line with a UTC DATE-TIME value
+func (w *icalWriter) time(name string, t time.Time) {
+	w.line(name, t.UTC().Format(icalTimeFormat))
+}
+
+// beginCalendar starts an iCalendar object, which may hold many components
+func (w *icalWriter) beginCalendar(name string) {
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", icalProductID)
+	w.line("CALSCALE", "GREGORIAN")
+	if len(name) > 0 {
+		w.text("X-WR-CALNAME", name)
+	}
+}
+
+func (w *icalWriter) endCalendar() {
+	w.line("END", "VCALENDAR")
+}
+
+// todo writes a todo as a VTODO or VEVENT component. Recurrence is only included when syncing, since otherwise
+// each occurrence of a recurring todo would be shown twice: once as a todo of its own, created when the one before it
+// is completed, and again as a recurrence of the one before it.
+// Events have no completion state, so the summary of a done todo's event is marked with a tick instead.
+func (w *icalWriter) todo(o *CalendarObject, component string) {
+	t := o.Todo
+	w.line("BEGIN", component)
+	w.text("UID", o.UID)
+	w.time("DTSTAMP", t.ModifiedAt)
+	w.time("CREATED", t.CreatedAt)
+	w.time("LAST-MODIFIED", t.ModifiedAt)
+	if t.Version > 0 {
+		w.line("SEQUENCE", fmt.Sprint(t.Version-1))
+	}
+
+	summary := t.Title.String
+	if component == componentEvent && t.IsDone {
+		summary = "✓ " + summary
+	}
+	w.text("SUMMARY", summary)
+	if len(t.Note.String) > 0 {
+		w.text("DESCRIPTION", t.Note.String)
+	}
+	if priority, ok := icalPriorities[t.Priority]; ok {
+		w.line("PRIORITY", fmt.Sprint(priority))
+	}
+	if w.sync && t.Recurrence.Valid {
+		w.line("RRULE", t.Recurrence.String)
+	}
+	if w.sync && o.ParentUID.Valid {
+		w.text("RELATED-TO;RELTYPE=PARENT", o.ParentUID.String)
+	}
+	if len(t.Tags) > 0 {
+		categories := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			categories[i] = icalTextEscaper.Replace(tag.Name)
+		}
+		w.line("CATEGORIES", strings.Join(categories, ","))
+	}
+
+	if component == componentEvent {
+		if t.DueAt.Valid {
+			w.time("DTSTART", t.DueAt.Time)
+		}
+		w.line("TRANSP", "TRANSPARENT") // deadlines don't make anyone busy
+	} else {
+		if t.DueAt.Valid {
+			w.time("DUE", t.DueAt.Time)
+		}
+		if t.IsDone {
+			w.line("STATUS", "COMPLETED")
+			w.line("PERCENT-COMPLETE", "100")
+		} else {
+			w.line("STATUS", "NEEDS-ACTION")
+		}
+		if t.CompletedAt.Valid {
+			w.time("COMPLETED", t.CompletedAt.Time)
+		}
+	}
+	w.line("END", component)
+}
+
+// icalProperty is a content line of an iCalendar object, such as `DUE;TZID=Europe/London:20190322T170000`
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Errors
+var (
+	errorNotCalendar  = errors.New("iCalendar object must be a VCALENDAR")
+	errorNotTodo      = errors.New("iCalendar object must contain a single VTODO")
+	errorMissingUID   = errors.New("VTODO must have a UID")
+	errorInvalidValue = errors.New("iCalendar property has an invalid value")
+)
+
+// parseICalendar reads the content lines of an iCalendar object, unfolding any which were folded
+func parseICalendar(data []byte) ([]icalProperty, error) {
+	unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(string(data))
+	var properties []icalProperty
+	for _, line := range strings.Split(unfolded, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		// the value starts at the first colon which isn't in a quoted parameter value
+		quoted, colon := false, -1
+		for i := 0; i < len(line) && colon < 0; i++ {
+			if line[i] == '"' {
+				quoted = !quoted
+			} else if line[i] == ':' && !quoted {
+				colon = i
+			}
+		}
+		if colon <= 0 {
+			return nil, errorNotCalendar
+		}
+
+		parts := strings.Split(line[:colon], ";")
+		property := icalProperty{name: strings.ToUpper(parts[0]), params: make(map[string]string), value: line[colon+1:]}
+		for _, param := range parts[1:] {
+			if equals := strings.Index(param, "="); equals > 0 {
+				property.params[strings.ToUpper(param[:equals])] = strings.Trim(param[equals+1:], `"`)
+			}
+		}
+		properties = append(properties, property)
+	}
+	if len(properties) == 0 || properties[0].name != "BEGIN" || properties[0].value != "VCALENDAR" {
+		return nil, errorNotCalendar
+	}
+	return properties, nil
+}
+
+// unescapeICalText reverses icalTextEscaper, splitting the value at any unescaped separator
+func unescapeICalText(value string, separator byte) []string {
+	var values []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			i++
+			if value[i] == 'n' || value[i] == 'N' {
+				current.WriteByte('\n')
+			} else {
+				current.WriteByte(value[i])
+			}
+		case value[i] == separator:
+			values = append(values, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(values, current.String())
+}
+
+// parseICalTime reads a DATE or DATE-TIME value, in UTC, the time zone of its TZID parameter, or otherwise UTC
+func parseICalTime(p icalProperty) (time.Time, error) {
+	if p.params["VALUE"] == "DATE" || len(p.value) == len("20060102") {
+		return time.Parse("20060102", p.value)
+	}
+	if strings.HasSuffix(p.value, "Z") {
+		return time.Parse(icalTimeFormat, p.value)
+	}
+	location := time.UTC
+	if tzid, ok := p.params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			location = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", p.value, location)
+	return t.UTC(), err
+}
+
+// icalPriority converts an iCalendar priority into a Priority
+func icalPriority(value int) models.Priority {
+	switch {
+	case value <= 0:
+		return models.PriorityNone
+	case value == 1:
+		return models.PriorityUrgent
+	case value <= 4:
+		return models.PriorityHigh
+	case value == 5:
+		return models.PriorityMedium
+	}
+	return models.PriorityLow
+}
+
+// parseVTodo reads the todo in an iCalendar object holding a single VTODO, ignoring any properties which todos
+// don't have, as well as nested components such as alarms and overrides of single occurrences of the todo.
+func parseVTodo(data []byte) (*CalendarObject, error) {
+	properties, err := parseICalendar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo *Todo
+	var components []string
+	o := &CalendarObject{}
+	found, override := false, false
+	for _, p := range properties {
+		switch p.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(p.value))
+			if len(components) == 2 && components[1] == componentTodo {
+				if found {
+					override = true
+				} else {
+					found, todo = true, &Todo{}
+				}
+			}
+			continue
+		case "END":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
+			}
+			if len(components) == 1 && override {
+				override = false
+			}
+			continue
+		}
+		if len(components) != 2 || components[1] != componentTodo || override {
+			continue
+		}
+
+		switch p.name {
+		case "UID":
+			o.UID = p.value
+		case "RECURRENCE-ID":
+			return nil, errorNotTodo
+		case "SUMMARY":
+			todo.Title = models.MakeNullString(strings.Join(unescapeICalText(p.value, 0), ""))
+		case "DESCRIPTION":
+			todo.Note = models.MakeNullString(strings.Join(unescapeICalText(p.value, 0), ""))
+		case "STATUS":
+			todo.IsDone = todo.IsDone || strings.ToUpper(p.value) == "COMPLETED"
+		case "COMPLETED":
+			completedAt, err := parseICalTime(p)
+			if err != nil {
+				return nil, errorInvalidValue
+			}
+			todo.IsDone, todo.CompletedAt = true, models.MakeNullTime(&completedAt)
+		case "DUE":
+			dueAt, err := parseICalTime(p)
+			if err != nil {
+				return nil, errorInvalidValue
+			}
+			todo.DueAt = models.MakeNullTime(&dueAt)
+		case "PRIORITY":
+			priority, err := strconv.Atoi(p.value)
+			if err != nil {
+				return nil, errorInvalidValue
+			}
+			todo.Priority = icalPriority(priority)
+		case "RRULE":
+			if todo.Recurrence, err = models.NormalizeRecurrence(&p.value); err != nil {
+				return nil, err
+			}
+		case "CATEGORIES":
+			for _, name := range unescapeICalText(p.value, ',') {
+				if name = strings.TrimSpace(name); len(name) > 0 && len(name) <= maxTagLength {
+					todo.Tags = append(todo.Tags, Tag{Name: name})
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, errorNotTodo
+	}
+	if len(o.UID) == 0 {
+		return nil, errorMissingUID
+	}
+	o.Todo = todo
+	return o, nil
+}
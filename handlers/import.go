@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"github.com/vancelongwill/gotodos/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxImportSize  = 5 << 20 // the largest import accepted, in bytes
+	maxImportTodos = 1000    // the most todos a single import may create
+	maxTagLength   = 50      // the longest tag name the database accepts
+)
+
+// DBImportTodos represents the part of the datalayer responsible for creating many todos at once
+type DBImportTodos interface {
+	ImportTodos(userID uint, todos []*Todo, dryRun bool) ([]models.ImportResult, error)
+}
+
+// importFormats maps the formats accepted by the import endpoint onto their parsers
+var importFormats = map[string]func(data []byte) ([]*Todo, error){
+	"json":    parseJSONImport,
+	"csv":     parseCSVImport,
+	"md":      parseMarkdownImport,
+	"todotxt": parseTodoTxtImport,
+}
+
+// importedTodo makes a todo from the fields common to every import format, checking that it isn't empty
+func importedTodo(title, note string, tags []string) (*Todo, error) {
+	title, note = strings.TrimSpace(title), strings.TrimSpace(note)
+	if len(title) == 0 && len(note) == 0 {
+		return nil, models.ErrorEmptyTodo
+	}
+	todo := &Todo{Title: models.MakeNullString(title), Note: models.MakeNullString(note)}
+	for _, name := range tags {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag `%s` is longer than %d characters", name, maxTagLength)
+		}
+		todo.Tags = append(todo.Tags, Tag{Name: name})
+	}
+	return todo, nil
+}
+
+// parseImportTime reads an optional RFC 3339 timestamp or date
+func parseImportTime(value string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("`%s` must be an RFC 3339 timestamp or a date", value)
+}
+
+// parseJSONImport reads a JSON array of todos, as exported with format=json
+func parseJSONImport(data []byte) ([]*Todo, error) {
+	var items []struct {
+		Title       string            `json:"title"`
+		Note        string            `json:"note"`
+		IsDone      bool              `json:"isDone"`
+		CompletedAt *time.Time        `json:"completedAt"`
+		DueAt       *time.Time        `json:"dueAt"`
+		Priority    *string           `json:"priority"`
+		Recurrence  *string           `json:"recurrence"`
+		Tags        []json.RawMessage `json:"tags"` // tag names, or tags as they are serialized
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("JSON imports must be an array of todos")
+	}
+
+	todos := make([]*Todo, len(items))
+	for i, item := range items {
+		names := make([]string, len(item.Tags))
+		for j, tag := range item.Tags {
+			var serialized struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(tag, &names[j]) != nil && json.Unmarshal(tag, &serialized) != nil {
+				return nil, fmt.Errorf("todo %d: `tags` must be tag names or tags", i)
+			}
+			if len(serialized.Name) > 0 {
+				names[j] = serialized.Name
+			}
+		}
+
+		todo, err := importedTodo(item.Title, item.Note, names)
+		if err == nil {
+			todo.Priority, err = models.NormalizePriority(item.Priority)
+		}
+		if err == nil {
+			todo.Recurrence, err = models.NormalizeRecurrence(item.Recurrence)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("todo %d: %s", i, err.Error())
+		}
+		todo.IsDone = item.IsDone
+		todo.DueAt = models.MakeNullTime(item.DueAt)
+		todo.CompletedAt = models.MakeNullTime(item.CompletedAt)
+		todos[i] = todo
+	}
+	return todos, nil
+}
+
+// parseCSVImport reads CSV with a header row naming its columns, as exported with format=csv.
+// Only the title or note column is required, and unknown columns are ignored.
+func parseCSVImport(data []byte) ([]*Todo, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV imports must start with a header row")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	_, hasTitle := columns["title"]
+	_, hasNote := columns["note"]
+	if !hasTitle && !hasNote {
+		return nil, fmt.Errorf("CSV imports must have a title or note column")
+	}
+
+	todos := make([]*Todo, 0)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return todos, nil
+		} else if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var tags []string
+		if len(field("tags")) > 0 {
+			tags = strings.Split(field("tags"), ",")
+		}
+		todo, err := importedTodo(field("title"), field("note"), tags)
+		if err == nil && len(field("isDone")) > 0 {
+			todo.IsDone, err = strconv.ParseBool(field("isDone"))
+		}
+		var dueAt, completedAt *time.Time
+		if err == nil {
+			dueAt, err = parseImportTime(field("dueAt"))
+		}
+		if err == nil {
+			completedAt, err = parseImportTime(field("completedAt"))
+		}
+		if priority := field("priority"); err == nil {
+			todo.Priority, err = models.NormalizePriority(&priority)
+		}
+		if recurrence := field("recurrence"); err == nil && len(recurrence) > 0 {
+			todo.Recurrence, err = models.NormalizeRecurrence(&recurrence)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", row, err.Error())
+		}
+		todo.DueAt = models.MakeNullTime(dueAt)
+		todo.CompletedAt = models.MakeNullTime(completedAt)
+		todos = append(todos, todo)
+	}
+}
+
+// markdownItem matches an item of a GitHub style checklist
+var markdownItem = regexp.MustCompile(`^\s*[-*+] \[([ xX])\] (.*)$`)
+
+// parseMarkdownImport reads a GitHub style checklist, as exported with format=md. Each item may be followed by
+// details separated by " · ", such as "due 2019-03-22" or "high priority", and #tags, and the indented lines
+// beneath an item are its note. Any other lines are ignored.
+func parseMarkdownImport(data []byte) ([]*Todo, error) {
+	todos := make([]*Todo, 0)
+	var current *Todo
+	var note []string
+	finish := func() {
+		if current != nil && len(note) > 0 {
+			current.Note = models.MakeNullString(strings.TrimSpace(strings.Join(note, "\n")))
+		}
+		current, note = nil, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		match := markdownItem.FindStringSubmatch(text)
+		if match == nil {
+			if current != nil && len(text) > 0 && (text[0] == ' ' || text[0] == '\t') {
+				note = append(note, strings.TrimPrefix(strings.TrimPrefix(text, "  "), "\t"))
+			} else {
+				finish()
+			}
+			continue
+		}
+		finish()
+
+		segments := strings.Split(match[2], " · ")
+		var tags []string
+		last := strings.Fields(segments[len(segments)-1])
+		for len(last) > 0 && len(last[len(last)-1]) > 1 && strings.HasPrefix(last[len(last)-1], "#") {
+			tags = append([]string{last[len(last)-1][1:]}, tags...)
+			last = last[:len(last)-1]
+		}
+		segments[len(segments)-1] = strings.Join(last, " ")
+
+		title := []string{segments[0]}
+		var dueAt *time.Time
+		var priority models.Priority
+		var err error
+		for _, segment := range segments[1:] {
+			if strings.HasPrefix(segment, "due ") {
+				dueAt, err = parseImportTime(strings.TrimPrefix(segment, "due "))
+			} else if name := strings.TrimSuffix(segment, " priority"); name != segment {
+				priority, err = models.ParsePriority(name)
+			} else if len(segment) > 0 {
+				title = append(title, segment)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+		}
+
+		todo, err := importedTodo(strings.Join(title, " · "), "", tags)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		todo.IsDone = match[1] != " "
+		todo.DueAt = models.MakeNullTime(dueAt)
+		todo.Priority = priority
+		todos = append(todos, todo)
+		current = todo
+	}
+	finish()
+	return todos, scanner.Err()
+}
+
+// todoTxtPriorities maps todo.txt priorities onto ours, with every priority after C being low
+var todoTxtPriorities = map[string]models.Priority{
+	"A": models.PriorityUrgent,
+	"B": models.PriorityHigh,
+	"C": models.PriorityMedium,
+}
+
+// todoTxtPriority matches a todo.txt priority such as (A)
+var todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+// parseTodoTxtPriority converts a todo.txt priority letter into a Priority
+func parseTodoTxtPriority(letter string) models.Priority {
+	if priority, ok := todoTxtPriorities[letter]; ok {
+		return priority
+	}
+	return models.PriorityLow
+}
+
+// parseTodoTxtImport reads the todo.txt format (https://github.com/todotxt/todo.txt), with one todo per line.
+// Projects (+project) and contexts (@context) become tags, and the due: and pri: extensions are understood.
+func parseTodoTxtImport(data []byte) ([]*Todo, error) {
+	todos := make([]*Todo, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		isDone := fields[0] == "x"
+		var completedAt, dueAt *time.Time
+		var priority models.Priority
+		if isDone {
+			fields = fields[1:]
+			if len(fields) > 0 {
+				if t, err := time.Parse("2006-01-02", fields[0]); err == nil {
+					completedAt, fields = &t, fields[1:]
+				}
+			}
+		} else if match := todoTxtPriority.FindStringSubmatch(fields[0]); match != nil {
+			priority, fields = parseTodoTxtPriority(match[1]), fields[1:]
+		}
+		if len(fields) > 0 {
+			if _, err := time.Parse("2006-01-02", fields[0]); err == nil {
+				fields = fields[1:] // the creation date, which the new todo is given afresh
+			}
+		}
+
+		var title, tags []string
+		var err error
+		for _, field := range fields {
+			switch {
+			case len(field) > 1 && (field[0] == '+' || field[0] == '@'):
+				tags = append(tags, field[1:])
+			case strings.HasPrefix(field, "due:"):
+				dueAt, err = parseImportTime(strings.TrimPrefix(field, "due:"))
+			case strings.HasPrefix(field, "pri:") && len(field) == 5:
+				priority = parseTodoTxtPriority(strings.ToUpper(field[4:]))
+			default:
+				title = append(title, field)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err.Error())
+			}
+		}
+
+		todo, err := importedTodo(strings.Join(title, " "), "", tags)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		todo.IsDone = isDone
+		todo.CompletedAt = models.MakeNullTime(completedAt)
+		todo.DueAt = models.MakeNullTime(dueAt)
+		todo.Priority = priority
+		todos = append(todos, todo)
+	}
+	return todos, scanner.Err()
+}
+
+// ImportTodos returns a function which handles requests to create many todos for the current User from the body,
+// in the format given by the `format` query param. With `dryRun=true` nothing is created, and the response
+// reports what would have been.
+func ImportTodos(db DBImportTodos) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		name := c.Query("format")
+		if len(name) == 0 {
+			name = "json"
+		}
+		parse, ok := importFormats[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "`format` query param must be json, csv, md or todotxt",
+			})
+			return
+		}
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "`dryRun` query param must be true or false",
+			})
+			return
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+		if err != nil && strings.Contains(err.Error(), "request body too large") {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status":  http.StatusRequestEntityTooLarge,
+				"message": fmt.Sprintf("Imports may be at most %d bytes", maxImportSize),
+			})
+			return
+		}
+		var todos []*Todo
+		if err == nil {
+			todos, err = parse(data)
+		}
+		if err == nil && (len(todos) == 0 || len(todos) > maxImportTodos) {
+			err = fmt.Errorf("an import must contain between 1 and %d todos", maxImportTodos)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+
+		results, err := db.ImportTodos(userID, todos, dryRun)
+		if err != nil {
+			log.Println("Error importing todos:\t", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to import todos",
+			})
+			return
+		}
+
+		created, duplicates := 0, 0
+		items := make([]map[string]interface{}, len(results))
+		for i, result := range results {
+			todo := result.Todo.Serialize()
+			status := "created"
+			if result.Duplicate {
+				status = "duplicate"
+				duplicates++
+			} else {
+				created++
+			}
+			if !dryRun && !result.Duplicate {
+				publish(c, events.Created, result.Todo.ID, result.Todo)
+			}
+			if dryRun || result.Duplicate {
+				// the todo was never created, so has no id, nor any timestamps the import didn't give it
+				delete(todo, "id")
+				delete(todo, "version")
+				if result.Todo.CreatedAt.IsZero() {
+					delete(todo, "createdAt")
+				}
+				if result.Todo.ModifiedAt.IsZero() {
+					delete(todo, "modifiedAt")
+				}
+				if tags, ok := todo["tags"].([]map[string]interface{}); ok {
+					for j, tag := range result.Todo.Tags {
+						if tag.ID == 0 {
+							// the tag would have been created along with the todo
+							tags[j] = map[string]interface{}{"name": tag.Name}
+						}
+					}
+				}
+			}
+			items[i] = map[string]interface{}{"status": status, "data": todo}
+		}
+
+		status, message := http.StatusCreated, "Todos imported successfully!"
+		if dryRun {
+			status, message = http.StatusOK, "Dry run, no todos were imported"
+		}
+		c.JSON(status, gin.H{
+			"status":  status,
+			"message": message,
+			"data":    gin.H{"created": created, "duplicates": duplicates, "todos": items},
+		})
+	}
+}
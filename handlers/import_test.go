@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockImport struct {
+	err error
+}
+
+func (db mockImport) ImportTodos(userID uint, todos []*Todo, dryRun bool) ([]models.ImportResult, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	results := make([]models.ImportResult, len(todos))
+	for i, todo := range todos {
+		todo.ID = uint(i + 1)
+		todo.UserID = userID
+		results[i] = models.ImportResult{Todo: todo, Duplicate: todo.Title.String == "duplicate"}
+	}
+	return results, nil
+}
+
+func TestImportTodos(t *testing.T) {
+	t.Log(`Should import todos from the requested format, reporting duplicates`)
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		db           mockImport
+		query        string
+		body         string
+		expectedCode int
+		expected     []string
+	}{
+		{mockImport{}, "", `[{"id":9,"title":"buy milk","tags":["groceries",{"id":2,"name":"shops"}],"priority":"high"}]`,
+			http.StatusCreated, []string{`"created":1`, `"id":1`, `"priority":"high"`, `"name":"shops"`}},
+		{mockImport{}, "?format=csv", "title,note,isDone,dueAt,tags\nbuy milk,,true,2019-03-22T17:00:00Z,\"groceries,shops\"\nduplicate,,,,\n",
+			http.StatusCreated, []string{`"created":1`, `"duplicates":1`, `"isDone":true`, `"status":"duplicate"`}},
+		{mockImport{}, "?format=md", "# Todos\n\n- [x] buy milk · due 2019-03-22 · urgent priority #groceries\n  semi skimmed\n",
+			http.StatusCreated, []string{`"title":"buy milk"`, `"note":"semi skimmed"`, `"priority":"urgent"`, `"name":"groceries"`}},
+		{mockImport{}, "?format=todotxt&dryRun=true", "(B) 2019-03-01 call mum +family @phone due:2019-03-22\n",
+			http.StatusOK, []string{`"title":"call mum"`, `"priority":"high"`, `"name":"family"`, `"name":"phone"`}},
+		{mockImport{}, "?format=xml", "<todos/>", http.StatusBadRequest, nil},
+		{mockImport{}, "?dryRun=maybe", "[]", http.StatusBadRequest, nil},
+		{mockImport{}, "", "[]", http.StatusBadRequest, nil},
+		{mockImport{}, "", `[{"title":""}]`, http.StatusBadRequest, nil},
+		{mockImport{}, "?format=csv", "id,isDone\n1,true\n", http.StatusBadRequest, nil},
+		{mockImport{errors.New("connection refused")}, "", `[{"title":"buy milk"}]`, http.StatusInternalServerError, nil},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Request, _ = http.NewRequest("POST", "http://example.com/import"+test.query, strings.NewReader(test.body))
+		ImportTodos(test.db)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%q: expected status code %d but received %d", test.query, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(recorder.Body.String(), expected) {
+				t.Errorf("%q: expected the response to contain %s but received %s", test.query, expected, recorder.Body)
+			}
+		}
+		if strings.Contains(test.query, "dryRun=true") && strings.Contains(recorder.Body.String(), `"id":1`) {
+			t.Errorf("Expected a dry run not to report ids but received %s", recorder.Body)
+		}
+		if strings.Contains(test.query, "dryRun=true") && strings.Contains(recorder.Body.String(), `"0001-01-01`) {
+			t.Errorf("Expected a dry run not to report zero timestamps but received %s", recorder.Body)
+		}
+	}
+}
+
+func TestParseTodoTxtImport(t *testing.T) {
+	t.Log(`Should read completion, priorities and due dates from todo.txt`)
+	todos, err := parseTodoTxtImport([]byte("x 2019-03-20 2019-03-01 post letter pri:A\n\n(E) water plants\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("Expected 2 todos but received %d", len(todos))
+	}
+	completedAt := time.Date(2019, time.March, 20, 0, 0, 0, 0, time.UTC)
+	if !todos[0].IsDone || !todos[0].CompletedAt.Time.Equal(completedAt) || todos[0].Title.String != "post letter" ||
+		todos[0].Priority != models.PriorityUrgent {
+		t.Errorf("Expected a completed urgent todo but received %+v", todos[0])
+	}
+	if todos[1].IsDone || todos[1].Priority != models.PriorityLow {
+		t.Errorf("Expected an open low priority todo but received %+v", todos[1])
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"unicode/utf8"
+)
+
+// List is a type alias for convenience
+type List = models.List
+
+// ListStore is the datastore API for lists
+type ListStore interface {
+	DBCreateList
+	DBGetList
+	DBGetAllLists
+	DBUpdateList
+	DBDeleteList
+}
+
+// getListIDFromContext reads a list ID from the named url parameter
+func getListIDFromContext(c *gin.Context, param string) (uint, bool) {
+	strListID := c.Param(param)
+	if len(strListID) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Unable to get list ID",
+		})
+		return 0, false
+	}
+	listID, err := StringToUint(strListID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Can't convert list id in url to uint",
+		})
+		return 0, false
+	}
+
+	return listID, true
+}
+
+// DBCreateList represents the part of the datalayer responsible for creating lists
+type DBCreateList interface {
+	CreateList(l *List) error
+}
+
+// CreateList returns a function which handles requests to create lists
+func CreateList(db DBCreateList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+
+		if !validListName(c, body.Name) {
+			return
+		}
+
+		list := List{
+			Name:   body.Name,
+			UserID: userID,
+		}
+
+		err := db.CreateList(&list)
+		if err == models.ErrorDuplicateList {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to save list",
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "List created successfully!",
+			"resourceId": list.ID,
+			"data":       list.Serialize(),
+		})
+	}
+}
+
+// validListName checks that a list's name fits in the lists table, responding with 400 Bad Request when it doesn't
+func validListName(c *gin.Context, name string) bool {
+	if utf8.RuneCountInString(name) > models.MaxListNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": fmt.Sprintf("List name may be at most %d characters", models.MaxListNameLength),
+		})
+		return false
+	}
+	return true
+}
+
+// DBGetAllLists represents the part of the datalayer responsible for getting a user's lists
+type DBGetAllLists interface {
+	GetAllLists(userID uint) ([]*List, error)
+}
+
+// GetAllLists returns a function which handles requests for all the current User's lists
+func GetAllLists(db DBGetAllLists) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		lists, err := db.GetAllLists(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching lists",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(lists))
+		for i, item := range lists {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBGetList represents the part of the datalayer responsible for getting a single list
+type DBGetList interface {
+	GetList(listID, userID uint) (*List, error)
+}
+
+// GetList returns a function which handles requests to get a single list
+func GetList(db DBGetList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		listID, ok := getListIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		list, err := db.GetList(listID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unable to find list",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": list.Serialize()})
+	}
+}
+
+// GetListTodos returns a function which handles requests for the todos in one of the current User's lists,
+// accepting the same filtering, sorting & pagination options as GetAllTodos
+func GetListTodos(db DBGetAllTodos) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		listID, ok := getListIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		query, err := parseTodoQuery(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": err.Error(),
+			})
+			return
+		}
+		query.ListID = listID
+
+		respondWithTodos(c, db, userID, query)
+	}
+}
+
+// DBUpdateList represents the part of the datalayer responsible for renaming a list
+type DBUpdateList interface {
+	UpdateList(l List) (*List, error)
+}
+
+// UpdateList returns a function which handles requests to rename an existing list
+func UpdateList(db DBUpdateList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		listID, ok := getListIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Bad request",
+			})
+			return
+		}
+
+		if !validListName(c, body.Name) {
+			return
+		}
+
+		_, err := db.UpdateList(List{ID: listID, UserID: userID, Name: body.Name})
+		if err == models.ErrorDuplicateList {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find list"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "List updated successfully!", "resourceId": listID})
+	}
+}
+
+// DBDeleteList represents the part of the datalayer responsible for deleting a single list
+type DBDeleteList interface {
+	DeleteList(listID, userID uint) (uint, error)
+}
+
+// DeleteList returns a function which handles requests to delete a list, moving its todos to the inbox
+func DeleteList(db DBDeleteList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		listID, ok := getListIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		deletedListID, err := db.DeleteList(listID, userID)
+		if err == models.ErrorInboxList {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find list"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "List deleted successfully!", "resourceId": deletedListID})
+	}
+}
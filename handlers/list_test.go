@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockLists struct {
+	err error
+}
+
+func (db mockLists) CreateList(l *List) error {
+	l.ID = 1
+	return db.err
+}
+
+func (db mockLists) GetAllLists(userID uint) ([]*List, error) {
+	return []*List{{ID: 1, Name: models.InboxName, UserID: userID, IsInbox: true}}, db.err
+}
+
+func (db mockLists) GetList(listID, userID uint) (*List, error) {
+	return &List{ID: listID, UserID: userID, Name: "groceries"}, db.err
+}
+
+func (db mockLists) UpdateList(l List) (*List, error) {
+	return &l, db.err
+}
+
+func (db mockLists) DeleteList(listID, userID uint) (uint, error) {
+	return listID, db.err
+}
+
+type mockListTodos struct {
+	query *models.TodoQuery
+}
+
+func (db mockListTodos) GetAllTodos(userID uint, query models.TodoQuery) ([]*Todo, error) {
+	*db.query = query
+	return []*Todo{{ID: 1, UserID: userID}}, nil
+}
+
+func TestListHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		id           string
+		body         string
+		expectedCode int
+	}{
+		{CreateList(mockLists{}), "", `{"name": "groceries"}`, http.StatusCreated},
+		{CreateList(mockLists{}), "", `{}`, http.StatusBadRequest},
+		{CreateList(mockLists{}), "", `{"name": "` + strings.Repeat("é", models.MaxListNameLength+1) + `"}`, http.StatusBadRequest},
+		{CreateList(mockLists{models.ErrorDuplicateList}), "", `{"name": "groceries"}`, http.StatusConflict},
+		{GetAllLists(mockLists{}), "", ``, http.StatusOK},
+		{GetList(mockLists{}), "2", ``, http.StatusOK},
+		{GetList(mockLists{models.ErrorRowsUnaffected}), "2", ``, http.StatusNotFound},
+		{GetList(mockLists{}), "groceries", ``, http.StatusBadRequest},
+		{UpdateList(mockLists{}), "2", `{"name": "shopping"}`, http.StatusOK},
+		{UpdateList(mockLists{}), "2", `{"name": 5}`, http.StatusBadRequest},
+		{UpdateList(mockLists{models.ErrorDuplicateList}), "2", `{"name": "groceries"}`, http.StatusConflict},
+		{DeleteList(mockLists{}), "2", ``, http.StatusOK},
+		{DeleteList(mockLists{models.ErrorInboxList}), "1", ``, http.StatusConflict},
+		{DeleteList(mockLists{models.ErrorRowsUnaffected}), "3", ``, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: test.id}}
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Expected status code %d but received %d",
+				test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
+
+func TestGetListTodos(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "4"}}
+	req, _ := http.NewRequest("GET", "http://example.com/?sort=position&prev=2", nil)
+	mockContext.Request = req
+
+	var query models.TodoQuery
+	GetListTodos(mockListTodos{&query})(mockContext)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+	}
+	if query.ListID != 4 || query.Sort != "position" || query.PreviousID != 2 {
+		t.Errorf("Expected the list's todos sorted by position after todo 2 but received %+v", query)
+	}
+}
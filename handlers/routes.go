@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// StaticOrID returns a function which dispatches requests for a `/:id` route to one of the static
+// handlers when the id matches its name, and to byID otherwise. Gin's router does not allow static
+// path segments such as `/search` alongside a wildcard segment like `/:id`. A nil byID responds
+// with 404 Not Found, for routes such as `POST /batch` which have no counterpart for a single id.
+func StaticOrID(static map[string]gin.HandlerFunc, byID gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if handler, ok := static[c.Param("id")]; ok {
+			handler(c)
+			return
+		}
+		if byID == nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Not found"})
+			return
+		}
+		byID(c)
+	}
+}
+
+// Deprecated returns a function which handles requests with the given handler, while warning clients
+// that the route is deprecated in favour of its successor
+func Deprecated(successor string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Warning", fmt.Sprintf(`299 - "Deprecated API: use %s instead"`, successor))
+		handler(c)
+	}
+}
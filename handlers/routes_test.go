@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaticOrID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := StaticOrID(map[string]gin.HandlerFunc{
+		"search": func(c *gin.Context) { c.Status(http.StatusAccepted) },
+	}, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		id           string
+		expectedCode int
+	}{
+		{"search", http.StatusAccepted},
+		{"1", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Params = []gin.Param{{Key: "id", Value: test.id}}
+		handler(mockContext)
+		mockContext.Writer.WriteHeaderNow()
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Expected status code %d but received %d", test.expectedCode, recorder.Code)
+		}
+	}
+}
+
+func TestStaticOrNotFound(t *testing.T) {
+	t.Log(`Should respond with not found for ids without a handler`)
+	gin.SetMode(gin.TestMode)
+	handler := StaticOrID(map[string]gin.HandlerFunc{
+		"batch": func(c *gin.Context) { c.Status(http.StatusOK) },
+	}, nil)
+
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+	handler(mockContext)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d but received %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+
+	Deprecated("POST /todos/:id/completed", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})(mockContext)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+	}
+	if recorder.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected a Deprecation header")
+	}
+	expected := `299 - "Deprecated API: use POST /todos/:id/completed instead"`
+	if warning := recorder.Header().Get("Warning"); warning != expected {
+		t.Errorf("Expected Warning header %s but received %s", expected, warning)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"strconv"
+)
+
+// DBSearchTodos represents the part of the datalayer responsible for full-text search of todos
+type DBSearchTodos interface {
+	SearchTodos(userID uint, search string, limit int) ([]*models.SearchResult, error)
+}
+
+// SearchTodos returns a function which handles requests to search the current User's todos and those shared with them
+func SearchTodos(db DBSearchTodos) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		search := c.Query("q")
+		if len(search) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "`q` query param must be provided to search",
+			})
+			return
+		}
+
+		limit := 0
+		if strLimit, ok := c.GetQuery("limit"); ok {
+			var err error
+			if limit, err = strconv.Atoi(strLimit); err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "`limit` query param must be a positive integer",
+				})
+				return
+			}
+		}
+
+		results, err := db.SearchTodos(userID, search, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error searching todos",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(results))
+		for i, item := range results {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockSearch struct{}
+
+func (db mockSearch) SearchTodos(userID uint, search string, limit int) ([]*models.SearchResult, error) {
+	return []*models.SearchResult{
+		{Todo: &Todo{ID: 1, UserID: userID, Title: models.MakeNullString(search)}, Rank: 0.1},
+	}, nil
+}
+
+func TestSearchTodos(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query        string
+		expectedCode int
+	}{
+		{"?q=milk", http.StatusOK},
+		{"?q=milk&limit=5", http.StatusOK},
+		{"?q=milk&limit=none", http.StatusBadRequest},
+		{"?q=", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		req, _ := http.NewRequest("GET", "http://example.com/search"+test.query, nil)
+		mockContext.Request = req
+		mockContext.Set("userID", uint(11))
+
+		SearchTodos(mockSearch{})(mockContext)
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.query, test.expectedCode, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+)
+
+// Share is a type alias for convenience
+type Share = models.Share
+
+// ShareStore is the datastore API for sharing todos and lists with other users
+type ShareStore interface {
+	DBGetShares
+	DBGrantShare
+	DBRevokeShare
+}
+
+// getSharedIDFromContext reads the id of the shared todo or list from the url
+func getSharedIDFromContext(c *gin.Context, resource models.ShareResource) (uint, bool) {
+	if resource == models.SharedList {
+		return getListIDFromContext(c, "id")
+	}
+	return getTodoIDFromContext(c)
+}
+
+// DBGetShares represents the part of the datalayer responsible for listing who a todo or list is shared with
+type DBGetShares interface {
+	GetShares(resource models.ShareResource, resourceID, ownerID uint) ([]*Share, error)
+}
+
+// GetShares returns a function which handles requests to list who one of the current User's todos or lists is shared with
+func GetShares(db DBGetShares, resource models.ShareResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		resourceID, ok := getSharedIDFromContext(c, resource)
+		if !ok {
+			return
+		}
+
+		shares, err := db.GetShares(resource, resourceID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching shares",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(shares))
+		for i, item := range shares {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBGrantShare represents the part of the datalayer responsible for sharing a todo or list with another user
+type DBGrantShare interface {
+	DBGetUser
+	GrantShare(resource models.ShareResource, resourceID uint, s *Share) error
+}
+
+// GrantShare returns a function which handles requests to share one of the current User's todos or lists
+// with another user, identified by their email
+func GrantShare(db DBGrantShare, resource models.ShareResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		resourceID, ok := getSharedIDFromContext(c, resource)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Email string `json:"email" binding:"required"`
+			Role  string `json:"role" binding:"required"` // viewer or editor
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+
+		role, err := models.ParseShareRole(body.Role)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+			return
+		}
+
+		user, err := db.GetUser(body.Email)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "User not found"})
+			return
+		}
+
+		share := Share{OwnerID: userID, User: *user, Role: role}
+		switch err := db.GrantShare(resource, resourceID, &share); err {
+		case nil:
+		case models.ErrorShareWithSelf:
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+			return
+		case models.ErrorRowsUnaffected:
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find " + resource.String()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to share " + resource.String()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "Shared successfully!",
+			"resourceId": share.ID,
+			"data":       share.Serialize(),
+		})
+	}
+}
+
+// DBRevokeShare represents the part of the datalayer responsible for unsharing a todo or list
+type DBRevokeShare interface {
+	RevokeShare(resource models.ShareResource, resourceID, ownerID, userID uint) error
+}
+
+// RevokeShare returns a function which handles requests to stop sharing one of the current User's todos or lists with a user
+func RevokeShare(db DBRevokeShare, resource models.ShareResource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		resourceID, ok := getSharedIDFromContext(c, resource)
+		if !ok {
+			return
+		}
+		sharedUserID, err := StringToUint(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Can't convert user id in url to uint",
+			})
+			return
+		}
+
+		if err := db.RevokeShare(resource, resourceID, userID, sharedUserID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find share"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Share revoked successfully!"})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockShares struct {
+	err error
+}
+
+func (db mockShares) GetUser(email string) (*User, error) {
+	if email != "jane@example.com" {
+		return nil, sql.ErrNoRows
+	}
+	return &User{ID: 2, Email: email}, nil
+}
+
+func (db mockShares) GetShares(resource models.ShareResource, resourceID, ownerID uint) ([]*Share, error) {
+	return []*Share{{ID: 1, OwnerID: ownerID, User: User{ID: 2}, Role: models.RoleViewer}}, db.err
+}
+
+func (db mockShares) GrantShare(resource models.ShareResource, resourceID uint, s *Share) error {
+	s.ID = 1
+	return db.err
+}
+
+func (db mockShares) RevokeShare(resource models.ShareResource, resourceID, ownerID, userID uint) error {
+	return db.err
+}
+
+func TestShareHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		body         string
+		expectedCode int
+	}{
+		{GetShares(mockShares{}, models.SharedTodo), ``, http.StatusOK},
+		{GetShares(mockShares{}, models.SharedList), ``, http.StatusOK},
+		{GrantShare(mockShares{}, models.SharedTodo), `{"email": "jane@example.com", "role": "editor"}`, http.StatusCreated},
+		{GrantShare(mockShares{}, models.SharedList), `{"email": "jane@example.com", "role": "viewer"}`, http.StatusCreated},
+		{GrantShare(mockShares{}, models.SharedTodo), `{"email": "jane@example.com", "role": "owner"}`, http.StatusBadRequest},
+		{GrantShare(mockShares{}, models.SharedTodo), `{"email": "jane@example.com"}`, http.StatusBadRequest},
+		{GrantShare(mockShares{}, models.SharedTodo), `{"email": "nobody@example.com", "role": "viewer"}`, http.StatusNotFound},
+		{GrantShare(mockShares{models.ErrorRowsUnaffected}, models.SharedTodo), `{"email": "jane@example.com", "role": "viewer"}`, http.StatusNotFound},
+		{GrantShare(mockShares{models.ErrorShareWithSelf}, models.SharedTodo), `{"email": "jane@example.com", "role": "viewer"}`, http.StatusBadRequest},
+		{RevokeShare(mockShares{}, models.SharedTodo), ``, http.StatusOK},
+		{RevokeShare(mockShares{models.ErrorRowsUnaffected}, models.SharedList), ``, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "5"}, {Key: "userId", Value: "2"}}
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.body, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+	"github.com/vancelongwill/gotodos/events"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	socketWriteWait  = 10 * time.Second        // how long writing a message may take before the client is given up on
+	socketPongWait   = 60 * time.Second        // how long the client may take to answer a ping
+	socketPingPeriod = socketPongWait * 9 / 10 // how often pings are sent, leaving time for the pong to arrive
+	socketMaxMessage = 64 << 10                // the largest request a client may send, in bytes
+	// socketSendBuffer is how many responses may wait to be written before no more requests are read from the client
+	socketSendBuffer = 16
+)
+
+// JSON-RPC 2.0 error codes. Errors from the datalayer use the status code of the matching REST response instead.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// rpcChanged is the method of the notifications pushed to clients when a todo they can see changes
+const rpcChanged = "todos.changed"
+
+// rpcRequest is a JSON-RPC 2.0 request, or a notification when it has no id
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// rpcError is the error of a JSON-RPC response
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// rpcResponse is the response to a JSON-RPC request, holding either a result or an error
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"` // null when the request's id couldn't be read
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcNotification is a message pushed to the client which needs no response
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// changeNotification tells the client about an event, in the same shape as a server-sent event
+func changeNotification(e events.Event) rpcNotification {
+	params := e.Data()
+	params["id"] = e.ID
+	params["type"] = e.Type
+	return rpcNotification{JSONRPC: "2.0", Method: rpcChanged, Params: params}
+}
+
+// rpcTodoParams are the params of the methods acting on a single todo
+type rpcTodoParams struct {
+	ID      uint `json:"id" binding:"required"`
+	Version int  `json:"version"` // the version the todo must be at, as with If-Match, or zero for any
+}
+
+// decodeParams reads and validates the params of a request.
+// Untyped numbers are kept as json.Number, so large ids keep their digits when formatted.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: "Params must be an object: " + err.Error()}
+	}
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// rpcMethod carries out a request for the current User, returning its result
+type rpcMethod func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error)
+
+// rpcMethods are the methods clients may call, one for each operation of the TodoStore
+var rpcMethods = map[string]rpcMethod{
+	"todos.create": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body newTodo
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		todo, err := body.toTodo(userID)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		if err = db.CreateTodo(&todo); err != nil {
+			return nil, err
+		}
+		publish(c, events.Created, todo.ID, &todo)
+		return todo.Serialize(), nil
+	},
+	"todos.get": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body rpcTodoParams
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		todo, err := db.GetTodo(body.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		return todo.Serialize(), nil
+	},
+	"todos.list": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		// the params are the same as the query params of GET /todos
+		var body map[string]interface{}
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		values := url.Values{}
+		for param, value := range body {
+			values.Set(param, fmt.Sprint(value))
+		}
+		query, err := parseTodoQuery(values)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		todos, err := db.GetAllTodos(userID, query)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]map[string]interface{}, len(todos))
+		for i, todo := range todos {
+			data[i] = todo.Serialize()
+		}
+		return data, nil
+	},
+	"todos.update": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body struct {
+			rpcTodoParams
+			todoUpdate
+		}
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		if len(body.Title) == 0 && len(body.Note) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "Todo title or note must be provided to update"}
+		}
+		update, err := body.toTodo(body.ID, userID, body.Version)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		todo, err := db.UpdateTodo(update)
+		if err != nil {
+			return nil, err
+		}
+		publish(c, events.Updated, todo.ID, todo)
+		return todo.Serialize(), nil
+	},
+	"todos.patch": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body struct {
+			rpcTodoParams
+			Patch json.RawMessage `json:"patch" binding:"required"` // a JSON Merge Patch, as sent to PATCH /todos/:id
+		}
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		patch, err := parseTodoPatch(body.Patch)
+		if err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		patch.Version = body.Version
+		todo, err := db.PatchTodo(body.ID, userID, patch, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		publish(c, patchEventType(patch), todo.ID, todo)
+		return todo.Serialize(), nil
+	},
+	"todos.delete": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body rpcTodoParams
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		todoID, err := db.DeleteTodo(body.ID, userID, body.Version)
+		if err != nil {
+			return nil, err
+		}
+		publish(c, events.Deleted, todoID, nil)
+		return map[string]interface{}{"id": todoID}, nil
+	},
+	"todos.complete": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body rpcTodoParams
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		todo, err := db.MarkTodoAsComplete(body.ID, userID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		publish(c, events.Completed, todo.ID, todo)
+		return todo.Serialize(), nil
+	},
+	"todos.reopen": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body rpcTodoParams
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		if err := db.MarkTodoAsIncomplete(body.ID, userID, time.Now()); err != nil {
+			return nil, err
+		}
+		publish(c, events.Updated, body.ID, nil)
+		return map[string]interface{}{"id": body.ID}, nil
+	},
+	"todos.move": func(c *gin.Context, db TodoStore, userID uint, params json.RawMessage) (interface{}, error) {
+		var body struct {
+			rpcTodoParams
+			After  *uint `json:"after"`
+			Before *uint `json:"before"`
+		}
+		if err := decodeParams(params, &body); err != nil {
+			return nil, err
+		}
+		if body.After == nil && body.Before == nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "At least one of after or before must be given"}
+		}
+		todo, err := db.MoveTodo(body.ID, userID, body.After, body.Before)
+		if err != nil {
+			return nil, err
+		}
+		publish(c, events.Updated, todo.ID, todo)
+		return todo.Serialize(), nil
+	},
+}
+
+// toRPCError converts an error from carrying out a request into the error of its response
+func toRPCError(err error) *rpcError {
+	if e, ok := err.(*rpcError); ok {
+		return e
+	}
+	switch status := errorStatus(err); status {
+	case http.StatusNotFound:
+		return &rpcError{Code: status, Message: "Unable to find todo"}
+	case http.StatusInternalServerError:
+		log.Println(err)
+		return &rpcError{Code: rpcInternalError, Message: "Internal error"}
+	default:
+		return &rpcError{Code: status, Message: err.Error()}
+	}
+}
+
+// handleRPC carries out a single JSON-RPC request, returning its response, or nil for a notification
+func handleRPC(c *gin.Context, db TodoStore, userID uint, data []byte) *rpcResponse {
+	var request rpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		if json.Valid(data) {
+			return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcInvalidRequest, Message: "Request must be a JSON-RPC 2.0 object"}}
+		}
+		return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: "Request must be valid JSON"}}
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	if request.JSONRPC != "2.0" || len(request.Method) == 0 {
+		response.Error = &rpcError{Code: rpcInvalidRequest, Message: "Request must be a JSON-RPC 2.0 object"}
+		return response
+	}
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		response.Error = &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("Unknown method `%s`", request.Method)}
+	} else if result, err := method(c, db, userID, request.Params); err != nil {
+		response.Error = toRPCError(err)
+	} else {
+		response.Result = result
+	}
+	if request.ID == nil {
+		return nil
+	}
+	return response
+}
+
+// socket is a client's WebSocket connection. Requests are read and carried out one at a time, while their responses
+// and notifications of changes are written by a goroutine of their own, see TodoSocket.
+type socket struct {
+	ws      *websocket.Conn
+	send    chan *rpcResponse // responses waiting to be written
+	done    chan struct{}     // closed once the client stops sending requests
+	stopped chan struct{}     // closed once nothing more can be written to the client
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// TodoSocket returns a function which handles WebSocket connections through which the current User can call every
+// operation of the TodoStore with JSON-RPC 2.0 requests, and is notified of changes to their todos as they happen.
+// A client which reconnects with the `lastEventId` query param is first notified of the changes it missed.
+func TodoSocket(db TodoStore, hub Subscriber) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return // the upgrader has already responded
+		}
+
+		subscription, missed := hub.Subscribe(userID, c.Query("lastEventId"))
+		defer hub.Unsubscribe(subscription)
+		s := &socket{
+			ws:      ws,
+			send:    make(chan *rpcResponse, socketSendBuffer),
+			done:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		go s.write(subscription, missed)
+		s.read(c, db, userID)
+		close(s.done)
+		<-s.stopped
+	}
+}
+
+// read carries out the client's requests until it disconnects, stops answering pings or can't keep up with its responses
+func (s *socket) read(c *gin.Context, db TodoStore, userID uint) {
+	s.ws.SetReadLimit(socketMaxMessage)
+	s.ws.SetReadDeadline(time.Now().Add(socketPongWait))
+	s.ws.SetPongHandler(func(string) error {
+		return s.ws.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, data, err := s.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		response := handleRPC(c, db, userID, data)
+		if response == nil {
+			continue
+		}
+		// waiting for room to send the response stops the client from sending requests faster than it reads responses
+		select {
+		case s.send <- response:
+		case <-s.stopped:
+			return
+		}
+	}
+}
+
+// write sends the client its responses, notifications of changes and pings, until it's done or can't be written to
+func (s *socket) write(subscription *events.Subscription, missed []events.Event) {
+	ping := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ping.Stop()
+		s.ws.Close()
+		close(s.stopped)
+	}()
+	closeWith := func(code int, reason string) {
+		message := websocket.FormatCloseMessage(code, reason)
+		s.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+	}
+
+	for _, e := range missed {
+		if err := s.writeJSON(changeNotification(e)); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-s.done:
+			closeWith(websocket.CloseNormalClosure, "")
+			return
+		case response := <-s.send:
+			if err := s.writeJSON(response); err != nil {
+				return
+			}
+		case e, ok := <-subscription.Events():
+			if !ok {
+				// the client fell too far behind with its notifications, so must reconnect and resume
+				closeWith(websocket.CloseTryAgainLater, "Too far behind")
+				return
+			}
+			if err := s.writeJSON(changeNotification(e)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := s.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeJSON writes a message, giving up on clients which don't read it in time
+func (s *socket) writeJSON(message interface{}) error {
+	s.ws.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.ws.WriteJSON(message)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vancelongwill/gotodos/events"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockTodoStore struct {
+	mockCreate
+	mockGet
+	mockGetAll
+	mockDelete
+	mockComplete
+	mockUpdate
+	mockPatch
+	mockMove
+}
+
+// dialSocket connects to a TodoSocket for the user with id 1, which publishes to the hub
+func dialSocket(t *testing.T, hub *events.Hub, query string) (*websocket.Conn, func()) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) { c.Set("userID", uint(1)) }, PublishEvents(hub))
+	engine.GET("/socket", TodoSocket(mockTodoStore{}, hub))
+	server := httptest.NewServer(engine)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/socket"+query, nil)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return ws, func() {
+		ws.Close()
+		server.Close()
+	}
+}
+
+func TestTodoSocket(t *testing.T) {
+	t.Log("Should answer JSON-RPC requests and push notifications of changes")
+	hub := events.NewHub(nil, 10, 10)
+	ws, closeSocket := dialSocket(t, hub, "")
+	defer closeSocket()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	tests := []struct {
+		request       string
+		expectedError int
+	}{
+		{`{"jsonrpc": "2.0", "id": 1, "method": "todos.get", "params": {"id": 3}}`, 0},
+		{`{"jsonrpc": "2.0", "id": 2, "method": "todos.list", "params": {"limit": 5, "isDone": false}}`, 0},
+		{`{"jsonrpc": "2.0", "id": 3, "method": "todos.list", "params": {"direction": "sideways"}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 3, "method": "todos.list", "params": {"prev": 1000000}}`, 0},
+		{`{"jsonrpc": "2.0", "id": 3, "method": "todos.list", "params": {"prev": 404}}`, 400},
+		{`{"jsonrpc": "2.0", "id": 4, "method": "todos.patch", "params": {"id": 3, "patch": {"title": "buy milk"}}}`, 0},
+		{`{"jsonrpc": "2.0", "id": 5, "method": "todos.move", "params": {"id": 3}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 6, "method": "todos.delete", "params": {}}`, rpcInvalidParams},
+		{`{"jsonrpc": "2.0", "id": 7, "method": "todos.rename"}`, rpcMethodNotFound},
+		{`{"jsonrpc": "2.0", "id": 8, "method": "todos.create", "params": {"title": "buy milk", "note": "semi-skimmed"}}`, 0},
+		{`[1, 2]`, rpcInvalidRequest},
+		{`{"jsonrpc": "2.0"`, rpcParseError},
+	}
+
+	for _, test := range tests {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(test.request)); err != nil {
+			t.Fatal(err)
+		}
+		var response struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Error  *rpcError       `json:"error"`
+		}
+		// changes are notified before or after their response, depending on which the socket writes first
+		for response.ID == nil && response.Error == nil {
+			response.Method = ""
+			if err := ws.ReadJSON(&response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Method) > 0 && response.Method != rpcChanged {
+				t.Errorf("Unexpected notification %s", response.Method)
+			}
+		}
+
+		switch {
+		case test.expectedError == 0 && response.Error != nil:
+			t.Errorf("%s: expected a result but received %+v", test.request, response.Error)
+		case test.expectedError != 0 && (response.Error == nil || response.Error.Code != test.expectedError):
+			t.Errorf("%s: expected error %d but received %+v", test.request, test.expectedError, response.Error)
+		}
+	}
+
+	t.Log("Should resume notifications from the last event a client received")
+	subscription, _ := hub.Subscribe(1, "")
+	defer hub.Unsubscribe(subscription)
+	hub.Publish(events.Event{Type: events.Deleted, TodoID: 9, ActorID: 1})
+	last := <-subscription.Events()
+	hub.Publish(events.Event{Type: events.Completed, TodoID: 10, ActorID: 1})
+	<-subscription.Events()
+
+	resumed, closeResumed := dialSocket(t, hub, "?lastEventId="+last.ID)
+	defer closeResumed()
+	resumed.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var notification struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+	if err := resumed.ReadJSON(&notification); err != nil {
+		t.Fatal(err)
+	}
+	if notification.Method != rpcChanged || notification.Params["type"] != events.Completed || notification.Params["todoId"] != float64(10) {
+		t.Errorf("Expected the missed completion but received %+v", notification)
+	}
+}
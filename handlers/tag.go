@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"unicode/utf8"
+)
+
+// Tag is a type alias for convenience
+type Tag = models.Tag
+
+// TagStore is the datastore API for tags
+type TagStore interface {
+	DBCreateTag
+	DBGetTag
+	DBGetAllTags
+	DBUpdateTag
+	DBDeleteTag
+	DBAddTagToTodo
+	DBRemoveTagFromTodo
+}
+
+// getTagIDFromContext reads a tag ID from the named url parameter
+func getTagIDFromContext(c *gin.Context, param string) (uint, bool) {
+	strTagID := c.Param(param)
+	if len(strTagID) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Unable to get tag ID",
+		})
+		return 0, false
+	}
+	tagID, err := StringToUint(strTagID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": "Can't convert tag id in url to uint",
+		})
+		return 0, false
+	}
+
+	return tagID, true
+}
+
+// DBCreateTag represents the part of the datalayer responsible for creating tags
+type DBCreateTag interface {
+	CreateTag(t *Tag) error
+}
+
+// CreateTag returns a function which handles requests to create tags
+func CreateTag(db DBCreateTag) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+
+		if !validTagName(c, body.Name) {
+			return
+		}
+
+		tag := Tag{
+			Name:   body.Name,
+			UserID: userID,
+		}
+
+		err := db.CreateTag(&tag)
+		if err == models.ErrorDuplicateTag {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to save tag",
+			})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "Tag created successfully!",
+			"resourceId": tag.ID,
+			"data":       tag.Serialize(),
+		})
+	}
+}
+
+// validTagName checks that a tag's name fits in the tags table, responding with 400 Bad Request when it doesn't
+func validTagName(c *gin.Context, name string) bool {
+	if utf8.RuneCountInString(name) > models.MaxTagNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": fmt.Sprintf("Tag name may be at most %d characters", models.MaxTagNameLength),
+		})
+		return false
+	}
+	return true
+}
+
+// DBGetAllTags represents the part of the datalayer responsible for getting a list of tags
+type DBGetAllTags interface {
+	GetAllTags(userID uint) ([]*Tag, error)
+}
+
+// GetAllTags returns a function which handles requests for all the current User's tags
+func GetAllTags(db DBGetAllTags) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		tags, err := db.GetAllTags(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching tags",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(tags))
+		for i, item := range tags {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBGetTag represents the part of the datalayer responsible for getting a single tag
+type DBGetTag interface {
+	GetTag(tagID, userID uint) (*Tag, error)
+}
+
+// GetTag returns a function which handles requests to get a single tag
+func GetTag(db DBGetTag) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		tagID, ok := getTagIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		tag, err := db.GetTag(tagID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unable to find tag",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": tag.Serialize()})
+	}
+}
+
+// DBUpdateTag represents the part of the datalayer responsible for renaming a tag
+type DBUpdateTag interface {
+	UpdateTag(t Tag) (*Tag, error)
+}
+
+// UpdateTag returns a function which handles requests to rename an existing tag
+func UpdateTag(db DBUpdateTag) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		tagID, ok := getTagIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Name string `json:"name" binding:"required"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Bad request",
+			})
+			return
+		}
+
+		if !validTagName(c, body.Name) {
+			return
+		}
+
+		_, err := db.UpdateTag(Tag{ID: tagID, UserID: userID, Name: body.Name})
+		if err == models.ErrorDuplicateTag {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find tag"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Tag updated successfully!", "resourceId": tagID})
+	}
+}
+
+// DBDeleteTag represents the part of the datalayer responsible for deleting a single tag
+type DBDeleteTag interface {
+	DeleteTag(tagID, userID uint) (uint, error)
+}
+
+// DeleteTag returns a function which handles requests to delete a tag
+func DeleteTag(db DBDeleteTag) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		tagID, ok := getTagIDFromContext(c, "id")
+		if !ok {
+			return
+		}
+
+		deletedTagID, err := db.DeleteTag(tagID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find tag"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Tag deleted successfully!", "resourceId": deletedTagID})
+	}
+}
+
+// DBAddTagToTodo represents the part of the datalayer responsible for attaching tags to todos
+type DBAddTagToTodo interface {
+	AddTagToTodo(todoID, tagID, userID uint) error
+}
+
+// AddTagToTodo returns a function which handles requests to attach a tag to a todo
+func AddTagToTodo(db DBAddTagToTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		tagID, ok := getTagIDFromContext(c, "tagId")
+		if !ok {
+			return
+		}
+
+		if err := db.AddTagToTodo(todoID, tagID, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo or tag"})
+			return
+		}
+
+		publish(c, events.Updated, todoID, nil)
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Tag added to todo successfully!"})
+	}
+}
+
+// DBRemoveTagFromTodo represents the part of the datalayer responsible for detaching tags from todos
+type DBRemoveTagFromTodo interface {
+	RemoveTagFromTodo(todoID, tagID, userID uint) error
+}
+
+// RemoveTagFromTodo returns a function which handles requests to detach a tag from a todo
+func RemoveTagFromTodo(db DBRemoveTagFromTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+		tagID, ok := getTagIDFromContext(c, "tagId")
+		if !ok {
+			return
+		}
+
+		if err := db.RemoveTagFromTodo(todoID, tagID, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Tag is not attached to todo"})
+			return
+		}
+
+		publish(c, events.Updated, todoID, nil)
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Tag removed from todo successfully!"})
+	}
+}
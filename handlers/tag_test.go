@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type mockCreateTag struct {
+	err error
+}
+
+func (db mockCreateTag) CreateTag(t *Tag) error {
+	t.ID = 1
+	return db.err
+}
+
+type mockGetAllTags struct{}
+
+func (db mockGetAllTags) GetAllTags(userID uint) ([]*Tag, error) {
+	return []*Tag{{ID: 1, Name: "work", UserID: userID}}, nil
+}
+
+type mockGetTag struct{}
+
+func (db mockGetTag) GetTag(tagID, userID uint) (*Tag, error) {
+	return &Tag{ID: tagID, UserID: userID, Name: "work"}, nil
+}
+
+type mockUpdateTag struct{}
+
+func (db mockUpdateTag) UpdateTag(t Tag) (*Tag, error) {
+	return &t, nil
+}
+
+type mockDeleteTag struct{}
+
+func (db mockDeleteTag) DeleteTag(tagID, userID uint) (uint, error) {
+	return tagID, nil
+}
+
+type mockTodoTags struct{}
+
+func (db mockTodoTags) AddTagToTodo(todoID, tagID, userID uint) error {
+	return nil
+}
+
+func (db mockTodoTags) RemoveTagFromTodo(todoID, tagID, userID uint) error {
+	return nil
+}
+
+func TestCreateTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []mock{
+		{
+			`{"name": "work"}`,
+			http.StatusCreated,
+		},
+		{
+			`{}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{"name": ""}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{"name": "` + strings.Repeat("é", models.MaxTagNameLength+1) + `"}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(11))
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.json)))
+		mockContext.Request = req
+		CreateTag(mockCreateTag{})(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Expected status code %d but received %d",
+				test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(11))
+	mockContext.Request, _ = http.NewRequest("POST", "http://example.com/", bytes.NewBuffer([]byte(`{"name": "work"}`)))
+	CreateTag(mockCreateTag{models.ErrorDuplicateTag})(mockContext)
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d for a duplicate tag but received %d", http.StatusConflict, recorder.Code)
+	}
+}
+
+func TestGetAllTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(11))
+
+	GetAllTags(mockGetAllTags{})(mockContext)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestGetTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(11))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+	GetTag(mockGetTag{})(mockContext)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+		t.Log(recorder.Body)
+	}
+}
+
+func TestUpdateTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []mock{
+		{
+			`{"name": "home"}`,
+			http.StatusOK,
+		},
+		{
+			`{}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+		req, _ := http.NewRequest("PUT", "http://example.com/",
+			bytes.NewBuffer([]byte(test.json)))
+		mockContext.Request = req
+		UpdateTag(mockUpdateTag{})(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Expected status code %d but received %d",
+				test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+	DeleteTag(mockDeleteTag{})(mockContext)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+		t.Log(recorder.Body)
+	}
+}
+
+func TestAddAndRemoveTagFromTodo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handlers := []gin.HandlerFunc{
+		AddTagToTodo(mockTodoTags{}),
+		RemoveTagFromTodo(mockTodoTags{}),
+	}
+
+	for _, handler := range handlers {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}, {Key: "tagId", Value: "2"}}
+		handler(mockContext)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status code %d but received %d", http.StatusOK, recorder.Code)
+			t.Log(recorder.Body)
+		}
+
+		recorder = httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ = gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+		handler(mockContext)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d but received %d", http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
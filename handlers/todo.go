@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
 	"github.com/vancelongwill/gotodos/models"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"time"
 )
@@ -19,7 +24,10 @@ type TodoStore interface {
 	DBGetAllTodos
 	DBDeleteTodo
 	DBMarkTodoAsComplete
+	DBMarkTodoAsIncomplete
 	DBUpdateTodo
+	DBPatchTodo
+	DBMoveTodo
 }
 
 // StringToUint is a util function which converts strings to uints
@@ -64,12 +72,51 @@ func getTodoIDFromContext(c *gin.Context) (uint, bool) {
 	return todoID, true
 }
 
+// newTodo is the body of a request to create a todo
+type newTodo struct {
+	Title      string     `json:"title" binding:"required"`
+	Note       string     `json:"note" binding:"required"`
+	DueAt      *time.Time `json:"dueAt"`      // RFC 3339, null for no due date
+	Recurrence *string    `json:"recurrence"` // RRULE, null for a one-off todo
+	Priority   *string    `json:"priority"`   // none, low, medium, high or urgent
+	ParentID   *uint      `json:"parentId"`   // makes the todo a subtask
+	ListID     *uint      `json:"listId"`     // defaults to the parent's list or the inbox
+}
+
+// toTodo validates the body's recurrence and priority, and converts it into a todo belonging to the user
+func (body newTodo) toTodo(userID uint) (Todo, error) {
+	recurrence, err := models.NormalizeRecurrence(body.Recurrence)
+	if err != nil {
+		return Todo{}, err
+	}
+	priority, err := models.NormalizePriority(body.Priority)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	todo := Todo{
+		Title:      models.MakeNullString(body.Title),
+		Note:       models.MakeNullString(body.Note),
+		DueAt:      models.MakeNullTime(body.DueAt),
+		Recurrence: recurrence,
+		Priority:   priority,
+		UserID:     userID,
+	}
+	if body.ParentID != nil {
+		todo.ParentID = sql.NullInt64{Int64: int64(*body.ParentID), Valid: true}
+	}
+	if body.ListID != nil {
+		todo.ListID = sql.NullInt64{Int64: int64(*body.ListID), Valid: true}
+	}
+	return todo, nil
+}
+
 // DBCreateTodo represents the part of the datalayer responsible for creation
 type DBCreateTodo interface {
 	CreateTodo(t *Todo) error
 }
 
-// CreateTodo returns a function which handles requests to create todos
+// CreateTodo returns a function which handles requests to create todos, responding with the created todo and its location
 func CreateTodo(db DBCreateTodo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, ok := getUserIDFromContext(c)
@@ -77,11 +124,7 @@ func CreateTodo(db DBCreateTodo) gin.HandlerFunc {
 			return
 		}
 
-		var body struct {
-			Title string `json:"title" binding:"required"`
-			Note  string `json:"note" binding:"required"`
-		}
-
+		var body newTodo
 		if err := c.BindJSON(&body); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
@@ -90,13 +133,28 @@ func CreateTodo(db DBCreateTodo) gin.HandlerFunc {
 			return
 		}
 
-		todo := Todo{
-			Title:  models.MakeNullString(body.Title),
-			Note:   models.MakeNullString(body.Note),
-			UserID: userID,
+		todo, err := body.toTodo(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
 		}
 
-		if err := db.CreateTodo(&todo); err != nil {
+		if err := db.CreateTodo(&todo); err == models.ErrorParentNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unable to find parent todo",
+			})
+			return
+		} else if err == models.ErrorListNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": err.Error(),
+			})
+			return
+		} else if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status":  http.StatusInternalServerError,
 				"message": "Unable to save todo",
@@ -104,16 +162,88 @@ func CreateTodo(db DBCreateTodo) gin.HandlerFunc {
 			return
 		}
 
+		publish(c, events.Created, todo.ID, &todo)
+		c.Header("Location", path.Join(c.Request.URL.Path, fmt.Sprint(todo.ID)))
+		c.Header("ETag", todoETag(&todo))
 		c.JSON(http.StatusCreated, gin.H{
-			"status":  http.StatusCreated,
-			"message": "Todo item created successfully!",
+			"status":     http.StatusCreated,
+			"message":    "Todo item created successfully!",
+			"resourceId": todo.ID,
+			"data":       todo.Serialize(),
 		})
 	}
 }
 
 // DBGetAllTodos represents the part of the datalayer responsible for getting a list of todos
 type DBGetAllTodos interface {
-	GetAllTodos(userID, previousID uint) ([]*Todo, error)
+	GetAllTodos(userID uint, query models.TodoQuery) ([]*Todo, error)
+}
+
+// parseTodoQuery reads the filtering, sorting & pagination options for a list of todos from the url query
+func parseTodoQuery(values url.Values) (models.TodoQuery, error) {
+	var query models.TodoQuery
+	get := func(param string) (string, bool) {
+		value, ok := values[param]
+		if !ok || len(value) == 0 {
+			return "", false
+		}
+		return value[0], true
+	}
+
+	if prev, ok := get("prev"); ok { // use previous id for pagination
+		previousID, err := StringToUint(prev)
+		if err != nil {
+			return query, fmt.Errorf("Can't convert `prev` query param to uint")
+		}
+		query.PreviousID = previousID
+	}
+
+	var err error
+	if limit, ok := get("limit"); ok {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("`limit` query param must be a positive integer")
+		}
+	}
+
+	if isDone, ok := get("isDone"); ok {
+		b, err := strconv.ParseBool(isDone)
+		if err != nil {
+			return query, fmt.Errorf("`isDone` query param must be true or false")
+		}
+		query.IsDone = &b
+	}
+
+	times := map[string]**time.Time{
+		"dueBefore":    &query.DueBefore,
+		"dueAfter":     &query.DueAfter,
+		"createdAfter": &query.CreatedAfter,
+	}
+	for param, field := range times {
+		if value, ok := get(param); ok {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("`%s` query param must be an RFC 3339 timestamp", param)
+			}
+			*field = &t
+		}
+	}
+
+	query.Tag = values.Get("tag")
+
+	query.Sort = values.Get("sort")
+	if !models.IsValidSort(query.Sort) {
+		return query, fmt.Errorf("Can't sort todos by `%s`", query.Sort)
+	}
+
+	switch values.Get("direction") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("`direction` query param must be asc or desc")
+	}
+
+	return query, nil
 }
 
 // GetAllTodos returns a function responsible for handling requests for all the current User's todos
@@ -124,40 +254,52 @@ func GetAllTodos(db DBGetAllTodos) gin.HandlerFunc {
 			return
 		}
 
-		prev := c.DefaultQuery("prev", "0") // use previous id for pagination
-		previousID, err := StringToUint(prev)
+		query, err := parseTodoQuery(c.Request.URL.Query())
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
-				"message": "Can't convert `prev` query param to uint",
-			})
-		}
-
-		todos, err := db.GetAllTodos(userID, previousID)
-		if err != nil {
-			fmt.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  http.StatusInternalServerError,
-				"message": "Error fetching todos",
+				"message": err.Error(),
 			})
 			return
 		}
 
-		if len(todos) <= 0 {
-			c.JSON(http.StatusNotFound, gin.H{
-				"status":  http.StatusNotFound,
-				"message": "No todo items",
-			})
-			return
-		}
+		respondWithTodos(c, db, userID, query)
+	}
+}
 
-		data := make([]map[string]interface{}, len(todos))
-		for i, item := range todos {
-			data[i] = item.Serialize()
-		}
+// respondWithTodos responds with the page of todos matching the query
+func respondWithTodos(c *gin.Context, db DBGetAllTodos, userID uint, query models.TodoQuery) {
+	todos, err := db.GetAllTodos(userID, query)
+	if err == models.ErrorInvalidPrevious {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error fetching todos",
+		})
+		return
+	}
+
+	if len(todos) <= 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "No todo items",
+		})
+		return
+	}
 
-		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	data := make([]map[string]interface{}, len(todos))
+	for i, item := range todos {
+		data[i] = item.Serialize()
 	}
+
+	c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
 }
 
 // DBGetTodo represents the part of the datalayer responsible for getting a single todo
@@ -188,6 +330,13 @@ func GetTodo(db DBGetTodo) gin.HandlerFunc {
 			return
 		}
 
+		etag := todoETag(todo)
+		c.Header("ETag", etag)
+		if notModified(c, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
 		_todo := todo.Serialize()
 		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": _todo})
 	}
@@ -198,6 +347,40 @@ type DBUpdateTodo interface {
 	UpdateTodo(t Todo) (*Todo, error)
 }
 
+// todoUpdate is the body of a request to replace a todo
+type todoUpdate struct {
+	Title      string     `json:"title" binding:"required"`
+	Note       string     `json:"note" binding:"required"`
+	DueAt      *time.Time `json:"dueAt"`      // RFC 3339, null for no due date
+	Recurrence *string    `json:"recurrence"` // RRULE, null for a one-off todo
+	Priority   *string    `json:"priority"`   // none, low, medium, high or urgent
+}
+
+// toTodo validates the body's recurrence and priority, and converts it into the replacement for a todo,
+// which must be at the given version unless it's zero
+func (body todoUpdate) toTodo(todoID, userID uint, version int) (Todo, error) {
+	recurrence, err := models.NormalizeRecurrence(body.Recurrence)
+	if err != nil {
+		return Todo{}, err
+	}
+	priority, err := models.NormalizePriority(body.Priority)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	return Todo{
+		ID:         todoID,
+		UserID:     userID,
+		Title:      models.MakeNullString(body.Title),
+		Note:       models.MakeNullString(body.Note),
+		DueAt:      models.MakeNullTime(body.DueAt),
+		Recurrence: recurrence,
+		Priority:   priority,
+		ModifiedAt: time.Now(),
+		Version:    version,
+	}, nil
+}
+
 // UpdateTodo returns a function which handles requests to edit an existing Todo
 func UpdateTodo(db DBUpdateTodo) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -209,12 +392,12 @@ func UpdateTodo(db DBUpdateTodo) gin.HandlerFunc {
 		if !ok {
 			return
 		}
-
-		var body struct {
-			Title string `json:"title" binding:"required"`
-			Note  string `json:"note" binding:"required"`
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
 		}
 
+		var body todoUpdate
 		if err := c.BindJSON(&body); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"status":  http.StatusBadRequest,
@@ -231,30 +414,191 @@ func UpdateTodo(db DBUpdateTodo) gin.HandlerFunc {
 			return
 		}
 
-		_todo := Todo{
-			ID:         todoID,
-			UserID:     userID,
-			Title:      models.MakeNullString(body.Title),
-			Note:       models.MakeNullString(body.Note),
-			ModifiedAt: time.Now(),
+		_todo, err := body.toTodo(todoID, userID, version)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
 		}
 
 		todo, err := db.UpdateTodo(_todo)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo", "resourceId": todo.ID})
+		if err == models.ErrorVersionMismatch {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed, "message": err.Error(), "resourceId": todoID})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo", "resourceId": todoID})
 			return
 		}
 
+		publish(c, events.Updated, todo.ID, todo)
+		c.Header("ETag", todoETag(todo))
 		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo updated successfully!"})
 	}
 }
 
-// DBDeleteTodo represents the part of the datalayer responsible for deleting a single todo
+// DBPatchTodo represents the part of the datalayer responsible for partially updating a todo
+type DBPatchTodo interface {
+	PatchTodo(todoID, userID uint, patch models.TodoPatch, currentTime time.Time) (*Todo, error)
+}
+
+// parseTodoPatch reads a JSON Merge Patch (RFC 7396) document into a patch for a todo
+func parseTodoPatch(data []byte) (models.TodoPatch, error) {
+	var patch models.TodoPatch
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return patch, fmt.Errorf("Patch must be a JSON object")
+	}
+
+	for field, value := range fields {
+		isNull := string(value) == "null"
+		switch field {
+		case "title", "note":
+			str := sql.NullString{}
+			if !isNull {
+				if err := json.Unmarshal(value, &str.String); err != nil {
+					return patch, fmt.Errorf("`%s` must be a string or null", field)
+				}
+				str.Valid = true
+			}
+			if field == "title" {
+				patch.Title = &str
+			} else {
+				patch.Note = &str
+			}
+		case "dueAt":
+			var dueAt *time.Time
+			if err := json.Unmarshal(value, &dueAt); err != nil {
+				return patch, fmt.Errorf("`dueAt` must be an RFC 3339 timestamp or null")
+			}
+			nullTime := models.MakeNullTime(dueAt)
+			patch.DueAt = &nullTime
+		case "recurrence":
+			var rule *string
+			if err := json.Unmarshal(value, &rule); err != nil {
+				return patch, fmt.Errorf("`recurrence` must be an RRULE string or null")
+			}
+			recurrence, err := models.NormalizeRecurrence(rule)
+			if err != nil {
+				return patch, err
+			}
+			patch.Recurrence = &recurrence
+		case "priority":
+			var name *string
+			if err := json.Unmarshal(value, &name); err != nil {
+				return patch, fmt.Errorf("`priority` must be a string or null")
+			}
+			priority, err := models.NormalizePriority(name)
+			if err != nil {
+				return patch, err
+			}
+			patch.Priority = &priority
+		case "listId":
+			var listID uint
+			if isNull {
+				return patch, fmt.Errorf("`listId` can't be removed")
+			}
+			if err := json.Unmarshal(value, &listID); err != nil {
+				return patch, fmt.Errorf("`listId` must be a list id")
+			}
+			patch.ListID = &listID
+		case "isDone":
+			var isDone bool
+			if isNull {
+				return patch, fmt.Errorf("`isDone` can't be removed")
+			}
+			if err := json.Unmarshal(value, &isDone); err != nil {
+				return patch, fmt.Errorf("`isDone` must be a boolean")
+			}
+			patch.IsDone = &isDone
+		default:
+			return patch, fmt.Errorf("`%s` can't be patched", field)
+		}
+	}
+
+	if patch.IsEmpty() {
+		return patch, fmt.Errorf("Patch must change at least one of title, note, dueAt, isDone, recurrence, priority or listId")
+	}
+	return patch, nil
+}
+
+// PatchTodo returns a function which handles JSON Merge Patch requests to partially update an existing Todo
+func PatchTodo(db DBPatchTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		switch c.ContentType() {
+		case "application/merge-patch+json", "application/json", "":
+		default:
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"status":  http.StatusUnsupportedMediaType,
+				"message": "Patches must be sent as application/merge-patch+json",
+			})
+			return
+		}
+
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": "Bad request"})
+			return
+		}
+
+		patch, err := parseTodoPatch(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("Bad request: %s", err.Error()),
+			})
+			return
+		}
+		if patch.Version, ok = ifMatchVersion(c); !ok {
+			return
+		}
+
+		todo, err := db.PatchTodo(todoID, userID, patch, time.Now())
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo", "resourceId": todoID})
+			return
+		case models.ErrorListNotFound:
+			// the list must belong to the todo's owner, so an editor can't move a shared todo into their own lists
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": err.Error()})
+			return
+		case models.ErrorEmptyTodo:
+			c.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest, "message": err.Error()})
+			return
+		case models.ErrorHasOpenSubtasks:
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		case models.ErrorVersionMismatch:
+			c.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed, "message": err.Error(), "resourceId": todoID})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to update todo"})
+			return
+		}
+
+		publish(c, patchEventType(patch), todo.ID, todo)
+		c.Header("ETag", todoETag(todo))
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo updated successfully!", "data": todo.Serialize()})
+	}
+}
+
+// DBDeleteTodo represents the part of the datalayer responsible for moving a single todo to the trash
 type DBDeleteTodo interface {
-	DeleteTodo(todoID, userID uint) (uint, error)
+	DeleteTodo(todoID, userID uint, version int) (uint, error)
 }
 
-// DeleteTodo returns a function which handles requests to delete a todo
+// DeleteTodo returns a function which handles requests to delete a todo, moving it to the trash
 func DeleteTodo(db DBDeleteTodo) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, ok := getUserIDFromContext(c)
@@ -266,20 +610,32 @@ func DeleteTodo(db DBDeleteTodo) gin.HandlerFunc {
 			return
 		}
 
-		deletedTodoID, err := db.DeleteTodo(todoID, userID)
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
 
-		if err != nil {
+		deletedTodoID, err := db.DeleteTodo(todoID, userID, version)
+
+		if err == models.ErrorVersionMismatch {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed, "message": err.Error(), "resourceId": todoID})
+			return
+		} else if err == models.ErrorHasSubtasks {
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		} else if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo"})
 			return
 		}
 
+		publish(c, events.Deleted, deletedTodoID, nil)
 		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo deleted successfully!", "resourceId": deletedTodoID})
 	}
 }
 
 // DBMarkTodoAsComplete represents the part of the datalayer responsible for updating the completion status of a todo
 type DBMarkTodoAsComplete interface {
-	MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) error
+	MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) (*Todo, error)
 }
 
 // MarkTodoAsComplete returns a function which handles requests to mark a todo as complete
@@ -295,7 +651,14 @@ func MarkTodoAsComplete(db DBMarkTodoAsComplete) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.MarkTodoAsComplete(todoID, userID, time.Now()); err != nil {
+		todo, err := db.MarkTodoAsComplete(todoID, userID, time.Now())
+		if err == models.ErrorHasOpenSubtasks {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": err.Error(),
+			})
+			return
+		} else if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"status":  http.StatusNotFound,
 				"message": "Unable to find todo",
@@ -303,6 +666,87 @@ func MarkTodoAsComplete(db DBMarkTodoAsComplete) gin.HandlerFunc {
 			return
 		}
 
+		publish(c, events.Completed, todoID, todo)
 		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo marked as complete successfully"})
 	}
 }
+
+// DBMarkTodoAsIncomplete represents the part of the datalayer responsible for reopening a completed todo
+type DBMarkTodoAsIncomplete interface {
+	MarkTodoAsIncomplete(todoID, userID uint, currentTime time.Time) error
+}
+
+// MarkTodoAsIncomplete returns a function which handles requests to reopen a completed todo
+func MarkTodoAsIncomplete(db DBMarkTodoAsIncomplete) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		if err := db.MarkTodoAsIncomplete(todoID, userID, time.Now()); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Unable to find todo",
+			})
+			return
+		}
+
+		publish(c, events.Updated, todoID, nil)
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo reopened successfully"})
+	}
+}
+
+// DBMoveTodo represents the part of the datalayer responsible for manually reordering todos
+type DBMoveTodo interface {
+	MoveTodo(todoID, userID uint, afterID, beforeID *uint) (*Todo, error)
+}
+
+// MoveTodo returns a function which handles requests to move a todo between two of its neighbours
+func MoveTodo(db DBMoveTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			After  *uint `json:"after"`  // the todo to place this one directly after
+			Before *uint `json:"before"` // the todo to place this one directly before
+		}
+
+		if err := c.BindJSON(&body); err != nil || (body.After == nil && body.Before == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Bad request: at least one of after or before must be given",
+			})
+			return
+		}
+
+		todo, err := db.MoveTodo(todoID, userID, body.After, body.Before)
+		switch err {
+		case nil:
+		case sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo or its neighbours"})
+			return
+		case models.ErrorInvalidMove:
+			c.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict, "message": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError, "message": "Unable to move todo"})
+			return
+		}
+
+		publish(c, events.Updated, todo.ID, todo)
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo moved successfully!", "data": todo.Serialize()})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/vancelongwill/gotodos/models"
@@ -121,6 +122,7 @@ func TestGetTodoIDFromContext(t *testing.T) {
 type mockCreate struct{}
 
 func (db mockCreate) CreateTodo(t *Todo) error {
+	t.ID = 5
 	return nil
 }
 
@@ -135,13 +137,17 @@ func (db mockGet) GetTodo(todoID, userID uint) (*Todo, error) {
 
 type mockDelete struct{}
 
-func (db mockDelete) DeleteTodo(todoID, userID uint) (uint, error) {
+func (db mockDelete) DeleteTodo(todoID, userID uint, version int) (uint, error) {
 	return todoID, nil
 }
 
 type mockComplete struct{}
 
-func (db mockComplete) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) error {
+func (db mockComplete) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	return &Todo{ID: todoID, UserID: userID, IsDone: true}, nil
+}
+
+func (db mockComplete) MarkTodoAsIncomplete(todoID, userID uint, currentTime time.Time) error {
 	return nil
 }
 
@@ -153,7 +159,10 @@ func (db mockUpdate) UpdateTodo(t Todo) (*Todo, error) {
 
 type mockGetAll struct{}
 
-func (db mockGetAll) GetAllTodos(id, prevID uint) ([]*Todo, error) {
+func (db mockGetAll) GetAllTodos(id uint, query models.TodoQuery) ([]*Todo, error) {
+	if query.PreviousID == 404 {
+		return nil, models.ErrorInvalidPrevious
+	}
 	todos := make([]*Todo, 0)
 	for i := uint(0); i < 10; i++ {
 		t := &Todo{}
@@ -184,6 +193,42 @@ func TestGetAll(t *testing.T) {
 	}
 }
 
+func TestGetAllWithQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		query        string
+		expectedCode int
+	}{
+		{"?prev=10&limit=50", http.StatusOK},
+		{"?isDone=false&tag=work", http.StatusOK},
+		{"?dueBefore=2019-03-15T10:13:31Z&dueAfter=2019-03-01T00:00:00Z", http.StatusOK},
+		{"?createdAfter=2019-03-01T00:00:00%2B01:00", http.StatusOK},
+		{"?sort=dueAt&direction=desc", http.StatusOK},
+		{"?sort=title", http.StatusOK},
+		{"?prev=-1", http.StatusBadRequest},
+		{"?prev=404", http.StatusBadRequest},
+		{"?limit=0", http.StatusBadRequest},
+		{"?isDone=maybe", http.StatusBadRequest},
+		{"?dueBefore=tomorrow", http.StatusBadRequest},
+		{"?sort=password", http.StatusBadRequest},
+		{"?direction=sideways", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		req, _ := http.NewRequest("GET", "http://example.com/"+test.query, nil)
+		mockContext.Request = req
+		mockContext.Set("userID", uint(11))
+
+		GetAllTodos(mockGetAll{})(mockContext)
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.query, test.expectedCode, recorder.Code)
+		}
+	}
+}
+
 func TestGetAllWithoutUserID(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	recorder := httptest.NewRecorder() // implements http.ResponseWriter
@@ -231,6 +276,34 @@ func TestCreateTodo(t *testing.T) {
 			`{"title": "asd", "note": ""}`,
 			http.StatusBadRequest,
 		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": "2019-03-15T10:13:31Z"}`,
+			http.StatusCreated,
+		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": null}`,
+			http.StatusCreated,
+		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": "next tuesday"}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{"title": "test title", "note": "test note", "recurrence": "FREQ=WEEKLY;BYDAY=MO"}`,
+			http.StatusCreated,
+		},
+		{
+			`{"title": "test title", "note": "test note", "recurrence": "every monday"}`,
+			http.StatusBadRequest,
+		},
+		{
+			`{"title": "test title", "note": "test note", "priority": "urgent"}`,
+			http.StatusCreated,
+		},
+		{
+			`{"title": "test title", "note": "test note", "priority": "whenever"}`,
+			http.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -249,6 +322,9 @@ func TestCreateTodo(t *testing.T) {
 				test.expectedCode, recorder.Code)
 			t.Log(recorder.Body)
 		}
+		if location := recorder.Header().Get("Location"); recorder.Code == http.StatusCreated && location != "/5" {
+			t.Errorf("Expected the location of the created todo but received %s", location)
+		}
 	}
 }
 
@@ -260,6 +336,7 @@ func TestGetTodo(t *testing.T) {
 	mockContext.Set("userID", userID)
 	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
 
+	mockContext.Request, _ = http.NewRequest("GET", "http://example.com/", nil)
 	db := mockGet{}
 
 	GetTodo(db)(mockContext)
@@ -296,6 +373,18 @@ func TestUpdateTodo(t *testing.T) {
 			`{"title": "asd", "note": ""}`,
 			http.StatusBadRequest,
 		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": "2019-03-15T10:13:31+01:00"}`,
+			http.StatusOK,
+		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": null}`,
+			http.StatusOK,
+		},
+		{
+			`{"title": "test title", "note": "test note", "dueAt": "2019-03-15"}`,
+			http.StatusBadRequest,
+		},
 	}
 
 	for _, test := range tests {
@@ -324,6 +413,7 @@ func TestDeleteTodo(t *testing.T) {
 	mockContext, _ := gin.CreateTestContext(recorder)
 	mockContext.Set("userID", uint(1))
 	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+	mockContext.Request, _ = http.NewRequest("DELETE", "http://example.com/", nil)
 	db := mockDelete{}
 	DeleteTodo(db)(mockContext)
 
@@ -350,3 +440,171 @@ func TestMarkTodoAsComplete(t *testing.T) {
 		t.Log(recorder.Body)
 	}
 }
+
+type mockPatch struct{}
+
+func (db mockPatch) PatchTodo(todoID, userID uint, patch models.TodoPatch, currentTime time.Time) (*Todo, error) {
+	if patch.ListID != nil && *patch.ListID != 1 {
+		// only list 1 belongs to the todo's owner
+		return nil, models.ErrorListNotFound
+	}
+	todo := &Todo{ID: todoID, UserID: userID, Note: models.MakeNullString("note")}
+	if patch.Title != nil {
+		todo.Title = *patch.Title
+	}
+	return todo, nil
+}
+
+func TestPatchTodo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []mock{
+		{`{"title": "new title"}`, http.StatusOK},
+		{`{"title": null, "dueAt": "2019-03-15T10:13:31Z"}`, http.StatusOK},
+		{`{"dueAt": null}`, http.StatusOK},
+		{`{"isDone": true, "note": "done"}`, http.StatusOK},
+		{`{}`, http.StatusBadRequest},
+		{`[]`, http.StatusBadRequest},
+		{`null`, http.StatusBadRequest},
+		{`{"isDone": null}`, http.StatusBadRequest},
+		{`{"isDone": "yes"}`, http.StatusBadRequest},
+		{`{"title": 5}`, http.StatusBadRequest},
+		{`{"dueAt": "tomorrow"}`, http.StatusBadRequest},
+		{`{"userId": 2}`, http.StatusBadRequest},
+		{`{"recurrence": "FREQ=MONTHLY;COUNT=6"}`, http.StatusOK},
+		{`{"recurrence": null}`, http.StatusOK},
+		{`{"recurrence": "FREQ=FORTNIGHTLY"}`, http.StatusBadRequest},
+		{`{"priority": "high"}`, http.StatusOK},
+		{`{"priority": null}`, http.StatusOK},
+		{`{"priority": 3}`, http.StatusBadRequest},
+		{`{"listId": 1}`, http.StatusOK},
+		{`{"listId": 7}`, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+		req, _ := http.NewRequest("PATCH", "http://example.com/",
+			bytes.NewBuffer([]byte(test.json)))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		mockContext.Request = req
+		PatchTodo(mockPatch{})(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.json, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
+
+func TestMarkTodoAsIncomplete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder() // implements http.ResponseWriter
+	mockContext, _ := gin.CreateTestContext(recorder)
+	mockContext.Set("userID", uint(1))
+	mockContext.Params = []gin.Param{{Key: "id", Value: "1"}}
+	db := mockComplete{}
+	MarkTodoAsIncomplete(db)(mockContext)
+
+	if recorder.Code != 200 {
+		t.Errorf("Expected status code %d but received %d",
+			200, recorder.Code)
+		t.Log(recorder.Body)
+	}
+}
+
+type mockSubtasks struct {
+	err error
+}
+
+func (db mockSubtasks) CreateTodo(t *Todo) error {
+	return db.err
+}
+
+func (db mockSubtasks) DeleteTodo(todoID, userID uint, version int) (uint, error) {
+	return todoID, db.err
+}
+
+func (db mockSubtasks) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	return &Todo{ID: todoID, UserID: userID, IsDone: true}, db.err
+}
+
+func TestSubtaskErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		body         string
+		expectedCode int
+	}{
+		{CreateTodo(mockSubtasks{}), `{"title": "a", "note": "b", "parentId": 1}`, http.StatusCreated},
+		{CreateTodo(mockSubtasks{models.ErrorParentNotFound}), `{"title": "a", "note": "b", "parentId": 1}`, http.StatusBadRequest},
+		{DeleteTodo(mockSubtasks{models.ErrorHasSubtasks}), ``, http.StatusConflict},
+		{MarkTodoAsComplete(mockSubtasks{models.ErrorHasOpenSubtasks}), ``, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "2"}}
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Expected status code %d but received %d",
+				test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
+
+type mockMove struct {
+	err error
+}
+
+func (db mockMove) MoveTodo(todoID, userID uint, afterID, beforeID *uint) (*Todo, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	return &Todo{ID: todoID, UserID: userID, Position: "i"}, nil
+}
+
+func TestMoveTodo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		db           mockMove
+		body         string
+		expectedCode int
+	}{
+		{mockMove{}, `{"after": 3}`, http.StatusOK},
+		{mockMove{}, `{"before": 3}`, http.StatusOK},
+		{mockMove{}, `{"after": 3, "before": 4}`, http.StatusOK},
+		{mockMove{}, `{}`, http.StatusBadRequest},
+		{mockMove{}, `{"after": "first"}`, http.StatusBadRequest},
+		{mockMove{sql.ErrNoRows}, `{"after": 3}`, http.StatusNotFound},
+		{mockMove{models.ErrorInvalidMove}, `{"after": 4, "before": 3}`, http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder() // implements http.ResponseWriter
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: "2"}}
+		req, _ := http.NewRequest("POST", "http://example.com/",
+			bytes.NewBuffer([]byte(test.body)))
+		mockContext.Request = req
+		MoveTodo(test.db)(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d",
+				test.body, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
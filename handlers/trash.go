@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
+	"net/http"
+)
+
+// TrashStore is the datastore API for deleted todos
+type TrashStore interface {
+	DBGetTrash
+	DBRestoreTodo
+	DBPurgeTodo
+	DBEmptyTrash
+}
+
+// DBGetTrash represents the part of the datalayer responsible for listing a user's deleted todos
+type DBGetTrash interface {
+	GetTrash(userID uint) ([]*Todo, error)
+}
+
+// GetTrash returns a function which handles requests for the current User's deleted todos
+func GetTrash(db DBGetTrash) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		todos, err := db.GetTrash(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error fetching trash",
+			})
+			return
+		}
+
+		data := make([]map[string]interface{}, len(todos))
+		for i, item := range todos {
+			data[i] = item.Serialize()
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "data": data})
+	}
+}
+
+// DBRestoreTodo represents the part of the datalayer responsible for taking a todo out of the trash
+type DBRestoreTodo interface {
+	RestoreTodo(todoID, userID uint) (uint, error)
+}
+
+// RestoreTodo returns a function which handles requests to restore one of the current User's deleted todos
+func RestoreTodo(db DBRestoreTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		restoredTodoID, err := db.RestoreTodo(todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo in trash"})
+			return
+		}
+
+		publish(c, events.Created, restoredTodoID, nil)
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo restored successfully!", "resourceId": restoredTodoID})
+	}
+}
+
+// DBPurgeTodo represents the part of the datalayer responsible for permanently deleting a todo from the trash
+type DBPurgeTodo interface {
+	PurgeTodo(todoID, userID uint) (uint, error)
+}
+
+// PurgeTodo returns a function which handles requests to permanently delete one of the current User's deleted todos
+func PurgeTodo(db DBPurgeTodo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+		todoID, ok := getTodoIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		purgedTodoID, err := db.PurgeTodo(todoID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound, "message": "Unable to find todo in trash"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Todo purged successfully!", "resourceId": purgedTodoID})
+	}
+}
+
+// DBEmptyTrash represents the part of the datalayer responsible for permanently deleting all of a user's deleted todos
+type DBEmptyTrash interface {
+	EmptyTrash(userID uint) (int64, error)
+}
+
+// EmptyTrash returns a function which handles requests to permanently delete all the current User's deleted todos
+func EmptyTrash(db DBEmptyTrash) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := getUserIDFromContext(c)
+		if !ok {
+			return
+		}
+
+		count, err := db.EmptyTrash(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to empty trash",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": http.StatusOK, "message": "Trash emptied successfully!", "data": gin.H{"purged": count}})
+	}
+}
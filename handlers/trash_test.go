@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockTrash struct {
+	err error
+}
+
+func (db mockTrash) GetTrash(userID uint) ([]*Todo, error) {
+	return []*Todo{{ID: 1, UserID: userID}}, db.err
+}
+
+func (db mockTrash) RestoreTodo(todoID, userID uint) (uint, error) {
+	return todoID, db.err
+}
+
+func (db mockTrash) PurgeTodo(todoID, userID uint) (uint, error) {
+	return todoID, db.err
+}
+
+func (db mockTrash) EmptyTrash(userID uint) (int64, error) {
+	return 3, db.err
+}
+
+func TestTrashHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		handler      gin.HandlerFunc
+		todoID       string
+		expectedCode int
+	}{
+		{GetTrash(mockTrash{}), "", http.StatusOK},
+		{GetTrash(mockTrash{models.ErrorRowsUnaffected}), "", http.StatusInternalServerError},
+		{RestoreTodo(mockTrash{}), "1", http.StatusOK},
+		{RestoreTodo(mockTrash{models.ErrorRowsUnaffected}), "1", http.StatusNotFound},
+		{RestoreTodo(mockTrash{}), "first", http.StatusBadRequest},
+		{PurgeTodo(mockTrash{}), "1", http.StatusOK},
+		{PurgeTodo(mockTrash{models.ErrorRowsUnaffected}), "1", http.StatusNotFound},
+		{EmptyTrash(mockTrash{}), "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Set("userID", uint(1))
+		mockContext.Params = []gin.Param{{Key: "id", Value: test.todoID}}
+		test.handler(mockContext)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("%s: expected status code %d but received %d", test.todoID, test.expectedCode, recorder.Code)
+			t.Log(recorder.Body)
+		}
+	}
+}
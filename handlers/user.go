@@ -30,12 +30,12 @@ type UserStore interface {
 	DBCreateUser
 }
 
-// DBCreateUser represents the part of the datalayer responsible for creation of users
+// DBCreateUser represents the part of the datalayer responsible for creation of users along with their inbox list
 type DBCreateUser interface {
 	CreateUser(u *User) (*User, error)
 }
 
-// RegisterUser returns a function which handles requests to create a new application user
+// RegisterUser returns a function which handles requests to create a new application user, and their inbox list
 func RegisterUser(db DBCreateUser, secret []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// RegisterRequest specifies the request body shape for registering a new application user
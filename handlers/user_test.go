@@ -14,6 +14,7 @@ var secret = []byte("some secret")
 type mockCreateUser struct{}
 
 func (db mockCreateUser) CreateUser(u *User) (*User, error) {
+	u.ID = 1
 	return u, nil
 }
 
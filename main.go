@@ -3,17 +3,22 @@ package main
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/vancelongwill/gotodos/events"
 	"github.com/vancelongwill/gotodos/handlers"
 	"github.com/vancelongwill/gotodos/middleware"
 	"github.com/vancelongwill/gotodos/models"
+	"github.com/vancelongwill/gotodos/storage"
 	"log"
 	"net/http"
 	"os"
 	"path"
 	"reflect"
+	"strconv"
+	"time"
 )
 
-// Env defines the environment variables necessary for the app to run
+// Env defines the environment variables necessary for the app to run.
+// Variables with a default tag are optional, and may default to being empty.
 type Env struct {
 	APIVersion       string `env:"API_VERSION"`
 	APIPort          string `env:"API_PORT"`
@@ -23,6 +28,17 @@ type Env struct {
 	PostgresPassword string `env:"POSTGRES_PASSWORD"`
 	PostgresName     string `env:"POSTGRES_NAME"`
 	PostgresHost     string `env:"POSTGRES_HOST"`
+	SubtaskPolicy    string `env:"SUBTASK_POLICY" default:"cascade"`
+	BlobStore        string `env:"BLOB_STORE" default:"local"`
+	BlobDir          string `env:"BLOB_DIR" default:"attachments"`
+	MaxAttachment    string `env:"MAX_ATTACHMENT_SIZE" default:"10485760"`
+	S3Endpoint       string `env:"S3_ENDPOINT" default:""`
+	S3Bucket         string `env:"S3_BUCKET" default:""`
+	S3Region         string `env:"S3_REGION" default:"us-east-1"`
+	S3AccessKey      string `env:"S3_ACCESS_KEY" default:""`
+	S3SecretKey      string `env:"S3_SECRET_KEY" default:""`
+	TrashRetention   string `env:"TRASH_RETENTION" default:"720h"`
+	RequireIfMatch   string `env:"REQUIRE_IF_MATCH" default:"false"`
 }
 
 // getEnv gets all the necessary environment variables
@@ -33,7 +49,11 @@ func getEnv() *Env {
 	for i := 0; i < t.NumField(); i++ {
 		tag := t.Field(i).Tag.Get("env")
 		val := os.Getenv(tag)
+		defaultVal, optional := t.Field(i).Tag.Lookup("default")
 		if len(val) == 0 {
+			val = defaultVal
+		}
+		if len(val) == 0 && !optional {
 			panic(fmt.Sprintf("Error getting environment variables: %s not set", tag))
 		}
 		v.Field(i).SetString(val)
@@ -41,6 +61,34 @@ func getEnv() *Env {
 	return &env
 }
 
+// newBlobStore creates the store for the contents of attachments, either on the local filesystem or in an S3 bucket
+func newBlobStore(env *Env) (storage.BlobStore, error) {
+	switch env.BlobStore {
+	case "local":
+		return storage.NewLocalStore(env.BlobDir)
+	case "s3":
+		if len(env.S3Endpoint) == 0 || len(env.S3Bucket) == 0 {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET must be set")
+		}
+		return storage.NewS3Store(env.S3Endpoint, env.S3Bucket, env.S3Region, env.S3AccessKey, env.S3SecretKey), nil
+	}
+	return nil, fmt.Errorf("unknown blob store %q, must be local or s3", env.BlobStore)
+}
+
+// purgeTrash periodically deletes todos which have been in the trash for longer than the retention period
+func purgeTrash(db *models.DB, retention time.Duration) {
+	for range time.Tick(time.Hour) {
+		count, err := db.PurgeTrash(retention)
+		if err != nil {
+			log.Println("Error purging trash:\t", err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("Purged %d todos from the trash\n", count)
+		}
+	}
+}
+
 func ping(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "pong",
@@ -56,11 +104,41 @@ func main() {
 	if err != nil {
 		log.Fatal("Error initialising database:\t", err)
 	}
+	if db.SubtaskPolicy, err = models.ParseSubtaskPolicy(env.SubtaskPolicy); err != nil {
+		log.Fatal("Error reading SUBTASK_POLICY:\t", err)
+	}
+	if db.Blobs, err = newBlobStore(env); err != nil {
+		log.Fatal("Error initialising BLOB_STORE:\t", err)
+	}
+	maxAttachmentSize, err := strconv.ParseInt(env.MaxAttachment, 10, 64)
+	if err != nil || maxAttachmentSize <= 0 {
+		log.Fatal("Error reading MAX_ATTACHMENT_SIZE:\t", env.MaxAttachment)
+	}
+	trashRetention, err := time.ParseDuration(env.TrashRetention)
+	if err != nil {
+		log.Fatal("Error reading TRASH_RETENTION:\t", err)
+	}
+	go purgeTrash(db, trashRetention)
+	requireIfMatch, err := strconv.ParseBool(env.RequireIfMatch)
+	if err != nil {
+		log.Fatal("Error reading REQUIRE_IF_MATCH:\t", err)
+	}
+	ifMatch := handlers.RequireIfMatch(requireIfMatch)
+
+	// changes to todos are streamed to everyone who can see them, keeping enough recent events
+	// for clients which briefly lose their connection to catch up
+	hub := events.NewHub(db.GetTodoAudience, 1000, 64)
+	// changes are announced by postgres as they're committed, so that every instance of the API streams them
+	// rather than only the one which made them, and the handlers needn't publish them
+	if err = db.Listen(hub); err != nil {
+		log.Fatal("Error listening for changes:\t", err)
+	}
 
 	app := gin.Default()
 	app.GET("/ping", ping)
 
 	jwtSecret := []byte(env.JWTSecret)
+	feedPath := "/" + path.Join("api", env.APIVersion, "feeds")
 
 	// todo resources
 	todoRouter := app.Group(path.Join("api", env.APIVersion, "todos"))
@@ -68,10 +146,86 @@ func main() {
 	{
 		todoRouter.GET("/", handlers.GetAllTodos(db))
 		todoRouter.POST("/", handlers.CreateTodo(db))
-		todoRouter.GET("/:id", handlers.GetTodo(db))
-		todoRouter.PUT("/:id", handlers.UpdateTodo(db))
-		todoRouter.GET("/:id/completed", handlers.MarkTodoAsComplete(db))
-		todoRouter.DELETE("/:id", handlers.DeleteTodo(db))
+		todoRouter.POST("/:id", handlers.StaticOrID(map[string]gin.HandlerFunc{
+			"batch":  handlers.RunBatch(db),
+			"import": handlers.ImportTodos(db),
+		}, nil))
+		todoRouter.GET("/:id", handlers.StaticOrID(map[string]gin.HandlerFunc{
+			"search": handlers.SearchTodos(db),
+			"export": handlers.ExportTodos(db),
+		}, handlers.GetTodo(db)))
+		todoRouter.PUT("/:id", ifMatch, handlers.UpdateTodo(db))
+		todoRouter.PATCH("/:id", ifMatch, handlers.PatchTodo(db))
+		todoRouter.GET("/:id/completed", handlers.Deprecated(
+			"POST /todos/:id/completed", handlers.MarkTodoAsComplete(db)))
+		todoRouter.POST("/:id/completed", handlers.MarkTodoAsComplete(db))
+		todoRouter.DELETE("/:id/completed", handlers.MarkTodoAsIncomplete(db))
+		todoRouter.DELETE("/:id", ifMatch, handlers.DeleteTodo(db))
+		todoRouter.POST("/:id/move", handlers.MoveTodo(db))
+		todoRouter.GET("/:id/history", handlers.GetTodoHistory(db))
+		todoRouter.POST("/:id/tags/:tagId", handlers.AddTagToTodo(db))
+		todoRouter.DELETE("/:id/tags/:tagId", handlers.RemoveTagFromTodo(db))
+		todoRouter.GET("/:id/shares", handlers.GetShares(db, models.SharedTodo))
+		todoRouter.POST("/:id/shares", handlers.GrantShare(db, models.SharedTodo))
+		todoRouter.DELETE("/:id/shares/:userId", handlers.RevokeShare(db, models.SharedTodo))
+		todoRouter.GET("/:id/comments", handlers.GetComments(db))
+		todoRouter.POST("/:id/comments", handlers.CreateComment(db))
+		todoRouter.PUT("/:id/comments/:commentId", handlers.UpdateComment(db))
+		todoRouter.DELETE("/:id/comments/:commentId", handlers.DeleteComment(db))
+		todoRouter.GET("/:id/attachments", handlers.GetAttachments(db))
+		todoRouter.POST("/:id/attachments", handlers.UploadAttachment(db, maxAttachmentSize))
+		todoRouter.GET("/:id/attachments/:attachmentId", handlers.DownloadAttachment(db))
+		todoRouter.DELETE("/:id/attachments/:attachmentId", handlers.DeleteAttachment(db))
+	}
+
+	// deleted todos
+	trashRouter := app.Group(path.Join("api", env.APIVersion, "trash"))
+	trashRouter.Use(middleware.Authorize(jwtSecret))
+	{
+		trashRouter.GET("/", handlers.GetTrash(db))
+		trashRouter.DELETE("/", handlers.EmptyTrash(db))
+		trashRouter.POST("/:id/restore", handlers.RestoreTodo(db))
+		trashRouter.DELETE("/:id", handlers.PurgeTodo(db))
+	}
+
+	// list resources
+	listRouter := app.Group(path.Join("api", env.APIVersion, "lists"))
+	listRouter.Use(middleware.Authorize(jwtSecret))
+	{
+		listRouter.GET("/", handlers.GetAllLists(db))
+		listRouter.POST("/", handlers.CreateList(db))
+		listRouter.GET("/:id", handlers.GetList(db))
+		listRouter.GET("/:id/todos", handlers.GetListTodos(db))
+		listRouter.PUT("/:id", handlers.UpdateList(db))
+		listRouter.DELETE("/:id", handlers.DeleteList(db))
+		listRouter.GET("/:id/shares", handlers.GetShares(db, models.SharedList))
+		listRouter.POST("/:id/shares", handlers.GrantShare(db, models.SharedList))
+		listRouter.DELETE("/:id/shares/:userId", handlers.RevokeShare(db, models.SharedList))
+	}
+
+	// tag resources
+	tagRouter := app.Group(path.Join("api", env.APIVersion, "tags"))
+	tagRouter.Use(middleware.Authorize(jwtSecret))
+	{
+		tagRouter.GET("/", handlers.GetAllTags(db))
+		tagRouter.POST("/", handlers.CreateTag(db))
+		tagRouter.GET("/:id", handlers.GetTag(db))
+		tagRouter.PUT("/:id", handlers.UpdateTag(db))
+		tagRouter.DELETE("/:id", handlers.DeleteTag(db))
+	}
+
+	// server-sent events about changes to todos
+	eventsRouter := app.Group(path.Join("api", env.APIVersion, "events"))
+	eventsRouter.Use(middleware.Authorize(jwtSecret))
+	{
+		eventsRouter.GET("/", handlers.StreamEvents(hub))
+	}
+
+	// JSON-RPC over a WebSocket, for clients which keep a single connection open
+	socketRouter := app.Group(path.Join("api", env.APIVersion, "socket"))
+	socketRouter.Use(middleware.Authorize(jwtSecret))
+	{
+		socketRouter.GET("/", handlers.TodoSocket(db, hub))
 	}
 
 	// user resources
@@ -79,6 +233,30 @@ func main() {
 	{
 		userRouter.POST("/login", handlers.LoginUser(db, jwtSecret))
 		userRouter.POST("/register", handlers.RegisterUser(db, jwtSecret))
+		userRouter.POST("/feed", middleware.Authorize(jwtSecret), handlers.CreateFeedToken(db, feedPath))
+		userRouter.DELETE("/feed", middleware.Authorize(jwtSecret), handlers.RevokeFeedToken(db))
+		userRouter.POST("/caldav-password", middleware.Authorize(jwtSecret), handlers.CreateCalDAVPassword(db))
+		userRouter.DELETE("/caldav-password", middleware.Authorize(jwtSecret), handlers.RevokeCalDAVPassword(db))
+	}
+
+	// calendar feeds, authorized by the feed token in the url rather than a jwt
+	app.GET(path.Join(feedPath, ":token"), handlers.GetFeed(db))
+
+	// CalDAV sync of todos, authorized by the user's email and CalDAV password since CalDAV clients can't use a jwt
+	caldavPath := "/caldav"
+	toCalDAV := func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, caldavPath+"/") }
+	app.GET("/.well-known/caldav", toCalDAV)
+	app.Handle("PROPFIND", "/.well-known/caldav", toCalDAV)
+	caldavRouter := app.Group(caldavPath)
+	caldavRouter.Use(middleware.AuthorizeBasic("gotodos", handlers.CalendarCredentials(db)))
+	{
+		caldavRouter.OPTIONS("/*path", handlers.CalDAVOptions)
+		caldavRouter.Handle("PROPFIND", "/*path", handlers.CalDAVPropfind(db, caldavPath))
+		caldavRouter.Handle("REPORT", "/*path", handlers.CalDAVReport(db, caldavPath))
+		caldavRouter.GET("/*path", handlers.CalDAVGet(db))
+		caldavRouter.HEAD("/*path", handlers.CalDAVGet(db))
+		caldavRouter.PUT("/*path", handlers.CalDAVPut(db))
+		caldavRouter.DELETE("/*path", handlers.CalDAVDelete(db))
 	}
 
 	if err = app.Run(fmt.Sprintf(":%s", env.APIPort)); err != nil {
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+// AuthorizeBasic returns a function which blocks requests without HTTP Basic credentials which authenticate accepts,
+// for clients such as CalDAV apps which can't use a jwt. authenticate returns the id of the user the credentials
+// belong to, and whether they were accepted.
+func AuthorizeBasic(realm string, authenticate func(username, password string) (uint, bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Authorized routes require a Basic Authorization header",
+			})
+			return
+		}
+
+		userID, ok, err := authenticate(username, password)
+		if err != nil {
+			log.Println("Error checking Basic credentials:\t", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Unable to check credentials",
+			})
+			return
+		}
+		if !ok {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"status":  http.StatusUnauthorized,
+				"message": "Invalid credentials",
+			})
+			return
+		}
+
+		c.Set("userID", userID)
+		c.Next()
+	}
+}
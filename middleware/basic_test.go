@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorizeBasic(t *testing.T) {
+	t.Log(`Should only let through requests with accepted Basic credentials`)
+	gin.SetMode(gin.TestMode)
+	authenticate := func(username, password string) (uint, bool, error) {
+		if username == "broken" {
+			return 0, false, errors.New("connection refused")
+		}
+		return 3, username == "test@google.com" && password == "secret", nil
+	}
+
+	tests := []struct {
+		username, password string
+		code               int
+	}{
+		{"test@google.com", "secret", http.StatusOK},
+		{"test@google.com", "guess", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+		{"broken", "secret", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		mockContext, _ := gin.CreateTestContext(recorder)
+		mockContext.Request, _ = http.NewRequest("PROPFIND", "/caldav/", nil)
+		if len(test.username) > 0 {
+			mockContext.Request.SetBasicAuth(test.username, test.password)
+		}
+
+		AuthorizeBasic("gotodos", authenticate)(mockContext)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: expected status code %d but received %d", test.username, test.code, recorder.Code)
+		}
+		if test.code == http.StatusUnauthorized && len(recorder.Header().Get("WWW-Authenticate")) == 0 {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", test.username)
+		}
+		if userID, _ := mockContext.Get("userID"); test.code == http.StatusOK && userID != uint(3) {
+			t.Errorf("Expected the user's id to be set but received %v", userID)
+		}
+	}
+}
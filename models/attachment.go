@@ -0,0 +1,207 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Attachment defines the shape of a file uploaded to a todo. The contents are kept in the DB's BlobStore under Key.
+type Attachment struct {
+	ID          uint
+	TodoID      uint
+	UserID      uint // the uploader
+	Filename    string
+	ContentType string
+	Size        int64
+	Key         string
+	CreatedAt   time.Time
+}
+
+// Errors
+var (
+	ErrorNoBlobStore     = errors.New("Attachments are not enabled")
+	ErrorEmptyAttachment = errors.New("Attachments must have a filename and some content")
+)
+
+// Serialize converts the attachment struct to a simple string map for conversion to JSON.
+// The storage key is an implementation detail and is left out.
+func (a *Attachment) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":          a.ID,
+		"todoId":      a.TodoID,
+		"userId":      a.UserID,
+		"filename":    a.Filename,
+		"contentType": a.ContentType,
+		"size":        a.Size,
+		"createdAt":   a.CreatedAt,
+	}
+}
+
+// newAttachmentKey makes an unguessable storage key for a new attachment on a todo
+func newAttachmentKey(todoID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("todos/%d/%s", todoID, hex.EncodeToString(b)), nil
+}
+
+// CreateAttachment stores the content of a file in the blob store and records it against a todo the uploader can edit.
+// The row is only committed once the blob has been stored.
+func (db *DB) CreateAttachment(a *Attachment, content io.Reader) error {
+	if db.Blobs == nil {
+		return ErrorNoBlobStore
+	}
+	if len(a.Filename) == 0 || a.Size <= 0 {
+		return ErrorEmptyAttachment
+	}
+	key, err := newAttachmentKey(a.TodoID)
+	if err != nil {
+		return err
+	}
+	a.Key = key
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	sqlStatement := `
+	INSERT INTO attachments (todo_id, user_id, filename, content_type, size, storage_key)
+	SELECT id, $2, $3, $4, $5, $6 FROM todos WHERE id = $1 AND ` + accessibleBy("$2", RoleEditor) + `
+	RETURNING id, created_at;`
+	err = tx.QueryRow(sqlStatement, a.TodoID, a.UserID, a.Filename, a.ContentType, a.Size, a.Key).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = db.Blobs.Put(a.Key, content, a.Size, a.ContentType); err != nil {
+		tx.Rollback()
+		db.Blobs.Delete(a.Key)
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		db.Blobs.Delete(a.Key)
+		return err
+	}
+	return nil
+}
+
+// attachmentColumns are the columns read by scanAttachment
+const attachmentColumns = `attachments.id, attachments.todo_id, attachments.user_id, attachments.filename,
+	attachments.content_type, attachments.size, attachments.storage_key, attachments.created_at`
+
+// scanAttachment reads a single attachment selected using attachmentColumns
+func scanAttachment(row rowScanner, a *Attachment) error {
+	return row.Scan(&a.ID, &a.TodoID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.Key, &a.CreatedAt)
+}
+
+// GetAttachments finds all the attachments on a todo which the user can see in an sql database, oldest first
+func (db *DB) GetAttachments(todoID, userID uint) ([]*Attachment, error) {
+	sqlStatement := `
+	SELECT ` + attachmentColumns + `
+	FROM attachments JOIN todos ON todos.id = attachments.todo_id
+	WHERE attachments.todo_id = $1 AND ` + accessibleBy("$2", RoleViewer) + `
+	ORDER BY attachments.id;`
+	rows, err := db.Query(sqlStatement, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]*Attachment, 0)
+	for rows.Next() {
+		a := new(Attachment)
+		if err = scanAttachment(rows, a); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// OpenAttachment finds a single attachment on a todo the user can see and opens its contents, which the caller must close
+func (db *DB) OpenAttachment(attachmentID, todoID, userID uint) (*Attachment, io.ReadCloser, error) {
+	if db.Blobs == nil {
+		return nil, nil, ErrorNoBlobStore
+	}
+	sqlStatement := `
+	SELECT ` + attachmentColumns + `
+	FROM attachments JOIN todos ON todos.id = attachments.todo_id
+	WHERE attachments.id = $1 AND attachments.todo_id = $2 AND ` + accessibleBy("$3", RoleViewer) + `;`
+	a := new(Attachment)
+	if err := scanAttachment(db.QueryRow(sqlStatement, attachmentID, todoID, userID), a); err != nil {
+		return nil, nil, err
+	}
+	content, err := db.Blobs.Get(a.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, content, nil
+}
+
+// DeleteAttachment removes a single attachment from a todo the user can edit, along with its contents
+func (db *DB) DeleteAttachment(attachmentID, todoID, userID uint) (uint, error) {
+	sqlStatement := `
+	DELETE FROM attachments
+	USING todos
+	WHERE attachments.todo_id = todos.id
+	AND attachments.id = $1 AND attachments.todo_id = $2 AND ` + accessibleBy("$3", RoleEditor) + `
+	RETURNING attachments.storage_key;`
+
+	var key string
+	err := db.QueryRow(sqlStatement, attachmentID, todoID, userID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return 0, ErrorRowsUnaffected
+	} else if err != nil {
+		return 0, err
+	}
+	db.deleteBlobs([]string{key})
+	return attachmentID, nil
+}
+
+// attachmentKeys finds the storage keys of the attachments on the todos matching the roots condition
+// and all their descendants, which are about to be removed by the foreign keys
+func attachmentKeys(tx *sql.Tx, roots string, args ...interface{}) ([]string, error) {
+	sqlStatement := `
+	WITH RECURSIVE descendants AS (
+		SELECT id FROM todos WHERE ` + roots + `
+		UNION
+		SELECT todos.id FROM todos JOIN descendants ON todos.parent_id = descendants.id
+	)
+	SELECT storage_key FROM attachments WHERE todo_id IN (SELECT id FROM descendants);`
+	rows, err := tx.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteBlobs removes the contents of attachments whose rows have already been deleted.
+// It is best effort as a leftover blob is unreachable once its row is gone.
+func (db *DB) deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := db.Blobs.Delete(key); err != nil {
+			log.Println("Error deleting the contents of an attachment:\t", err)
+		}
+	}
+}
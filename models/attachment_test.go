@@ -0,0 +1,149 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vancelongwill/gotodos/storage"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockBlobs is an in memory BlobStore
+type mockBlobs map[string][]byte
+
+func (b mockBlobs) Put(key string, content io.Reader, size int64, contentType string) error {
+	data, err := ioutil.ReadAll(content)
+	b[key] = data
+	return err
+}
+
+func (b mockBlobs) Get(key string) (io.ReadCloser, error) {
+	data, ok := b[key]
+	if !ok {
+		return nil, storage.ErrorBlobNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b mockBlobs) Delete(key string) error {
+	delete(b, key)
+	return nil
+}
+
+var attachmentTableRows = []string{"id", "todo_id", "user_id", "filename", "content_type", "size", "storage_key", "created_at"}
+
+func TestCreateAttachment(t *testing.T) {
+	t.Log(`should store the blob and record it against todos the uploader can edit`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	attachment := Attachment{TodoID: 5, UserID: 2, Filename: "notes.txt", ContentType: "text/plain; charset=utf-8", Size: 5}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO attachments \(todo_id, user_id, filename, content_type, size, storage_key\) `+
+		`SELECT id, \$2, \$3, \$4, \$5, \$6 FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$2 OR EXISTS .+ AND shares.role = 'editor'\)\)\) `+
+		`RETURNING id, created_at`).
+		WithArgs(attachment.TodoID, attachment.UserID, attachment.Filename, attachment.ContentType, attachment.Size, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO attachments .+`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	blobs := mockBlobs{}
+	db := DB{DB: mockDB, Blobs: blobs}
+	if err := db.CreateAttachment(&attachment, strings.NewReader("hello")); err != nil {
+		t.Errorf("failed to create attachment: %s", err.Error())
+	}
+	if !strings.HasPrefix(attachment.Key, "todos/5/") || string(blobs[attachment.Key]) != "hello" {
+		t.Errorf("Expected the blob to be stored under the todo but received %v", blobs)
+	}
+
+	other := Attachment{TodoID: 6, UserID: 2, Filename: "notes.txt", Size: 5}
+	if err := db.CreateAttachment(&other, strings.NewReader("hello")); err != sql.ErrNoRows {
+		t.Errorf("Expected no rows error but received %v", err)
+	}
+	if len(blobs) != 1 {
+		t.Errorf("Expected only one blob to be stored but received %v", blobs)
+	}
+	if err := db.CreateAttachment(&Attachment{TodoID: 5, UserID: 2, Filename: "empty.txt"}, strings.NewReader("")); err != ErrorEmptyAttachment {
+		t.Errorf("Expected empty attachment error but received %v", err)
+	}
+	if err := (&DB{DB: mockDB}).CreateAttachment(&attachment, strings.NewReader("hello")); err != ErrorNoBlobStore {
+		t.Errorf("Expected no blob store error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOpenAttachment(t *testing.T) {
+	t.Log(`should open the contents of attachments on todos the user can see`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`SELECT attachments.id, .+ FROM attachments JOIN todos ON todos.id = attachments.todo_id `+
+		`WHERE attachments.id = \$1 AND attachments.todo_id = \$2 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$3 OR EXISTS .+\)\)\)`).
+		WithArgs(1, 5, 2).
+		WillReturnRows(sqlmock.NewRows(attachmentTableRows).
+			AddRow(1, 5, 2, "notes.txt", "text/plain", 5, "todos/5/abc", time.Now()))
+
+	db := DB{DB: mockDB, Blobs: mockBlobs{"todos/5/abc": []byte("hello")}}
+	attachment, content, err := db.OpenAttachment(1, 5, 2)
+	if err != nil {
+		t.Fatalf("failed to open attachment: %s", err.Error())
+	}
+	defer content.Close()
+	data, _ := ioutil.ReadAll(content)
+	if attachment.Filename != "notes.txt" || string(data) != "hello" {
+		t.Errorf("Unexpected attachment %+v with content %s", attachment, data)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	t.Log(`should delete the row and then the blob of an attachment`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`DELETE FROM attachments USING todos WHERE attachments.todo_id = todos.id `+
+		`AND attachments.id = \$1 AND attachments.todo_id = \$2 AND .+ RETURNING attachments.storage_key`).
+		WithArgs(1, 5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("todos/5/abc"))
+	mock.ExpectQuery(`DELETE FROM attachments .+`).
+		WithArgs(1, 5, 3).
+		WillReturnError(sql.ErrNoRows)
+
+	blobs := mockBlobs{"todos/5/abc": []byte("hello")}
+	db := DB{DB: mockDB, Blobs: blobs}
+	if _, err := db.DeleteAttachment(1, 5, 2); err != nil {
+		t.Errorf("failed to delete attachment: %s", err.Error())
+	}
+	if len(blobs) != 0 {
+		t.Errorf("Expected the blob to be deleted but received %v", blobs)
+	}
+	if _, err := db.DeleteAttachment(1, 5, 3); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Batch actions
+const (
+	BatchCreate   = "create"
+	BatchUpdate   = "update"
+	BatchComplete = "complete"
+	BatchReopen   = "reopen"
+	BatchDelete   = "delete"
+	BatchMove     = "move"
+	BatchTag      = "tag"
+)
+
+// Errors
+var (
+	ErrorInvalidBatchAction = errors.New("Batch action must be one of create, update, complete, reopen, delete, move or tag")
+	ErrorBatchRolledBack    = errors.New("Batch was rolled back because another operation failed")
+)
+
+// BatchOperation is a single change to one of a user's todos as part of a batch
+type BatchOperation struct {
+	Action   string
+	TodoID   uint      // the todo to change, unused when creating
+	Todo     Todo      // the todo to create
+	Patch    TodoPatch // the changes to make when updating
+	AfterID  *uint     // the neighbours to move the todo between
+	BeforeID *uint
+	TagID    uint // the tag to attach
+	Version  int  // when deleting, the version the todo must be at, or zero for any. Updates use the patch's Version
+}
+
+// BatchResult is the outcome of a single operation in a batch
+type BatchResult struct {
+	TodoID uint
+	Todo   *Todo // the todo after the change, nil when deleting or tagging
+	Err    error
+}
+
+// RunBatch applies a list of operations to a user's todos in a single transaction, returning the result of each in order.
+// Unless the batch is atomic each operation runs in its own savepoint, so one failing doesn't prevent the others.
+// When an atomic batch fails nothing is changed, and every other operation's result is ErrorBatchRolledBack.
+func (db *DB) RunBatch(userID uint, ops []BatchOperation, atomic bool, currentTime time.Time) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if !atomic {
+			if _, err = tx.Exec(`SAVEPOINT batch_operation;`); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+
+		results[i] = db.runBatchOperation(tx, userID, op, currentTime)
+		if results[i].Err == nil {
+			if !atomic {
+				_, err = tx.Exec(`RELEASE SAVEPOINT batch_operation;`)
+			}
+		} else if atomic {
+			tx.Rollback()
+			for j := range results {
+				if j != i {
+					results[j] = BatchResult{TodoID: ops[j].TodoID, Err: ErrorBatchRolledBack}
+				}
+			}
+			return results, nil
+		} else {
+			_, err = tx.Exec(`ROLLBACK TO SAVEPOINT batch_operation;`)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	todos := make([]*Todo, 0, len(results))
+	for _, result := range results {
+		if result.Todo != nil {
+			todos = append(todos, result.Todo)
+		}
+	}
+	if err = db.loadTags(todos); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// runBatchOperation applies a single operation of a batch as part of its transaction
+func (db *DB) runBatchOperation(tx *sql.Tx, userID uint, op BatchOperation, currentTime time.Time) BatchResult {
+	result := BatchResult{TodoID: op.TodoID}
+	switch op.Action {
+	case BatchCreate:
+		todo := op.Todo
+		todo.UserID = userID
+		if result.Err = createTodo(tx, &todo); result.Err == nil {
+			result.TodoID, result.Todo = todo.ID, &todo
+		}
+	case BatchUpdate:
+		result.Todo, result.Err = db.patchTodo(tx, op.TodoID, userID, op.Patch, currentTime)
+	case BatchComplete:
+		result.Todo, result.Err = db.completeTodo(tx, op.TodoID, userID, currentTime)
+	case BatchReopen:
+		result.Todo, result.Err = reopenTodo(tx, op.TodoID, userID, currentTime)
+	case BatchDelete:
+		result.Err = db.deleteTodo(tx, op.TodoID, userID, op.Version)
+	case BatchMove:
+		result.Todo, result.Err = moveTodo(tx, op.TodoID, userID, op.AfterID, op.BeforeID)
+	case BatchTag:
+		result.Err = addTagToTodo(tx, op.TodoID, op.TagID, userID)
+	default:
+		result.Err = ErrorInvalidBatchAction
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestRunBatch(t *testing.T) {
+	t.Log(`Should keep the successful operations of a batch when another fails`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	userID := uint(2)
+	currentTime := time.Now()
+	ops := []BatchOperation{
+		{Action: BatchReopen, TodoID: 5},
+		{Action: BatchDelete, TodoID: 6},
+		{Action: "archive", TodoID: 7},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectLockTodo(mock, 5, userID,
+		5, "title", nil, currentTime, currentTime, nil, userID, currentTime, true, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos SET completed_at = NULL.+`).
+		WithArgs(5, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(5, "title", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, 5, userID, EventReopened)
+	mock.ExpectExec(`RELEASE SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`WITH RECURSIVE descendants AS .+ UPDATE todos SET deleted_at = NOW\(\)`).
+		WithArgs(6, userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch_operation`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	results, err := db.RunBatch(userID, ops, false, currentTime)
+	if err != nil {
+		t.Fatalf("failed to run batch: %s", err.Error())
+	}
+	if results[0].Err != nil || results[0].Todo == nil || results[0].Todo.IsDone {
+		t.Errorf("Expected the todo to be reopened but received %v", results[0])
+	}
+	if results[1].Err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", results[1].Err)
+	}
+	if results[2].Err != ErrorInvalidBatchAction {
+		t.Errorf("Expected invalid batch action error but received %v", results[2].Err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRunAtomicBatch(t *testing.T) {
+	t.Log(`Should roll back every operation of an atomic batch when one fails`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	userID := uint(2)
+	ops := []BatchOperation{
+		{Action: BatchTag, TodoID: 5, TagID: 1},
+		{Action: BatchTag, TodoID: 6, TagID: 1},
+		{Action: BatchDelete, TodoID: 7},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO todos_tags .+`).
+		WithArgs(1, 5, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO todos_tags .+`).
+		WithArgs(1, 6, userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	results, err := db.RunBatch(userID, ops, true, time.Now())
+	if err != nil {
+		t.Fatalf("failed to run batch: %s", err.Error())
+	}
+	expected := []error{ErrorBatchRolledBack, ErrorRowsUnaffected, ErrorBatchRolledBack}
+	for i, result := range results {
+		if result.Err != expected[i] {
+			t.Errorf("Expected operation %d to fail with %v but received %v", i, expected[i], result.Err)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
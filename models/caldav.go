@@ -0,0 +1,279 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Errors
+var (
+	ErrorReservedCalendarName = errors.New("Resource names like todo-<id>.ics are reserved for todos which weren't created by a CalDAV client")
+)
+
+// CalendarObject is a todo as a CalDAV resource. Todos created by CalDAV clients keep the resource name and
+// iCalendar UID the client gave them, while other todos have ones made from their id.
+type CalendarObject struct {
+	Todo      *Todo
+	Name      string // the last segment of the resource's url, e.g. "todo-4.ics"
+	UID       string
+	ParentUID sql.NullString // the UID of the todo's parent, for subtasks
+}
+
+// DefaultTodoUID is the iCalendar UID of a todo which wasn't created by a CalDAV client
+func DefaultTodoUID(todoID uint) string {
+	return fmt.Sprintf("todo-%d@gotodos", todoID)
+}
+
+// calendarObjectName is the resource name of a todo, matching DefaultTodoUID for todos the client didn't name
+const calendarObjectName = `COALESCE(caldav_name, 'todo-' || id || '.ics')`
+
+// defaultObjectName matches the resource names made by calendarObjectName, which clients can't give new todos
+var defaultObjectName = regexp.MustCompile(`^todo-[0-9]+\.ics$`)
+
+// calendarObjectColumns are the columns read by scanCalendarObject
+const calendarObjectColumns = todoColumns + `, ` + calendarObjectName + `,
+	COALESCE(ical_uid, 'todo-' || id || '@gotodos'),
+	(SELECT COALESCE(parents.ical_uid, 'todo-' || parents.id || '@gotodos') FROM todos AS parents WHERE parents.id = todos.parent_id)`
+
+// scanCalendarObject reads a single todo selected using calendarObjectColumns
+func scanCalendarObject(row rowScanner) (*CalendarObject, error) {
+	o := new(CalendarObject)
+	t, err := scanTodo(row, &o.Name, &o.UID, &o.ParentUID)
+	if err != nil {
+		return nil, err
+	}
+	o.Todo = t
+	return o, nil
+}
+
+// GetCalendarObjects finds a user's todos as CalDAV resources, including their tags, in order of id.
+// Only the todos with the given resource names are found, unless names is nil.
+func (db *DB) GetCalendarObjects(userID uint, names []string) ([]*CalendarObject, error) {
+	args := []interface{}{userID}
+	condition := ""
+	if names != nil {
+		args = append(args, pq.Array(names))
+		condition = ` AND ` + calendarObjectName + ` = ANY($2)`
+	}
+	sqlStatement := `
+	SELECT ` + calendarObjectColumns + ` FROM todos
+	WHERE user_id = $1 AND deleted_at IS NULL` + condition + `
+	ORDER BY id;`
+	rows, err := db.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := make([]*CalendarObject, 0)
+	todos := make([]*Todo, 0)
+	for rows.Next() {
+		o, err := scanCalendarObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+		todos = append(todos, o.Todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return objects, db.loadTags(todos)
+}
+
+// GetCalendarTag returns a tag which changes whenever any of a user's todos is created, changed, deleted or purged,
+// so that CalDAV clients can tell when they need to sync. The tag is taken from a sequence by a trigger on every write,
+// so it never repeats.
+func (db *DB) GetCalendarTag(userID uint) (string, error) {
+	sqlStatement := `
+	SELECT calendar_tag FROM users
+	WHERE id = $1;`
+	var tag int64
+	if err := db.QueryRow(sqlStatement, userID).Scan(&tag); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(tag, 10), nil
+}
+
+// findCalendarObject finds the id of the user's todo with a resource name, locking it for the rest of the transaction
+func findCalendarObject(tx *sql.Tx, userID uint, name string) (uint, error) {
+	sqlStatement := `
+	SELECT id FROM todos
+	WHERE user_id = $1 AND deleted_at IS NULL AND ` + calendarObjectName + ` = $2
+	FOR UPDATE;`
+	var todoID uint
+	err := tx.QueryRow(sqlStatement, userID, name).Scan(&todoID)
+	return todoID, err
+}
+
+// PutCalendarObject creates or replaces the todo with the object's resource name, along with its tags, which are
+// created as needed. A non-zero version must match that of an existing todo, and when mustCreate is set there must
+// be no existing todo, otherwise ErrorVersionMismatch is returned. Replacing a todo changes it as PatchTodo does,
+// but leaves its parent and list as they were. It reports whether the todo was created.
+func (db *DB) PutCalendarObject(o *CalendarObject, version int, mustCreate bool, currentTime time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	userID, tags := o.Todo.UserID, o.Todo.Tags
+	todoID, err := findCalendarObject(tx, userID, o.Name)
+	created := err == sql.ErrNoRows
+	if (created && version != 0) || (err == nil && mustCreate) {
+		err = ErrorVersionMismatch
+	} else if created && defaultObjectName.MatchString(o.Name) {
+		// the name would clash with that of the todo with the id, once it's created
+		err = ErrorReservedCalendarName
+	} else if created {
+		err = createCalendarObject(tx, o)
+	} else if err == nil {
+		t := o.Todo
+		o.Todo, err = db.patchTodo(tx, todoID, userID, TodoPatch{
+			Title: &t.Title, Note: &t.Note, DueAt: &t.DueAt, IsDone: &t.IsDone,
+			Recurrence: &t.Recurrence, Priority: &t.Priority, Version: version,
+		}, currentTime)
+	}
+	if err == nil {
+		err = replaceTags(tx, o.Todo.ID, userID, tags)
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return created, db.loadTags([]*Todo{o.Todo})
+}
+
+// createCalendarObject inserts the todo of a new CalDAV resource as part of a transaction, see PutCalendarObject.
+// A todo in the trash which had the same name loses it, so that it can't clash when it is restored.
+func createCalendarObject(tx *sql.Tx, o *CalendarObject) error {
+	sqlStatement := `
+	UPDATE todos SET caldav_name = NULL
+	WHERE user_id = $1 AND caldav_name = $2 AND deleted_at IS NOT NULL;`
+	if _, err := tx.Exec(sqlStatement, o.Todo.UserID, o.Name); err != nil {
+		return err
+	}
+	if err := createTodo(tx, o.Todo); err != nil {
+		return err
+	}
+
+	sqlStatement = `
+	UPDATE todos SET caldav_name = $2, ical_uid = $3
+	WHERE id = $1
+	RETURNING version;`
+	return tx.QueryRow(sqlStatement, o.Todo.ID, o.Name, o.UID).Scan(&o.Todo.Version)
+}
+
+// replaceTags attaches exactly the named tags to a todo as part of a transaction, creating any the user doesn't have
+func replaceTags(tx *sql.Tx, todoID, userID uint, tags []Tag) error {
+	sqlStatement := `
+	DELETE FROM todos_tags
+	WHERE todo_id = $1;`
+	if _, err := tx.Exec(sqlStatement, todoID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		tagID, err := ensureTag(tx, tag.Name, userID)
+		if err != nil {
+			return err
+		}
+		if err = addTagToTodo(tx, todoID, tagID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCalendarObject moves the todo with a resource name to the trash as DeleteTodo does, returning its id,
+// or sql.ErrNoRows when the user has no such todo
+func (db *DB) DeleteCalendarObject(userID uint, name string, version int) (uint, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	todoID, err := findCalendarObject(tx, userID, name)
+	if err == nil {
+		err = db.deleteTodo(tx, todoID, userID, version)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return todoID, tx.Commit()
+}
+
+// CalDAVPassword lets CalDAV clients, which can only log in with a username and password, read and change a user's
+// todos until it is revoked. It is kept apart from the feed token, which only lets calendar apps read them.
+type CalDAVPassword struct {
+	UserID    uint
+	Password  string // only known when the password has just been created
+	CreatedAt time.Time
+}
+
+// Serialize converts the CalDAV password struct to a simple string map for conversion to JSON
+func (p *CalDAVPassword) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"password":  p.Password,
+		"createdAt": p.CreatedAt,
+	}
+}
+
+// CreateCalDAVPassword makes a new unguessable CalDAV password for a user, revoking any they had before
+func (db *DB) CreateCalDAVPassword(userID uint) (*CalDAVPassword, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	p := &CalDAVPassword{UserID: userID, Password: hex.EncodeToString(b)}
+
+	sqlStatement := `
+	INSERT INTO caldav_passwords (user_id, password_hash)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, created_at = NOW()
+	RETURNING created_at;`
+	if err := db.QueryRow(sqlStatement, userID, hashToken(p.Password)).Scan(&p.CreatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// RevokeCalDAVPassword deletes a user's CalDAV password, so that clients using it can no longer log in
+func (db *DB) RevokeCalDAVPassword(userID uint) error {
+	sqlStatement := `
+	DELETE FROM caldav_passwords
+	WHERE user_id = $1;`
+	res, err := db.Exec(sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrorRowsUnaffected
+	}
+	return nil
+}
+
+// AuthenticateCalendarUser finds the user with an email whose CalDAV password is the given one.
+// It returns sql.ErrNoRows when they don't match.
+func (db *DB) AuthenticateCalendarUser(email, password string) (uint, error) {
+	sqlStatement := `
+	SELECT users.id FROM users
+	JOIN caldav_passwords ON caldav_passwords.user_id = users.id
+	WHERE users.email = $1 AND caldav_passwords.password_hash = $2;`
+	var userID uint
+	err := db.QueryRow(sqlStatement, email, hashToken(password)).Scan(&userID)
+	return userID, err
+}
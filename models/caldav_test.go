@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+// calendarObjectRows are the columns selected by calendarObjectColumns
+var calendarObjectRows = append(append([]string{}, todoTableRows...), "caldav_name", "ical_uid", "parent_uid")
+
+func TestGetCalendarObjects(t *testing.T) {
+	t.Log(`Should find the user's todos by resource name, with their UIDs`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE user_id = \$1 AND deleted_at IS NULL AND COALESCE\(caldav_name, 'todo-' \|\| id \|\| '.ics'\) = ANY\(\$2\) ORDER BY id`).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(calendarObjectRows).
+			AddRow(4, "buy milk", nil, now, now, nil, 1, nil, false, nil, 2, 0, "i", nil, 3, 0, "todo-4.ics", "todo-4@gotodos", "abc@example.com"))
+	mock.ExpectQuery(`SELECT todos_tags.todo_id, .+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows).AddRow(4, 7, "groceries", 1, now))
+
+	db := DB{DB: mockDB}
+	objects, err := db.GetCalendarObjects(1, []string{"todo-4.ics", "missing.ics"})
+	if err != nil {
+		t.Fatalf("failed to get calendar objects: %s", err.Error())
+	}
+	if len(objects) != 1 || objects[0].Name != "todo-4.ics" || objects[0].UID != "todo-4@gotodos" ||
+		objects[0].ParentUID.String != "abc@example.com" || len(objects[0].Todo.Tags) != 1 {
+		t.Errorf("Expected one calendar object with its tag but received %+v", objects)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetCalendarTag(t *testing.T) {
+	t.Log(`Should get the calendar tag of the user`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`SELECT calendar_tag FROM users WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"calendar_tag"}).AddRow(37))
+
+	db := DB{DB: mockDB}
+	if ctag, err := db.GetCalendarTag(1); err != nil || ctag != "37" {
+		t.Errorf("Expected the tag 37 but received %q, %v", ctag, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPutCalendarObject(t *testing.T) {
+	t.Log(`Should create a todo with the client's resource name, UID and tags`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	userID := uint(1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM todos WHERE user_id = \$1 AND deleted_at IS NULL AND .+ = \$2 FOR UPDATE`).
+		WithArgs(userID, "abc.ics").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(`UPDATE todos SET caldav_name = NULL WHERE user_id = \$1 AND caldav_name = \$2 AND deleted_at IS NOT NULL`).
+		WithArgs(userID, "abc.ics").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectEnsureInbox(mock, userID)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\), ''\) FROM todos`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("i"))
+	mock.ExpectQuery(`INSERT INTO todos .+`).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(5, "buy milk", nil, now, now, nil, userID, nil, false, nil, nil, 0, "r", 1, 1, 0))
+	expectTodoEvent(mock, 5, userID, EventCreated)
+	mock.ExpectQuery(`UPDATE todos SET caldav_name = \$2, ical_uid = \$3 WHERE id = \$1 RETURNING version`).
+		WithArgs(5, "abc.ics", "abc@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectExec(`DELETE FROM todos_tags WHERE todo_id = \$1`).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO tags .+ RETURNING id`).
+		WithArgs("groceries", userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`INSERT INTO todos_tags .+`).
+		WithArgs(7, 5, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT todos_tags.todo_id, .+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows).AddRow(5, 7, "groceries", userID, now))
+
+	db := DB{DB: mockDB}
+	o := &CalendarObject{Name: "abc.ics", UID: "abc@example.com",
+		Todo: &Todo{UserID: userID, Title: MakeNullString("buy milk"), Tags: []Tag{{Name: "groceries"}}}}
+	created, err := db.PutCalendarObject(o, 0, true, now)
+	if err != nil {
+		t.Fatalf("failed to put calendar object: %s", err.Error())
+	}
+	if !created || o.Todo.ID != 5 || o.Todo.Version != 2 || len(o.Todo.Tags) != 1 {
+		t.Errorf("Expected the todo to be created with its tag but received %+v", o.Todo)
+	}
+
+	t.Log(`Should refuse to replace a todo when it must be created, or is at another version`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM todos .+ FOR UPDATE`).
+		WithArgs(userID, "abc.ics").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM todos .+ FOR UPDATE`).
+		WithArgs(userID, "abc.ics").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	expectLockTodo(mock, 5, userID, 5, "buy milk", nil, now, now, nil, userID, nil, false, nil, nil, 0, "r", 1, 3, 0)
+	mock.ExpectRollback()
+
+	if _, err = db.PutCalendarObject(o, 0, true, now); err != ErrorVersionMismatch {
+		t.Errorf("Expected ErrorVersionMismatch for an existing todo but received %v", err)
+	}
+	if _, err = db.PutCalendarObject(o, 2, false, now); err != ErrorVersionMismatch {
+		t.Errorf("Expected ErrorVersionMismatch for another version but received %v", err)
+	}
+
+	t.Log(`Should refuse to create a todo with a name reserved for todos which weren't created by CalDAV clients`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM todos .+ FOR UPDATE`).
+		WithArgs(userID, "todo-99.ics").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	o = &CalendarObject{Name: "todo-99.ics", UID: "abc@example.com", Todo: &Todo{UserID: userID, Title: MakeNullString("buy milk")}}
+	if _, err = db.PutCalendarObject(o, 0, false, now); err != ErrorReservedCalendarName {
+		t.Errorf("Expected ErrorReservedCalendarName but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteCalendarObject(t *testing.T) {
+	t.Log(`Should not delete a todo which doesn't exist`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM todos .+ FOR UPDATE`).
+		WithArgs(1, "missing.ics").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if _, err := db.DeleteCalendarObject(1, "missing.ics", 0); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateCalDAVPassword(t *testing.T) {
+	t.Log(`Should store only the hash of a new CalDAV password`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO caldav_passwords \(user_id, password_hash\) VALUES \(\$1, \$2\) ON CONFLICT \(user_id\) DO UPDATE .+ RETURNING created_at`).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	db := DB{DB: mockDB}
+	p, err := db.CreateCalDAVPassword(1)
+	if err != nil {
+		t.Fatalf("failed to create CalDAV password: %s", err.Error())
+	}
+	if len(p.Password) != 64 || p.CreatedAt != now {
+		t.Errorf("Expected a 64 character password but received %+v", p)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevokeCalDAVPassword(t *testing.T) {
+	t.Log(`Should delete the user's CalDAV password`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`DELETE FROM caldav_passwords WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM caldav_passwords .+`).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if err := db.RevokeCalDAVPassword(1); err != nil {
+		t.Errorf("failed to revoke CalDAV password: %s", err.Error())
+	}
+	if err := db.RevokeCalDAVPassword(2); err != ErrorRowsUnaffected {
+		t.Errorf("Expected ErrorRowsUnaffected without a password but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAuthenticateCalendarUser(t *testing.T) {
+	t.Log(`Should find the user whose email and CalDAV password match`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`SELECT users.id FROM users JOIN caldav_passwords .+ WHERE users.email = \$1 AND caldav_passwords.password_hash = \$2`).
+		WithArgs("test@google.com", hashToken("secret")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	db := DB{DB: mockDB}
+	if userID, err := db.AuthenticateCalendarUser("test@google.com", "secret"); err != nil || userID != 3 {
+		t.Errorf("Expected user 3 but received %d, %v", userID, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Comment defines the shape of a comment left on a todo by its owner or a user it is shared with
+type Comment struct {
+	ID         uint
+	TodoID     uint
+	Author     User
+	Body       string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+// Errors
+var (
+	ErrorEmptyComment = errors.New("Comment must have a non empty body")
+)
+
+// Serialize converts the comment struct to a simple string map for conversion to JSON
+func (c *Comment) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":         c.ID,
+		"todoId":     c.TodoID,
+		"body":       c.Body,
+		"createdAt":  c.CreatedAt,
+		"modifiedAt": c.ModifiedAt,
+		"author":     c.Author.Serialize(),
+	}
+}
+
+// CreateComment inserts a single comment into an sql database, provided its author can see the todo.
+// The author's details are read back along with the new comment.
+func (db *DB) CreateComment(c *Comment) error {
+	if len(c.Body) == 0 {
+		return ErrorEmptyComment
+	}
+	sqlStatement := `
+	WITH comment AS (
+		INSERT INTO comments (todo_id, user_id, body)
+		SELECT id, $2, $3 FROM todos WHERE id = $1 AND ` + accessibleBy("$2", RoleViewer) + `
+		RETURNING id, user_id, created_at, modified_at
+	)
+	SELECT comment.id, comment.created_at, comment.modified_at, users.first_name, users.last_name, users.email
+	FROM comment JOIN users ON users.id = comment.user_id;`
+
+	return db.QueryRow(sqlStatement, c.TodoID, c.Author.ID, c.Body).Scan(&c.ID, &c.CreatedAt, &c.ModifiedAt,
+		&c.Author.FirstName, &c.Author.LastName, &c.Author.Email)
+}
+
+// GetComments finds all the comments on a todo which the user can see in an sql database, oldest first
+func (db *DB) GetComments(todoID, userID uint) ([]*Comment, error) {
+	sqlStatement := `
+	SELECT comments.id, comments.todo_id, comments.body, comments.created_at, comments.modified_at,
+	users.id, users.first_name, users.last_name, users.email
+	FROM comments
+	JOIN users ON users.id = comments.user_id
+	JOIN todos ON todos.id = comments.todo_id
+	WHERE comments.todo_id = $1 AND ` + accessibleBy("$2", RoleViewer) + `
+	ORDER BY comments.id;`
+	rows, err := db.Query(sqlStatement, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]*Comment, 0)
+	for rows.Next() {
+		c := new(Comment)
+		err = rows.Scan(&c.ID, &c.TodoID, &c.Body, &c.CreatedAt, &c.ModifiedAt,
+			&c.Author.ID, &c.Author.FirstName, &c.Author.LastName, &c.Author.Email)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// UpdateComment changes the body of a single comment in an sql database.
+// Only the author may edit a comment, and only while they can still see the todo.
+func (db *DB) UpdateComment(c Comment) (*Comment, error) {
+	if len(c.Body) == 0 {
+		return nil, ErrorEmptyComment
+	}
+	sqlStatement := `
+	UPDATE comments
+	SET body = $4, modified_at = $5
+	WHERE id = $1 AND todo_id = $2 AND user_id = $3
+	AND EXISTS (SELECT 1 FROM todos WHERE todos.id = comments.todo_id AND ` + accessibleBy("$3", RoleViewer) + `);`
+
+	res, err := db.Exec(sqlStatement, c.ID, c.TodoID, c.Author.ID, c.Body, c.ModifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if count != 1 {
+		return nil, ErrorRowsUnaffected
+	}
+	return &c, nil
+}
+
+// DeleteComment removes a single comment from an sql database. Comments may be deleted by their author or the todo's owner.
+func (db *DB) DeleteComment(commentID, todoID, userID uint) (uint, error) {
+	sqlStatement := `
+	DELETE FROM comments
+	USING todos
+	WHERE comments.todo_id = todos.id
+	AND comments.id = $1 AND comments.todo_id = $2
+	AND (comments.user_id = $3 OR todos.user_id = $3);`
+
+	res, err := db.Exec(sqlStatement, commentID, todoID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count != 1 {
+		return 0, ErrorRowsUnaffected
+	}
+	return commentID, nil
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+var commentTableRows = []string{"id", "todo_id", "body", "created_at", "modified_at",
+	"id", "first_name", "last_name", "email"}
+
+func TestSerializeComment(t *testing.T) {
+	t.Log(`should serialize comments along with their author`)
+	mockNow := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	comment := Comment{ID: 3, TodoID: 5, Body: "on it", CreatedAt: mockNow, ModifiedAt: mockNow,
+		Author: User{ID: 2, FirstName: MakeNullString("Jane"), Email: "jane@example.com", Password: "hash"}}
+
+	data, err := json.Marshal(comment.Serialize())
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"author":{"email":"jane@example.com","firstName":"Jane","id":2},"body":"on it",` +
+		`"createdAt":"2009-11-10T23:00:00Z","id":3,"modifiedAt":"2009-11-10T23:00:00Z","todoId":5}`
+	if string(data) != expected {
+		t.Errorf("Expected %s but received %s", expected, string(data))
+	}
+}
+
+func TestCreateComment(t *testing.T) {
+	t.Log(`should only comment on todos the author can see`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	comment := Comment{TodoID: 5, Author: User{ID: 2}, Body: "on it"}
+	mock.ExpectQuery(`WITH comment AS \( INSERT INTO comments \(todo_id, user_id, body\) SELECT id, \$2, \$3 FROM todos `+
+		`WHERE id = \$1 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$2 OR EXISTS .+\)\)\) RETURNING .+\) SELECT .+ FROM comment JOIN users`).
+		WithArgs(comment.TodoID, comment.Author.ID, comment.Body).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "modified_at", "first_name", "last_name", "email"}).
+			AddRow(1, time.Now(), time.Now(), "Jane", nil, "jane@example.com"))
+	mock.ExpectQuery(`WITH comment AS .+`).
+		WithArgs(uint(6), comment.Author.ID, comment.Body).
+		WillReturnError(sql.ErrNoRows)
+
+	db := DB{DB: mockDB}
+	if err := db.CreateComment(&comment); err != nil {
+		t.Errorf("failed to create comment: %s", err.Error())
+	}
+	if comment.ID != 1 || comment.Author.Email != "jane@example.com" {
+		t.Errorf("Expected the comment and its author to be read back but received %+v", comment)
+	}
+	if err := db.CreateComment(&Comment{TodoID: 6, Author: User{ID: 2}, Body: "on it"}); err != sql.ErrNoRows {
+		t.Errorf("Expected no rows error but received %v", err)
+	}
+	if err := db.CreateComment(&Comment{TodoID: 5, Author: User{ID: 2}}); err != ErrorEmptyComment {
+		t.Errorf("Expected empty comment error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetComments(t *testing.T) {
+	t.Log(`should get the comments on a todo with their authors`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todoID, userID := uint(5), uint(2)
+	mock.ExpectQuery(`SELECT (.+) FROM comments JOIN users ON users.id = comments.user_id JOIN todos ON todos.id = comments.todo_id `+
+		`WHERE comments.todo_id = \$1 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$2 OR EXISTS .+ORDER BY comments.id`).
+		WithArgs(todoID, userID).
+		WillReturnRows(sqlmock.NewRows(commentTableRows).
+			AddRow(1, todoID, "first", time.Now(), time.Now(), 1, "John", "Smith", "john@example.com").
+			AddRow(2, todoID, "second", time.Now(), time.Now(), userID, "Jane", nil, "jane@example.com"))
+
+	db := DB{DB: mockDB}
+	comments, err := db.GetComments(todoID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[1].Author.ID != userID {
+		t.Errorf("Expected two comments but received %+v", comments)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	t.Log(`should let the author or todo owner delete a comment`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`DELETE FROM comments USING todos .+AND \(comments.user_id = \$3 OR todos.user_id = \$3\)`).
+		WithArgs(1, 5, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM comments.+`).
+		WithArgs(1, 5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if _, err := db.DeleteComment(1, 5, 2); err != nil {
+		t.Errorf("failed to delete comment: %s", err.Error())
+	}
+	if _, err := db.DeleteComment(1, 5, 3); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq" // postgres driver
+	"github.com/vancelongwill/gotodos/storage"
 )
 
 // DB is the database
 type DB struct {
 	*sql.DB
+	// SubtaskPolicy decides what happens to subtasks when their parent is deleted or completed
+	SubtaskPolicy SubtaskPolicy
+	// Blobs stores the contents of attachments, which are disabled when it is nil
+	Blobs storage.BlobStore
+
+	connectString string // for connections of its own, such as the one Listen listens on
 }
 
 // NewDB makes & tests a connection with the DB specified then returns it
@@ -24,5 +31,5 @@ func NewDB(user, password, dbname, host string) (*DB, error) {
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+	return &DB{DB: db, connectString: connectString}, nil
 }
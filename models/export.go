@@ -0,0 +1,35 @@
+package models
+
+// exportChunkSize is how many todos are read at a time while exporting
+const exportChunkSize = 100
+
+// ExportTodos calls each with every one of a user's todos, including their tags, in order of id.
+// Todos are read from an sql database a chunk at a time, so that they can be streamed to the client
+// without holding them all in memory. Exporting stops at the first error returned by each.
+func (db *DB) ExportTodos(userID uint, each func(*Todo) error) error {
+	sqlStatement := `
+	SELECT ` + todoColumns + ` FROM todos
+	WHERE user_id = $1 AND deleted_at IS NULL AND id > $2
+	ORDER BY id
+	LIMIT $3;`
+
+	previousID := uint(0)
+	for {
+		todos, err := db.queryTodos(sqlStatement, userID, previousID, exportChunkSize)
+		if err != nil {
+			return err
+		}
+		if err = db.loadTags(todos); err != nil {
+			return err
+		}
+		for _, todo := range todos {
+			if err = each(todo); err != nil {
+				return err
+			}
+		}
+		if len(todos) < exportChunkSize {
+			return nil
+		}
+		previousID = todos[len(todos)-1].ID
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestExportTodos(t *testing.T) {
+	t.Log(`Should export all of a user's todos a chunk at a time`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	userID := uint(2)
+	now := time.Now()
+	chunk := sqlmock.NewRows(todoTableRows)
+	for id := 1; id <= exportChunkSize; id++ {
+		chunk.AddRow(id, "title", nil, now, now, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	}
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE user_id = \$1 AND deleted_at IS NULL AND id > \$2 ORDER BY id LIMIT \$3`).
+		WithArgs(userID, 0, exportChunkSize).
+		WillReturnRows(chunk)
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows).AddRow(1, 7, "groceries", userID, now))
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE user_id = \$1 .+`).
+		WithArgs(userID, exportChunkSize, exportChunkSize).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(exportChunkSize+1, "last", nil, now, now, nil, userID, nil, true, nil, nil, 0, "j", nil, 1, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	var exported []*Todo
+	err = db.ExportTodos(userID, func(todo *Todo) error {
+		exported = append(exported, todo)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to export todos: %s", err.Error())
+	}
+	if len(exported) != exportChunkSize+1 || len(exported[0].Tags) != 1 || !exported[exportChunkSize].IsDone {
+		t.Errorf("Expected every todo to be exported with its tags but received %d todos", len(exported))
+	}
+
+	t.Log(`Should stop exporting at the first error`)
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE user_id = \$1 .+`).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(1, "first", nil, now, now, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0).
+			AddRow(2, "second", nil, now, now, nil, userID, nil, false, nil, nil, 0, "j", nil, 1, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	errClosed := errors.New("connection closed")
+	calls := 0
+	err = db.ExportTodos(userID, func(todo *Todo) error {
+		calls++
+		return errClosed
+	})
+	if err != errClosed || calls != 1 {
+		t.Errorf("Expected export to stop after the first error but received %v after %d todos", err, calls)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
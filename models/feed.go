@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// FeedToken lets calendar apps subscribe to a user's todos without logging in, until it is revoked
+type FeedToken struct {
+	UserID    uint
+	Token     string // only known when the token has just been created
+	CreatedAt time.Time
+}
+
+// Serialize converts the feed token struct to a simple string map for conversion to JSON
+func (f *FeedToken) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"token":     f.Token,
+		"createdAt": f.CreatedAt,
+	}
+}
+
+// hashToken is how feed tokens and CalDAV passwords are stored, so that they can't be read back out of the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFeedToken makes a new unguessable feed token for a user, revoking any they had before
+func (db *DB) CreateFeedToken(userID uint) (*FeedToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	f := &FeedToken{UserID: userID, Token: hex.EncodeToString(b)}
+
+	sqlStatement := `
+	INSERT INTO feed_tokens (user_id, token_hash)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = NOW()
+	RETURNING created_at;`
+	if err := db.QueryRow(sqlStatement, userID, hashToken(f.Token)).Scan(&f.CreatedAt); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// RevokeFeedToken deletes a user's feed token, so that subscriptions using it stop working
+func (db *DB) RevokeFeedToken(userID uint) error {
+	sqlStatement := `
+	DELETE FROM feed_tokens
+	WHERE user_id = $1;`
+	res, err := db.Exec(sqlStatement, userID)
+	if err != nil {
+		return err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrorRowsUnaffected
+	}
+	return nil
+}
+
+// GetFeedUser finds the user a feed token belongs to, returning sql.ErrNoRows for an unknown or revoked token
+func (db *DB) GetFeedUser(token string) (uint, error) {
+	sqlStatement := `
+	SELECT user_id FROM feed_tokens
+	WHERE token_hash = $1;`
+	var userID uint
+	err := db.QueryRow(sqlStatement, hashToken(token)).Scan(&userID)
+	return userID, err
+}
+
+// GetDueTodos finds all of a user's todos which have a due date, including their tags, in order of due date
+func (db *DB) GetDueTodos(userID uint) ([]*Todo, error) {
+	sqlStatement := `
+	SELECT ` + todoColumns + ` FROM todos
+	WHERE user_id = $1 AND deleted_at IS NULL AND due_at IS NOT NULL
+	ORDER BY due_at, id;`
+
+	todos, err := db.queryTodos(sqlStatement, userID)
+	if err != nil {
+		return nil, err
+	}
+	return todos, db.loadTags(todos)
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestCreateFeedToken(t *testing.T) {
+	t.Log(`Should store only the hash of a new feed token`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO feed_tokens \(user_id, token_hash\) VALUES \(\$1, \$2\) ON CONFLICT \(user_id\) DO UPDATE .+ RETURNING created_at`).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+	db := DB{DB: mockDB}
+	f, err := db.CreateFeedToken(1)
+	if err != nil {
+		t.Fatalf("failed to create feed token: %s", err.Error())
+	}
+	if len(f.Token) != 64 || f.CreatedAt != now {
+		t.Errorf("Expected a 64 character token but received %+v", f)
+	}
+	if hashToken(f.Token) == f.Token || len(hashToken(f.Token)) != 64 {
+		t.Errorf("Expected the token to be hashed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetFeedUser(t *testing.T) {
+	t.Log(`Should find the owner of a feed token by its hash`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`SELECT user_id FROM feed_tokens WHERE token_hash = \$1`).
+		WithArgs(hashToken("secret")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+	mock.ExpectQuery(`SELECT user_id FROM feed_tokens .+`).
+		WithArgs(hashToken("revoked")).
+		WillReturnError(sql.ErrNoRows)
+
+	db := DB{DB: mockDB}
+	if userID, err := db.GetFeedUser("secret"); err != nil || userID != 3 {
+		t.Errorf("Expected user 3 but received %d, %v", userID, err)
+	}
+	if _, err := db.GetFeedUser("revoked"); err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for a revoked token but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevokeFeedToken(t *testing.T) {
+	t.Log(`Should delete the user's feed token`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`DELETE FROM feed_tokens WHERE user_id = \$1`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM feed_tokens .+`).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if err := db.RevokeFeedToken(1); err != nil {
+		t.Errorf("failed to revoke feed token: %s", err.Error())
+	}
+	if err := db.RevokeFeedToken(2); err != ErrorRowsUnaffected {
+		t.Errorf("Expected ErrorRowsUnaffected without a token but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetDueTodos(t *testing.T) {
+	t.Log(`Should list the user's todos which have a due date`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE user_id = \$1 AND deleted_at IS NULL AND due_at IS NOT NULL ORDER BY due_at, id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(4, "buy milk", nil, now, now, now, 1, nil, false, nil, nil, 0, "i", nil, 1, 0))
+	mock.ExpectQuery(`SELECT todos_tags.todo_id, .+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	todos, err := db.GetDueTodos(1)
+	if err != nil {
+		t.Fatalf("failed to get due todos: %s", err.Error())
+	}
+	if len(todos) != 1 || !todos[0].DueAt.Valid {
+		t.Errorf("Expected one todo with a due date but received %+v", todos)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in a todo's history
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventCompleted = "completed"
+	EventReopened  = "reopened"
+	EventMoved     = "moved"
+	EventDeleted   = "deleted"
+	EventRestored  = "restored"
+)
+
+// TodoEvent records a change made to a todo, who made it and when
+type TodoEvent struct {
+	ID        uint
+	TodoID    uint
+	Actor     User
+	Action    string
+	Changes   map[string]FieldChange // keyed by the field's name in a serialized todo
+	CreatedAt time.Time
+}
+
+// FieldChange holds the JSON values of a single field of a todo before and after a change
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Serialize converts the event struct to a simple string map for conversion to JSON
+func (e *TodoEvent) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        e.ID,
+		"todoId":    e.TodoID,
+		"action":    e.Action,
+		"changes":   e.Changes,
+		"createdAt": e.CreatedAt,
+		"actor":     e.Actor.Serialize(),
+	}
+}
+
+// auditedFields are the fields of a todo whose changes are recorded, null values being nil
+func auditedFields(t *Todo) map[string]interface{} {
+	fields := map[string]interface{}{
+		"title":       nil,
+		"note":        nil,
+		"dueAt":       nil,
+		"completedAt": nil,
+		"isDone":      t.IsDone,
+		"recurrence":  nil,
+		"parentId":    nil,
+		"priority":    t.Priority.String(),
+		"position":    t.Position,
+		"listId":      nil,
+	}
+	if t.Title.Valid {
+		fields["title"] = t.Title.String
+	}
+	if t.Note.Valid {
+		fields["note"] = t.Note.String
+	}
+	if t.DueAt.Valid {
+		fields["dueAt"] = t.DueAt.Time.UTC()
+	}
+	if t.CompletedAt.Valid {
+		fields["completedAt"] = t.CompletedAt.Time.UTC()
+	}
+	if t.Recurrence.Valid {
+		fields["recurrence"] = t.Recurrence.String
+	}
+	if t.ParentID.Valid {
+		fields["parentId"] = t.ParentID.Int64
+	}
+	if t.ListID.Valid {
+		fields["listId"] = t.ListID.Int64
+	}
+	return fields
+}
+
+// diffFields finds the fields whose values differ between two sets of audited fields.
+// A nil before is treated as every field having been null.
+func diffFields(before, after map[string]interface{}) (map[string]FieldChange, error) {
+	changes := make(map[string]FieldChange)
+	for field, value := range after {
+		afterJSON, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		beforeJSON, err := json.Marshal(before[field])
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(beforeJSON, afterJSON) {
+			changes[field] = FieldChange{Before: beforeJSON, After: afterJSON}
+		}
+	}
+	return changes, nil
+}
+
+// recordEvent adds an event with the given changes to a todo's history
+func recordEvent(tx *sql.Tx, todoID, actorID uint, action string, changes map[string]FieldChange) error {
+	if changes == nil {
+		changes = map[string]FieldChange{}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	sqlStatement := `
+	INSERT INTO todo_events (todo_id, user_id, action, changes)
+	VALUES ($1, $2, $3, $4);`
+	_, err = tx.Exec(sqlStatement, todoID, actorID, action, data)
+	return err
+}
+
+// recordChanges adds an event to a todo's history with the fields which differ between its before and after states,
+// unless nothing changed. A nil before records the creation of the todo.
+func recordChanges(tx *sql.Tx, before, after *Todo, actorID uint, action string) error {
+	var beforeFields map[string]interface{}
+	if before != nil {
+		beforeFields = auditedFields(before)
+	}
+	changes, err := diffFields(beforeFields, auditedFields(after))
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 && before != nil {
+		return nil
+	}
+	return recordEvent(tx, after.ID, actorID, action, changes)
+}
+
+// lockTodo reads a todo matching the condition, which may refer to the todo's id as $1 and the user's as $2,
+// and locks it for the rest of the transaction. It returns ErrorRowsUnaffected when there is no such todo.
+func lockTodo(tx *sql.Tx, todoID, userID uint, condition string) (*Todo, error) {
+	sqlStatement := `
+	SELECT ` + todoColumns + ` FROM todos
+	WHERE id = $1 AND ` + condition + `
+	FOR UPDATE;`
+	todo, err := scanTodo(tx.QueryRow(sqlStatement, todoID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrorRowsUnaffected
+	}
+	return todo, err
+}
+
+// ownedBy is the condition for lockTodo matching todos which the user owns and which aren't in the trash
+const ownedBy = `user_id = $2 AND deleted_at IS NULL`
+
+// GetTodoHistory finds the changes made to a todo which the user can see in an sql database, oldest first
+func (db *DB) GetTodoHistory(todoID, userID uint) ([]*TodoEvent, error) {
+	sqlStatement := `
+	SELECT todo_events.id, todo_events.todo_id, todo_events.action, todo_events.changes, todo_events.created_at,
+	users.id, users.first_name, users.last_name, users.email
+	FROM todo_events
+	JOIN users ON users.id = todo_events.user_id
+	JOIN todos ON todos.id = todo_events.todo_id
+	WHERE todo_events.todo_id = $1 AND ` + accessibleBy("$2", RoleViewer) + `
+	ORDER BY todo_events.id;`
+	rows, err := db.Query(sqlStatement, todoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*TodoEvent, 0)
+	for rows.Next() {
+		e := new(TodoEvent)
+		var changes []byte
+		err = rows.Scan(&e.ID, &e.TodoID, &e.Action, &changes, &e.CreatedAt,
+			&e.Actor.ID, &e.Actor.FirstName, &e.Actor.LastName, &e.Actor.Email)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+// expectLockTodo expects a todo to be read and locked before it is changed, returning the given row
+func expectLockTodo(mock sqlmock.Sqlmock, todoID, userID uint, row ...driver.Value) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = \$1 AND .+ FOR UPDATE`).
+		WithArgs(todoID, userID).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).AddRow(row...))
+}
+
+// expectTodoEvent expects a single event to be recorded in a todo's history
+func expectTodoEvent(mock sqlmock.Sqlmock, todoID, actorID uint, action string) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(`INSERT INTO todo_events \(todo_id, user_id, action, changes\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs(todoID, actorID, action, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// changesArg matches the JSON changes recorded for an event
+type changesArg string
+
+func (c changesArg) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	return ok && string(data) == string(c)
+}
+
+func TestRecordChanges(t *testing.T) {
+	t.Log(`should record only the fields which changed, as JSON`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	dueAt := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	before := &Todo{ID: 1, Title: MakeNullString("milk"), Position: "i"}
+	after := &Todo{ID: 1, Title: MakeNullString("milk"), Position: "i", DueAt: MakeNullTime(&dueAt), Priority: PriorityHigh}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO todo_events`).
+		WithArgs(1, 2, EventUpdated, changesArg(`{"dueAt":{"before":null,"after":"2009-11-10T23:00:00Z"},`+
+			`"priority":{"before":"none","after":"high"}}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := mockDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recordChanges(tx, before, after, 2, EventUpdated); err != nil {
+		t.Errorf("failed to record changes: %s", err.Error())
+	}
+	if err = recordChanges(tx, after, after, 2, EventUpdated); err != nil {
+		t.Errorf("Expected nothing to be recorded without changes but received %s", err.Error())
+	}
+	tx.Commit()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTodoHistory(t *testing.T) {
+	t.Log(`should get the history of todos the user can see, along with who made each change`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	createdAt := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT todo_events.id, .+ FROM todo_events JOIN users ON users.id = todo_events.user_id `+
+		`JOIN todos ON todos.id = todo_events.todo_id WHERE todo_events.todo_id = \$1 AND \(todos.deleted_at IS NULL .+ `+
+		`ORDER BY todo_events.id`).
+		WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "todo_id", "action", "changes", "created_at",
+			"id", "first_name", "last_name", "email"}).
+			AddRow(1, 5, EventCreated, []byte(`{"title":{"before":null,"after":"milk"}}`), createdAt, 2, "Jane", nil, "jane@example.com").
+			AddRow(2, 5, EventDeleted, []byte(`{}`), createdAt, 3, nil, nil, "john@example.com"))
+
+	db := DB{DB: mockDB}
+	events, err := db.GetTodoHistory(5, 2)
+	if err != nil {
+		t.Fatalf("failed to get history: %s", err.Error())
+	}
+	if len(events) != 2 || events[1].Actor.Email != "john@example.com" {
+		t.Fatalf("Expected two events but received %+v", events)
+	}
+
+	data, err := json.Marshal(events[0].Serialize())
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"action":"created","actor":{"email":"jane@example.com","firstName":"Jane","id":2},` +
+		`"changes":{"title":{"before":null,"after":"milk"}},"createdAt":"2009-11-10T23:00:00Z","id":1,"todoId":5}`
+	if string(data) != expected {
+		t.Errorf("Expected %s but received %s", expected, string(data))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// ImportResult is the outcome of importing a single todo
+type ImportResult struct {
+	Todo      *Todo
+	Duplicate bool // the user already has a todo with the same title and note, so this one wasn't created
+}
+
+// ImportTodos creates many todos for a user in a single transaction, along with their tags, which are
+// created as needed. Todos with the same title and note as one the user already has, or as one earlier in
+// the import, are skipped as duplicates. A dry run reports what would be created without writing anything,
+// so the todos it returns have no ids.
+func (db *DB) ImportTodos(userID uint, todos []*Todo, dryRun bool) ([]ImportResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportResult, len(todos))
+	tagIDs := make(map[string]uint)
+	imported := make(map[[2]sql.NullString]bool) // the title and note of each todo imported so far
+	for i, todo := range todos {
+		todo.UserID = userID
+		results[i].Todo = todo
+		key := [2]sql.NullString{todo.Title, todo.Note}
+		if results[i].Duplicate = imported[key]; !results[i].Duplicate {
+			if results[i].Duplicate, err = isDuplicate(tx, todo); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		if results[i].Duplicate {
+			continue
+		}
+		imported[key] = true
+
+		if dryRun {
+			if err = checkImport(todo); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			continue
+		}
+
+		tags := todo.Tags
+		if err = createTodo(tx, todo); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		for _, tag := range tags {
+			tagID, ok := tagIDs[tag.Name]
+			if !ok {
+				if tagID, err = ensureTag(tx, tag.Name, userID); err != nil {
+					tx.Rollback()
+					return nil, err
+				}
+				tagIDs[tag.Name] = tagID
+			}
+			if err = addTagToTodo(tx, todo.ID, tagID, userID); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		todo.Tags = tags
+	}
+
+	if dryRun {
+		return results, tx.Rollback()
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	created := make([]*Todo, 0, len(results))
+	for _, result := range results {
+		if !result.Duplicate {
+			result.Todo.Tags = nil
+			created = append(created, result.Todo)
+		}
+	}
+	return results, db.loadTags(created)
+}
+
+// checkImport refuses a todo which createTodo and ensureTag would, for dry runs which don't create anything
+func checkImport(t *Todo) error {
+	if len(t.Title.String) == 0 && len(t.Note.String) == 0 {
+		return ErrorEmptyTodo
+	}
+	for _, tag := range t.Tags {
+		if len(tag.Name) == 0 {
+			return ErrorEmptyTag
+		}
+	}
+	return nil
+}
+
+// isDuplicate reports whether the user already has a todo with the same title and note
+func isDuplicate(tx *sql.Tx, t *Todo) (bool, error) {
+	sqlStatement := `
+	SELECT EXISTS (
+		SELECT 1 FROM todos
+		WHERE user_id = $1 AND deleted_at IS NULL
+		AND title IS NOT DISTINCT FROM $2 AND note IS NOT DISTINCT FROM $3
+	);`
+	var exists bool
+	err := tx.QueryRow(sqlStatement, t.UserID, t.Title, t.Note).Scan(&exists)
+	return exists, err
+}
+
+// ensureTag finds one of a user's tags by name, creating it if it doesn't exist yet
+func ensureTag(tx *sql.Tx, name string, userID uint) (uint, error) {
+	if len(name) == 0 {
+		return 0, ErrorEmptyTag
+	}
+	sqlStatement := `
+	INSERT INTO tags (name, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+	RETURNING id;`
+	var tagID uint
+	err := tx.QueryRow(sqlStatement, name, userID).Scan(&tagID)
+	return tagID, err
+}
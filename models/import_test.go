@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"testing"
+	"time"
+)
+
+func TestImportTodos(t *testing.T) {
+	t.Log(`Should create imported todos with their tags, skipping duplicates`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	userID := uint(2)
+	now := time.Now()
+	todos := []*Todo{
+		{Title: MakeNullString("buy milk"), IsDone: true, Tags: []Tag{{Name: "groceries"}}},
+		{Title: MakeNullString("post letter")},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS \( SELECT 1 FROM todos WHERE user_id = \$1 AND deleted_at IS NULL AND title IS NOT DISTINCT FROM \$2 .+`).
+		WithArgs(userID, todos[0].Title, todos[0].Note).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	expectEnsureInbox(mock, userID)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\), ''\) FROM todos`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("i"))
+	mock.ExpectQuery(`INSERT INTO todos .+`).
+		WithArgs(todos[0].Title, todos[0].Note, userID, pq.NullTime{}, todos[0].Recurrence, todos[0].ParentID, PriorityNone, "r", todos[0].ListID, true, pq.NullTime{}).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(5, "buy milk", nil, now, now, nil, userID, now, true, nil, nil, 0, "r", 1, 1, 0))
+	expectTodoEvent(mock, 5, userID, EventCreated)
+	mock.ExpectQuery(`INSERT INTO tags \(name, user_id\) VALUES \(\$1, \$2\) ON CONFLICT \(user_id, name\) .+ RETURNING id`).
+		WithArgs("groceries", userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(`INSERT INTO todos_tags .+`).
+		WithArgs(3, 5, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS .+`).
+		WithArgs(userID, todos[1].Title, todos[1].Note).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows).AddRow(5, 3, "groceries", userID, now))
+
+	db := DB{DB: mockDB}
+	results, err := db.ImportTodos(userID, todos, false)
+	if err != nil {
+		t.Fatalf("failed to import todos: %s", err.Error())
+	}
+	if results[0].Duplicate || results[0].Todo.ID != 5 || !results[0].Todo.IsDone || len(results[0].Todo.Tags) != 1 {
+		t.Errorf("Expected the first todo to be created with its tag but received %+v", results[0].Todo)
+	}
+	if !results[1].Duplicate {
+		t.Errorf("Expected the second todo to be a duplicate")
+	}
+
+	t.Log(`Should report what a dry run would create without creating anything`)
+	dryRun := []*Todo{
+		{Title: MakeNullString("water plants"), Tags: []Tag{{Name: "home"}}},
+		{Title: MakeNullString("post letter")},
+		{Title: MakeNullString("water plants")},
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS .+`).
+		WithArgs(userID, dryRun[0].Title, dryRun[0].Note).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT EXISTS .+`).
+		WithArgs(userID, dryRun[1].Title, dryRun[1].Note).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	results, err = db.ImportTodos(userID, dryRun, true)
+	if err != nil {
+		t.Fatalf("failed to dry run import: %s", err.Error())
+	}
+	if results[0].Duplicate || results[0].Todo.ID != 0 || !results[1].Duplicate || !results[2].Duplicate {
+		t.Errorf("Expected only the first todo to be new, without an id, but received %+v", results)
+	}
+
+	t.Log(`Should refuse a dry run which would fail`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS .+`).
+		WithArgs(userID, sql.NullString{}, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	if _, err = db.ImportTodos(userID, []*Todo{{}}, true); err != ErrorEmptyTodo {
+		t.Errorf("Expected empty todo error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// List defines the shape of a named list (or project) which groups a user's todos.
+// Every user has an inbox list, which todos are added to when no other list is given.
+type List struct {
+	ID        uint
+	Name      string
+	UserID    uint
+	IsInbox   bool
+	CreatedAt time.Time
+}
+
+// InboxName is the name given to each user's default list
+const InboxName = "Inbox"
+
+// MaxListNameLength is the most characters a list's name may have, as the lists table stores it as VARCHAR(255)
+const MaxListNameLength = 255
+
+// Errors
+var (
+	ErrorEmptyList     = errors.New("List must have a non empty name")
+	ErrorListNotFound  = errors.New("Unable to find list")
+	ErrorInboxList     = errors.New("The inbox list can't be deleted")
+	ErrorDuplicateList = errors.New("A list with that name already exists")
+)
+
+// Serialize converts the list struct to a simple string map for conversion to JSON
+func (l *List) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        l.ID,
+		"name":      l.Name,
+		"isInbox":   l.IsInbox,
+		"createdAt": l.CreatedAt,
+	}
+}
+
+// CreateList inserts a single list into an sql database
+func (db *DB) CreateList(l *List) error {
+	if len(l.Name) == 0 {
+		return ErrorEmptyList
+	}
+	sqlStatement := `
+	INSERT INTO lists (name, user_id, is_inbox)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at;`
+
+	err := db.QueryRow(sqlStatement, l.Name, l.UserID, l.IsInbox).Scan(&l.ID, &l.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrorDuplicateList
+	}
+	return err
+}
+
+// ensureInbox creates a user's inbox list unless they already have one, as users who registered before lists
+// existed don't
+func ensureInbox(db execer, userID uint) error {
+	sqlStatement := `
+	INSERT INTO lists (name, user_id, is_inbox)
+	VALUES ($1, $2, TRUE)
+	ON CONFLICT (user_id) WHERE is_inbox DO NOTHING;`
+	_, err := db.Exec(sqlStatement, InboxName, userID)
+	return err
+}
+
+// GetAllLists finds all the lists belonging to a given user in an sql database, starting with the inbox,
+// which is created first if the user doesn't have one yet
+func (db *DB) GetAllLists(userID uint) ([]*List, error) {
+	if err := ensureInbox(db, userID); err != nil {
+		return nil, err
+	}
+	sqlStatement := `
+	SELECT id, name, user_id, is_inbox, created_at FROM lists WHERE user_id = $1
+	ORDER BY is_inbox DESC, name;`
+	rows, err := db.Query(sqlStatement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := make([]*List, 0)
+	for rows.Next() {
+		l := new(List)
+		if err = rows.Scan(&l.ID, &l.Name, &l.UserID, &l.IsInbox, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// GetList finds a single list from an sql database
+func (db *DB) GetList(listID, userID uint) (*List, error) {
+	sqlStatement := `
+	SELECT id, name, user_id, is_inbox, created_at FROM lists WHERE id = $1 AND user_id = $2`
+	l := new(List)
+	err := db.QueryRow(sqlStatement, listID, userID).
+		Scan(&l.ID, &l.Name, &l.UserID, &l.IsInbox, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// UpdateList renames a single list in an sql database
+func (db *DB) UpdateList(l List) (*List, error) {
+	if len(l.Name) == 0 {
+		return nil, ErrorEmptyList
+	}
+	sqlStatement := `
+	UPDATE lists
+	SET name = $3
+	WHERE id = $1 AND user_id = $2;`
+
+	res, err := db.Exec(sqlStatement, l.ID, l.UserID, l.Name)
+	if isUniqueViolation(err) {
+		return nil, ErrorDuplicateList
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if count != 1 {
+		return nil, ErrorRowsUnaffected
+	}
+	return &l, nil
+}
+
+// DeleteList removes a single list from an sql database, moving its todos to the user's inbox.
+// The inbox itself can't be deleted.
+func (db *DB) DeleteList(listID, userID uint) (uint, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	sqlStatement := `
+	SELECT is_inbox FROM lists WHERE id = $1 AND user_id = $2
+	FOR UPDATE;`
+	var isInbox bool
+	if err = tx.QueryRow(sqlStatement, listID, userID).Scan(&isInbox); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, ErrorRowsUnaffected
+		}
+		return 0, err
+	}
+	if isInbox {
+		tx.Rollback()
+		return 0, ErrorInboxList
+	}
+	if err = ensureInbox(tx, userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = moveToInbox(tx, listID, userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	sqlStatement = `
+	DELETE FROM lists
+	WHERE id = $1 AND user_id = $2;`
+	if _, err = tx.Exec(sqlStatement, listID, userID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return listID, tx.Commit()
+}
+
+// moveToInbox moves the todos in one of the user's lists to their inbox as part of a transaction, recording the change
+// in the history of each todo
+func moveToInbox(tx *sql.Tx, listID, userID uint) error {
+	sqlStatement := `
+	SELECT ` + todoColumns + ` FROM todos
+	WHERE list_id = $1 AND user_id = $2
+	FOR UPDATE;`
+	rows, err := tx.Query(sqlStatement, listID, userID)
+	if err != nil {
+		return err
+	}
+	before, err := scanTodos(rows)
+	if err != nil || len(before) == 0 {
+		return err
+	}
+
+	sqlStatement = `
+	UPDATE todos
+	SET list_id = (SELECT id FROM lists WHERE user_id = $2 AND is_inbox), modified_at = NOW()
+	WHERE list_id = $1 AND user_id = $2
+	RETURNING ` + todoColumns + `;`
+	if rows, err = tx.Query(sqlStatement, listID, userID); err != nil {
+		return err
+	}
+	after, err := scanTodos(rows)
+	if err != nil {
+		return err
+	}
+	moved := make(map[uint]*Todo, len(after))
+	for _, t := range after {
+		moved[t.ID] = t
+	}
+	for _, t := range before {
+		if moved[t.ID] == nil {
+			continue
+		}
+		if err = recordChanges(tx, t, moved[t.ID], userID, EventUpdated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureListOwner checks that a list exists and belongs to the given user
+func ensureListOwner(db queryRower, listID, userID uint) error {
+	sqlStatement := `
+	SELECT EXISTS (SELECT 1 FROM lists WHERE id = $1 AND user_id = $2);`
+	var exists bool
+	if err := db.QueryRow(sqlStatement, listID, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrorListNotFound
+	}
+	return nil
+}
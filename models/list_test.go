@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"testing"
+	"time"
+)
+
+var listTableRows = []string{"id", "name", "user_id", "is_inbox", "created_at"}
+
+// expectEnsureInbox expects a user's inbox to be created unless they already have one
+func expectEnsureInbox(mock sqlmock.Sqlmock, userID uint) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(`INSERT INTO lists \(name, user_id, is_inbox\) VALUES \(\$1, \$2, TRUE\) ON CONFLICT \(user_id\) WHERE is_inbox DO NOTHING`).
+		WithArgs(InboxName, userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestCreateList(t *testing.T) {
+	t.Log(`should create a list and read back its id`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	list := List{Name: InboxName, UserID: 1, IsInbox: true}
+	mock.ExpectQuery(`INSERT INTO lists.+`).
+		WithArgs(list.Name, list.UserID, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, time.Now()))
+
+	db := DB{DB: mockDB}
+	if err := db.CreateList(&list); err != nil {
+		t.Errorf("failed to create list: %s", err.Error())
+	}
+	if list.ID != 4 {
+		t.Errorf("Expected list id 4 but received %d", list.ID)
+	}
+	if err := db.CreateList(&List{UserID: 1}); err != ErrorEmptyList {
+		t.Errorf("Expected empty list error but received %v", err)
+	}
+
+	t.Log(`should refuse a list with the same name as another of the user's lists`)
+	mock.ExpectQuery(`INSERT INTO lists.+`).
+		WithArgs("groceries", uint(1), false).
+		WillReturnError(&pq.Error{Code: "23505"})
+	if err := db.CreateList(&List{Name: "groceries", UserID: 1}); err != ErrorDuplicateList {
+		t.Errorf("Expected duplicate list error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetAllLists(t *testing.T) {
+	t.Log(`should get all of a user's lists, inbox first, creating the inbox if they don't have one yet`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	expectEnsureInbox(mock, userID)
+	mock.ExpectQuery(`SELECT (.+) FROM lists WHERE user_id = \$1\s+ORDER BY is_inbox DESC, name`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(listTableRows).
+			AddRow(1, InboxName, userID, true, time.Now()).
+			AddRow(2, "groceries", userID, false, time.Now()))
+
+	db := DB{DB: mockDB}
+	lists, err := db.GetAllLists(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 || !lists[0].IsInbox {
+		t.Errorf("Expected the inbox and one other list but received %v", lists)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteList(t *testing.T) {
+	t.Log(`should move a deleted list's todos to the inbox`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	listID, userID := uint(2), uint(1)
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT is_inbox FROM lists WHERE.+FOR UPDATE`).
+		WithArgs(listID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"is_inbox"}).AddRow(false))
+	expectEnsureInbox(mock, userID)
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE list_id = \$1 AND user_id = \$2 FOR UPDATE`).
+		WithArgs(listID, userID).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(4, "buy milk", nil, now, now, nil, userID, nil, false, nil, nil, 0, "i", listID, 1, 0))
+	mock.ExpectQuery(`UPDATE todos\s+SET list_id = \(SELECT id FROM lists WHERE user_id = \$2 AND is_inbox\), modified_at = NOW\(\) .+ RETURNING`).
+		WithArgs(listID, userID).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(4, "buy milk", nil, now, now, nil, userID, nil, false, nil, nil, 0, "i", 1, 2, 0))
+	expectTodoEvent(mock, 4, userID, EventUpdated)
+	mock.ExpectExec(`DELETE FROM lists.+`).
+		WithArgs(listID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
+	if _, err := db.DeleteList(listID, userID); err != nil {
+		t.Errorf("failed to delete list: %s", err.Error())
+	}
+
+	t.Log(`should refuse to delete the inbox`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT is_inbox FROM lists WHERE.+FOR UPDATE`).
+		WithArgs(uint(1), userID).
+		WillReturnRows(sqlmock.NewRows([]string{"is_inbox"}).AddRow(true))
+	mock.ExpectRollback()
+
+	if _, err := db.DeleteList(1, userID); err != ErrorInboxList {
+		t.Errorf("Expected inbox list error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateTodoInList(t *testing.T) {
+	t.Log(`should not create a todo in another user's list`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todo := Todo{
+		Title:  MakeNullString("buy milk"),
+		UserID: 1,
+		ListID: sql.NullInt64{Int64: 7, Valid: true},
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM lists WHERE id = \$1 AND user_id = \$2\)`).
+		WithArgs(uint(7), todo.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if err := db.CreateTodo(&todo); err != ErrorListNotFound {
+		t.Errorf("Expected list not found error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
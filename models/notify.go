@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/vancelongwill/gotodos/events"
+	"log"
+	"time"
+)
+
+// ChangesChannel is the Postgres channel which changes to todos are announced on, so that every instance of the API
+// can pass them on to its own subscribers. Changes are announced by triggers on todo_events and todos_tags, see init.sql,
+// so they're announced along with every write which commits, whichever request made it.
+const ChangesChannel = "todo_changes"
+
+// change is the payload announcing an event on ChangesChannel
+type change struct {
+	Type    string `json:"type"`
+	TodoID  uint   `json:"todoId"`
+	ActorID uint   `json:"actorId"`
+}
+
+// decodeChange converts a payload announced on ChangesChannel back into an event
+func decodeChange(payload string) (events.Event, error) {
+	var c change
+	err := json.Unmarshal([]byte(payload), &c)
+	return events.Event{Type: c.Type, TodoID: c.TodoID, ActorID: c.ActorID}, err
+}
+
+// changedTodo adds the todo to an event as the user who made the change sees it, so that subscribers needn't fetch it.
+// The todo is left out when it's been deleted or can't be found.
+func (db *DB) changedTodo(e events.Event) events.Event {
+	if e.Type == events.Deleted {
+		return e
+	}
+	if todo, err := db.GetTodo(e.TodoID, e.ActorID); err == nil {
+		e.Todo = todo.Serialize()
+	}
+	return e
+}
+
+// Listen passes the changes announced on ChangesChannel by every instance of the API on to the subscribers of a hub.
+// When the connection it listens on is lost, the hub's subscribers are reset once it's re-established,
+// since changes may have been announced in the meantime.
+func (db *DB) Listen(hub *events.Hub) error {
+	listener := pq.NewListener(db.connectString, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Error listening for changes:\t", err)
+		}
+	})
+	if err := listener.Listen(ChangesChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		for notification := range listener.Notify {
+			if notification == nil {
+				// the connection was re-established
+				hub.Reset()
+				continue
+			}
+			e, err := decodeChange(notification.Extra)
+			if err != nil {
+				log.Println("Error reading a change:\t", err)
+				continue
+			}
+			hub.Publish(db.changedTodo(e))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vancelongwill/gotodos/events"
+	"testing"
+	"time"
+)
+
+func TestDecodeChange(t *testing.T) {
+	t.Log(`Should read the change announced by the database`)
+	e, err := decodeChange(`{"type":"completed","todoId":4,"actorId":1}`)
+	if err != nil || e.Type != events.Completed || e.TodoID != 4 || e.ActorID != 1 || e.Todo != nil {
+		t.Errorf("Expected the change but received %+v, %v", e, err)
+	}
+	if _, err = decodeChange("nonsense"); err == nil {
+		t.Errorf("Expected an error reading a malformed change")
+	}
+}
+
+func TestChangedTodo(t *testing.T) {
+	t.Log(`Should add the changed todo to an event, as its actor sees it`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = \$1 AND .+`).
+		WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(4, "buy milk", nil, now, now, nil, 1, now, true, nil, nil, 0, "i", nil, 3, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE parent_id = \$1 .+`).
+		WillReturnRows(sqlmock.NewRows(append(todoTableRows, "total", "done")))
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	e := db.changedTodo(events.Event{Type: events.Completed, TodoID: 4, ActorID: 1})
+	if e.Todo == nil || e.Todo["title"] != "buy milk" {
+		t.Errorf("Expected the completed todo but received %+v", e.Todo)
+	}
+
+	t.Log(`Should leave deleted todos out`)
+	if e := db.changedTodo(events.Event{Type: events.Deleted, TodoID: 4, ActorID: 1}); e.Todo != nil {
+		t.Errorf("Expected no todo but received %+v", e.Todo)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
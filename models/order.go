@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Priority is how urgent a todo is, from PriorityNone to PriorityUrgent
+type Priority int
+
+// Priorities
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+var priorityNames = []string{"none", "low", "medium", "high", "urgent"}
+
+// Errors
+var (
+	ErrorInvalidPriority = errors.New("Priority must be one of none, low, medium, high or urgent")
+	ErrorInvalidMove     = errors.New("Todo can't be moved between the given neighbours")
+)
+
+// ParsePriority converts the name of a priority into a Priority
+func ParsePriority(name string) (Priority, error) {
+	for i, priorityName := range priorityNames {
+		if name == priorityName {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNone, ErrorInvalidPriority
+}
+
+// NormalizePriority converts an optional priority name into a Priority, treating a missing name as none
+func NormalizePriority(name *string) (Priority, error) {
+	if name == nil || len(*name) == 0 {
+		return PriorityNone, nil
+	}
+	return ParsePriority(*name)
+}
+
+// String returns the name of the priority
+func (p Priority) String() string {
+	if p < PriorityNone || p > PriorityUrgent {
+		return priorityNames[PriorityNone]
+	}
+	return priorityNames[p]
+}
+
+// rankDigits are the characters used in positions, in ascending order under the "C" collation
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// RankBetween returns a position which sorts strictly between prev and next, so that a todo can be
+// moved without renumbering its neighbours. An empty prev or next is unbounded.
+// Positions never end in the lowest digit, so there is always room for another before them.
+func RankBetween(prev, next string) (string, error) {
+	if len(next) > 0 && prev >= next {
+		return "", ErrorInvalidMove
+	}
+	base := len(rankDigits)
+	digit := func(rank string, i int, otherwise int) int {
+		if i < len(rank) {
+			return strings.IndexByte(rankDigits, rank[i])
+		}
+		return otherwise
+	}
+
+	var rank strings.Builder
+	unbounded := len(next) == 0
+	for i := 0; ; i++ {
+		p := digit(prev, i, 0)
+		n := base
+		if !unbounded {
+			n = digit(next, i, 0)
+		}
+		if p < 0 || n < 0 {
+			return "", ErrorInvalidMove // not a position this function generated
+		}
+		if p == n {
+			rank.WriteByte(rankDigits[p])
+			continue
+		}
+		if mid := (p + n) / 2; mid > p {
+			rank.WriteByte(rankDigits[mid])
+			return rank.String(), nil
+		}
+		// the digits are adjacent, so keep prev's digit and find room after it
+		rank.WriteByte(rankDigits[p])
+		unbounded = true
+	}
+}
+
+// queryRower is satisfied by both *DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// execer is satisfied by both *DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// lastPosition finds a position after all of a user's todos
+func lastPosition(db queryRower, userID uint) (string, error) {
+	sqlStatement := `
+	SELECT COALESCE(MAX(position), '') FROM todos WHERE user_id = $1;`
+	var last string
+	if err := db.QueryRow(sqlStatement, userID).Scan(&last); err != nil {
+		return "", err
+	}
+	return RankBetween(last, "")
+}
+
+// todoPosition finds the position of one of a user's todos
+func todoPosition(tx *sql.Tx, todoID, userID uint) (string, error) {
+	sqlStatement := `
+	SELECT position FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL;`
+	var position string
+	err := tx.QueryRow(sqlStatement, todoID, userID).Scan(&position)
+	return position, err
+}
+
+// adjacentPosition finds the position of the user's todo next to the given position,
+// ignoring the todo being moved. It returns an empty position when there is none.
+func adjacentPosition(tx *sql.Tx, todoID, userID uint, position string, after bool) (string, error) {
+	aggregate, comparison := "MAX", "<"
+	if after {
+		aggregate, comparison = "MIN", ">"
+	}
+	sqlStatement := `
+	SELECT COALESCE(` + aggregate + `(position), '') FROM todos
+	WHERE user_id = $1 AND id <> $2 AND deleted_at IS NULL AND position ` + comparison + ` $3;`
+	var adjacent string
+	err := tx.QueryRow(sqlStatement, userID, todoID, position).Scan(&adjacent)
+	return adjacent, err
+}
+
+// MoveTodo repositions a todo between two of its owner's other todos in an sql database.
+// When only one neighbour is given the todo is placed directly after (or before) it.
+// The todo may belong to another user who has shared it as an editor.
+func (db *DB) MoveTodo(todoID, userID uint, afterID, beforeID *uint) (*Todo, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	todo, err := moveTodo(tx, todoID, userID, afterID, beforeID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return todo, db.loadTags([]*Todo{todo})
+}
+
+// moveTodo repositions a todo as part of a transaction, see MoveTodo
+func moveTodo(tx *sql.Tx, todoID, userID uint, afterID, beforeID *uint) (*Todo, error) {
+	if (afterID == nil && beforeID == nil) ||
+		(afterID != nil && *afterID == todoID) || (beforeID != nil && *beforeID == todoID) {
+		return nil, ErrorInvalidMove
+	}
+	moving, err := lockTodo(tx, todoID, userID, accessibleBy("$2", RoleEditor))
+	if err == ErrorRowsUnaffected {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the todo may be shared with the user as an editor, so it's positioned among its owner's todos
+	var after, before string
+	if afterID != nil {
+		after, err = todoPosition(tx, *afterID, moving.UserID)
+	}
+	if err == nil && beforeID != nil {
+		before, err = todoPosition(tx, *beforeID, moving.UserID)
+	}
+	if err == nil && afterID == nil {
+		after, err = adjacentPosition(tx, todoID, moving.UserID, before, false)
+	}
+	if err == nil && beforeID == nil {
+		before, err = adjacentPosition(tx, todoID, moving.UserID, after, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	position, err := RankBetween(after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	UPDATE todos
+	SET position = $2
+	WHERE id = $1
+	RETURNING ` + todoColumns + `;`
+	todo, err := scanTodo(tx.QueryRow(sqlStatement, todoID, position))
+	if err != nil {
+		return nil, err
+	}
+	if err = recordChanges(tx, moving, todo, userID, EventMoved); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestParsePriority(t *testing.T) {
+	t.Log(`Should parse priority names and reject unknown ones`)
+	for _, name := range priorityNames {
+		priority, err := ParsePriority(name)
+		if err != nil || priority.String() != name {
+			t.Errorf("%s: expected to round trip but received %v, %v", name, priority, err)
+		}
+	}
+	if _, err := ParsePriority("critical"); err != ErrorInvalidPriority {
+		t.Errorf("Expected an invalid priority error but received %v", err)
+	}
+}
+
+func TestRankBetween(t *testing.T) {
+	t.Log(`Should find a rank strictly between its neighbours`)
+	tests := []struct {
+		prev, next string
+	}{
+		{"", ""},
+		{"i", ""},
+		{"", "i"},
+		{"a", "b"},
+		{"a", "a1"},
+		{"az", "b"},
+		{"zz", ""},
+		{"", "01"},
+		{"h", "hi"},
+	}
+
+	for _, test := range tests {
+		rank, err := RankBetween(test.prev, test.next)
+		if err != nil {
+			t.Errorf("%q, %q: %s", test.prev, test.next, err)
+			continue
+		}
+		if rank <= test.prev || (len(test.next) > 0 && rank >= test.next) {
+			t.Errorf("%q, %q: %q is not between them", test.prev, test.next, rank)
+		}
+		if rank[len(rank)-1] == rankDigits[0] {
+			t.Errorf("%q, %q: %q ends in the lowest digit", test.prev, test.next, rank)
+		}
+	}
+
+	t.Log(`Should keep finding ranks when repeatedly inserting at the same place`)
+	prev, next := "", "i"
+	for i := 0; i < 100; i++ {
+		rank, err := RankBetween(prev, next)
+		if err != nil || rank <= prev || rank >= next {
+			t.Fatalf("%q, %q: received %q, %v", prev, next, rank, err)
+		}
+		next = rank
+	}
+
+	if _, err := RankBetween("b", "a"); err != ErrorInvalidMove {
+		t.Errorf("Expected an invalid move error but received %v", err)
+	}
+}
+
+func TestMoveTodo(t *testing.T) {
+	t.Log(`Should move a todo directly after its neighbour among its owner's todos, when moved by an editor`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todoID, userID, afterID, ownerID := uint(1), uint(2), uint(3), uint(4)
+	currentTime := time.Now()
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "moved", nil, currentTime, currentTime, nil, ownerID, nil, false, nil, nil, 0, "c", nil, 1, 0)
+	mock.ExpectQuery(`SELECT position FROM todos WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(afterID, ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("a"))
+	mock.ExpectQuery(`SELECT COALESCE\(MIN\(position\), ''\) FROM todos.+position > \$3`).
+		WithArgs(ownerID, todoID, "a").
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("b"))
+	mock.ExpectQuery(`UPDATE todos SET position = \$2 WHERE id = \$1 RETURNING`).
+		WithArgs(todoID, "ai").
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "moved", nil, currentTime, currentTime, nil, ownerID, nil, false, nil, nil, 0, "ai", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventMoved)
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	todo, err := db.MoveTodo(todoID, userID, &afterID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Position != "ai" {
+		t.Errorf("Expected position ai but received %q", todo.Position)
+	}
+
+	t.Log(`Should not move a todo next to a todo it can't find`)
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "moved", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "ai", nil, 1, 0)
+	mock.ExpectQuery(`SELECT position FROM todos WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(afterID, userID).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	if _, err := db.MoveTodo(todoID, userID, &afterID, nil); err != sql.ErrNoRows {
+		t.Errorf("Expected no rows error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
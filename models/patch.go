@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// TodoPatch describes a partial update to a todo. Nil fields are left unchanged,
+// while non-nil fields holding an invalid (null) value clear the column.
+type TodoPatch struct {
+	Title      *sql.NullString
+	Note       *sql.NullString
+	DueAt      *pq.NullTime
+	IsDone     *bool
+	Recurrence *sql.NullString
+	Priority   *Priority
+	ListID     *uint
+	Version    int // the version the todo must be at, or zero for any
+}
+
+// IsEmpty reports whether the patch would leave the todo unchanged
+func (p *TodoPatch) IsEmpty() bool {
+	return p.Title == nil && p.Note == nil && p.DueAt == nil && p.IsDone == nil && p.Recurrence == nil &&
+		p.Priority == nil && p.ListID == nil
+}
+
+// PatchTodo updates only the fields present in the patch of a single todo in an sql database,
+// returning the todo as it is after the update, and records the fields which changed. Completing a recurring todo
+// creates its next occurrence and follows the subtask policy as MarkTodoAsComplete does. The todo may belong to
+// another user who has shared it as an editor.
+func (db *DB) PatchTodo(todoID, userID uint, patch TodoPatch, currentTime time.Time) (*Todo, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	todo, err := db.patchTodo(tx, todoID, userID, patch, currentTime)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err = db.loadTags([]*Todo{todo}); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+// patchTodo applies a patch to a todo as part of a transaction, see PatchTodo
+func (db *DB) patchTodo(tx *sql.Tx, todoID, userID uint, patch TodoPatch, currentTime time.Time) (*Todo, error) {
+	args := []interface{}{todoID, currentTime}
+	columns := []string{"modified_at = $2"}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		columns = append(columns, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if patch.Title != nil {
+		set("title", *patch.Title)
+	}
+	if patch.Note != nil {
+		set("note", *patch.Note)
+	}
+	if patch.DueAt != nil {
+		set("due_at", *patch.DueAt)
+	}
+	if patch.Recurrence != nil {
+		set("recurrence", *patch.Recurrence)
+	}
+	if patch.Priority != nil {
+		set("priority", *patch.Priority)
+	}
+	if patch.ListID != nil {
+		set("list_id", *patch.ListID)
+	}
+	if patch.IsDone != nil {
+		set("is_done", *patch.IsDone)
+		if *patch.IsDone {
+			// keep the original completion time if the todo was already done
+			columns = append(columns, "completed_at = COALESCE(completed_at, $2)")
+		} else {
+			columns = append(columns, "completed_at = NULL")
+		}
+	}
+
+	sqlStatement := `
+	UPDATE todos
+	SET ` + strings.Join(columns, ", ") + `
+	WHERE id = $1
+	RETURNING ` + todoColumns + `;`
+
+	before, err := lockTodo(tx, todoID, userID, accessibleBy("$2", RoleEditor))
+	if err == ErrorRowsUnaffected {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+	if patch.Version != 0 && patch.Version != before.Version {
+		return nil, ErrorVersionMismatch
+	}
+	// the todo may be shared with the user as an editor, who can only move it to another of its owner's lists
+	if patch.ListID != nil {
+		if err := ensureListOwner(tx, *patch.ListID, before.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	todo, err := scanTodo(tx.QueryRow(sqlStatement, args...))
+	if err != nil {
+		return nil, err
+	}
+	if len(todo.Title.String) == 0 && len(todo.Note.String) == 0 {
+		return nil, ErrorEmptyTodo
+	}
+	if err = recordChanges(tx, before, todo, userID, EventUpdated); err != nil {
+		return nil, err
+	}
+	if patch.IsDone != nil && *patch.IsDone && !before.IsDone {
+		if err = db.completeSubtasks(tx, todoID, userID, currentTime); err != nil {
+			return nil, err
+		}
+		if todo.NextOccurrence, err = scheduleNextOccurrence(tx, todo, currentTime); err != nil {
+			return nil, err
+		}
+	}
+	return todo, nil
+}
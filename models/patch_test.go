@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestPatchTodo(t *testing.T) {
+	t.Log(`Should only update the fields present in a patch`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	todoID, userID, ownerID := uint(1), uint(2), uint(3)
+	currentTime := time.Now()
+	title := MakeNullString("new title")
+	isDone := true
+	patch := TodoPatch{Title: &title, IsDone: &isDone}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$2 OR EXISTS .+`+
+		`AND shares.role = 'editor'\)\)\) FOR UPDATE`).
+		WithArgs(todoID, userID).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "old title", "old note", currentTime, currentTime, nil, ownerID, nil, false, nil, nil, 0, "i", nil, 1, 0))
+	mock.ExpectQuery(`UPDATE todos SET modified_at = \$2, title = \$3, is_done = \$4, `+
+		`completed_at = COALESCE\(completed_at, \$2\) WHERE id = \$1 RETURNING (.+)`).
+		WithArgs(todoID, currentTime, title, isDone).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "new title", "old note", currentTime, currentTime, nil, ownerID, currentTime, true, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventUpdated)
+	mock.ExpectExec(`WITH RECURSIVE descendants.+UPDATE todos.+`).
+		WithArgs(todoID, userID, currentTime, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	todo, err := db.PatchTodo(todoID, userID, patch, currentTime)
+	if err != nil {
+		t.Errorf("failed to patch todo: %s", err.Error())
+		return
+	}
+	if todo.Title.String != "new title" || todo.Note.String != "old note" || !todo.IsDone {
+		t.Errorf("patched todo was not returned")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPatchTodoList(t *testing.T) {
+	t.Log(`Should refuse to move a shared todo into a list which its owner doesn't have`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todoID, editorID, ownerID, editorListID := uint(1), uint(2), uint(3), uint(9)
+	currentTime := time.Now()
+	patch := TodoPatch{ListID: &editorListID}
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, editorID,
+		todoID, "shared", nil, currentTime, currentTime, nil, ownerID, nil, false, nil, nil, 0, "i", 4, 1, 0)
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM lists WHERE id = \$1 AND user_id = \$2\)`).
+		WithArgs(editorListID, ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if _, err := db.PatchTodo(todoID, editorID, patch, currentTime); err != ErrorListNotFound {
+		t.Errorf("Expected list not found error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPatchTodoEmpty(t *testing.T) {
+	t.Log(`Should refuse a patch which clears both the title and note`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	todoID, userID := uint(1), uint(2)
+	currentTime := time.Now()
+	patch := TodoPatch{Title: &sql.NullString{}}
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "old title", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos SET modified_at = \$2, title = \$3 WHERE.+`).
+		WithArgs(todoID, currentTime, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, nil, nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if _, err := db.PatchTodo(todoID, userID, patch, currentTime); err != ErrorEmptyTodo {
+		t.Errorf("Expected empty todo error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	maxResultsPerPage = 100 // the largest page size a caller may request
+)
+
+// Errors
+var (
+	ErrorInvalidSort     = errors.New("Unsupported sort field")
+	ErrorInvalidPrevious = errors.New("Unable to find the previous todo")
+)
+
+// TodoQuery describes which of a user's todos to list, in what order and from which point.
+// Nil or zero valued fields are not filtered on.
+type TodoQuery struct {
+	IsDone       *bool
+	DueBefore    *time.Time
+	DueAfter     *time.Time
+	CreatedAfter *time.Time
+	Tag          string // the name of a tag the todos must have
+	ListID       uint   // the list the todos must be in
+	Sort         string // one of the keys of sortExpressions, defaults to id
+	Descending   bool
+	PreviousID   uint // the id of the last todo on the previous page
+	Limit        int  // the page size, defaults to resultsPerPage and is capped at maxResultsPerPage
+}
+
+// sortExpressions maps the sort fields accepted by the API onto sql expressions.
+// Nullable columns are coalesced so that rows missing a value sort last in both directions
+// and can still be compared when paginating.
+var sortExpressions = map[string]func(desc bool) string{
+	"id":         func(bool) string { return "id" },
+	"createdAt":  func(bool) string { return "created_at" },
+	"modifiedAt": func(bool) string { return "modified_at" },
+	"title":      func(bool) string { return "COALESCE(title, '')" },
+	"priority":   func(bool) string { return "priority" },
+	"position":   func(bool) string { return "position" },
+	"dueAt": func(desc bool) string {
+		if desc {
+			return "COALESCE(due_at, '-infinity')"
+		}
+		return "COALESCE(due_at, 'infinity')"
+	},
+}
+
+// IsValidSort reports whether the todos can be sorted by the given field
+func IsValidSort(sort string) bool {
+	_, ok := sortExpressions[sort]
+	return ok || len(sort) == 0
+}
+
+// pageSize clamps the requested limit to the allowed range
+func (q *TodoQuery) pageSize() int {
+	if q.Limit <= 0 {
+		return resultsPerPage
+	}
+	if q.Limit > maxResultsPerPage {
+		return maxResultsPerPage
+	}
+	return q.Limit
+}
+
+// build turns the query into sql conditions & ordering for the todos table.
+// Arguments are numbered after those already in args, the first of which must be the user's id.
+func (q *TodoQuery) build(args []interface{}) (string, []interface{}, error) {
+	sort := q.Sort
+	if len(sort) == 0 {
+		sort = "id"
+	}
+	expression, ok := sortExpressions[sort]
+	if !ok {
+		return "", nil, ErrorInvalidSort
+	}
+	sortExpr := expression(q.Descending)
+
+	conditions := make([]string, 0)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.IsDone != nil {
+		conditions = append(conditions, "is_done = "+arg(*q.IsDone))
+	}
+	if q.DueBefore != nil {
+		conditions = append(conditions, "due_at < "+arg(q.DueBefore.UTC()))
+	}
+	if q.DueAfter != nil {
+		conditions = append(conditions, "due_at > "+arg(q.DueAfter.UTC()))
+	}
+	if q.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+arg(q.CreatedAfter.UTC()))
+	}
+	if q.ListID > 0 {
+		conditions = append(conditions, "list_id = "+arg(q.ListID))
+	}
+	if len(q.Tag) > 0 {
+		conditions = append(conditions, `EXISTS (
+		SELECT 1 FROM todos_tags JOIN tags ON tags.id = todos_tags.tag_id
+		WHERE todos_tags.todo_id = todos.id AND tags.name = `+arg(q.Tag)+`)`)
+	}
+
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if q.PreviousID > 0 {
+		// keyset pagination: continue after the previous todo's position in the sort order
+		conditions = append(conditions, fmt.Sprintf(
+			"(%[1]s, id) %[2]s (SELECT %[1]s, id FROM todos WHERE id = %[3]s AND %[4]s)",
+			sortExpr, comparison, arg(q.PreviousID), accessibleBy("$1", RoleViewer)))
+	}
+
+	var clause strings.Builder
+	for _, condition := range conditions {
+		clause.WriteString(" AND ")
+		clause.WriteString(condition)
+	}
+	fmt.Fprintf(&clause, "\n\tORDER BY %s %s, id %s\n\tLIMIT %s", sortExpr, direction, direction, arg(q.pageSize()))
+
+	return clause.String(), args, nil
+}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors
+var (
+	ErrorInvalidRecurrence = errors.New("Recurrence must be an RRULE with FREQ and optionally INTERVAL, COUNT, UNTIL or BYDAY")
+)
+
+// maxInterval is the largest INTERVAL allowed, which is far longer than anyone plans ahead
+const maxInterval = 1000
+
+// Recurrence is the subset of an RFC 5545 RRULE supported for repeating todos,
+// e.g. `FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH` or `FREQ=MONTHLY;COUNT=12`
+type Recurrence struct {
+	Freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval int
+	Count    int       // the number of occurrences remaining, including this one; 0 for unlimited
+	Until    time.Time // the last time an occurrence may be due; zero for unlimited
+	ByDay    []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// untilLayouts are the DATE and DATE-TIME forms accepted for UNTIL
+var untilLayouts = []string{"20060102T150405Z", "20060102T150405", "20060102"}
+
+// ParseRecurrence parses an RRULE value, with or without the `RRULE:` prefix
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	r := &Recurrence{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrorInvalidRecurrence
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = value
+			default:
+				return nil, ErrorInvalidRecurrence
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 || r.Interval > maxInterval {
+				return nil, ErrorInvalidRecurrence
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return nil, ErrorInvalidRecurrence
+			}
+		case "UNTIL":
+			for _, layout := range untilLayouts {
+				if r.Until, err = time.Parse(layout, value); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return nil, ErrorInvalidRecurrence
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, ErrorInvalidRecurrence
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		default:
+			return nil, ErrorInvalidRecurrence
+		}
+	}
+	if len(r.Freq) == 0 || (len(r.ByDay) > 0 && r.Freq != "WEEKLY") {
+		return nil, ErrorInvalidRecurrence
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, ErrorInvalidRecurrence // RFC 5545 forbids both
+	}
+	return r, nil
+}
+
+// String formats the recurrence as an RRULE value
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayouts[0]))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			for name, d := range weekdays {
+				if d == weekday {
+					days[i] = name
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next finds when the occurrence following one due at `from` is due, and the rule which applies to it.
+// It returns false when the recurrence has no further occurrences.
+func (r *Recurrence) Next(from time.Time) (time.Time, *Recurrence, bool) {
+	if r.Count == 1 {
+		return time.Time{}, nil, false
+	}
+
+	var next time.Time
+	switch r.Freq {
+	case "DAILY":
+		next = from.AddDate(0, 0, r.Interval)
+	case "WEEKLY":
+		next = r.nextWeekly(from)
+	case "MONTHLY":
+		next = addSkippingInvalidDates(from, 0, r.Interval)
+	case "YEARLY":
+		next = addSkippingInvalidDates(from, r.Interval, 0)
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, nil, false
+	}
+	following := *r
+	if following.Count > 0 {
+		following.Count--
+	}
+	return next, &following, true
+}
+
+// nextWeekly finds the next of the BYDAY weekdays, only counting every INTERVAL-th week (starting on Monday)
+func (r *Recurrence) nextWeekly(from time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return from.AddDate(0, 0, 7*r.Interval)
+	}
+	daysSinceMonday := func(weekday time.Weekday) int {
+		return (int(weekday) + 6) % 7
+	}
+	offset := daysSinceMonday(from.Weekday())
+
+	// the earliest of the days later in the same week, or otherwise in the next week which counts
+	later, first := 7, 7
+	for _, weekday := range r.ByDay {
+		day := daysSinceMonday(weekday)
+		if day > offset && day < later {
+			later = day
+		}
+		if day < first {
+			first = day
+		}
+	}
+	if later < 7 {
+		return from.AddDate(0, 0, later-offset)
+	}
+	return from.AddDate(0, 0, 7*r.Interval-offset+first)
+}
+
+// addSkippingInvalidDates adds whole years & months, skipping any which don't contain the original day
+// (e.g. the 31st, or the 29th of February) as RFC 5545 requires
+func addSkippingInvalidDates(from time.Time, years, months int) time.Time {
+	for i := 1; ; i++ {
+		next := from.AddDate(years*i, months*i, 0)
+		if next.Day() == from.Day() {
+			return next
+		}
+	}
+}
+
+// NormalizeRecurrence validates an RRULE, returning it in canonical form as a nullable string
+func NormalizeRecurrence(rule *string) (sql.NullString, error) {
+	if rule == nil || len(*rule) == 0 {
+		return sql.NullString{}, nil
+	}
+	r, err := ParseRecurrence(*rule)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return MakeNullString(r.String()), nil
+}
+
+// scheduleNextOccurrence creates the next occurrence of a recurring todo which has just been completed,
+// due one recurrence after its due date, or after its completion when it had none, returning it if there is one.
+// The new todo has the same title, note, parent, list, priority & tags as the completed one, and goes to the end of the user's ordering.
+func scheduleNextOccurrence(tx *sql.Tx, t *Todo, currentTime time.Time) (*Todo, error) {
+	if !t.Recurrence.Valid {
+		return nil, nil
+	}
+	rule, err := ParseRecurrence(t.Recurrence.String)
+	if err != nil {
+		return nil, err
+	}
+	from := currentTime
+	if t.DueAt.Valid {
+		from = t.DueAt.Time
+	}
+	dueAt, following, ok := rule.Next(from)
+	if !ok {
+		return nil, nil
+	}
+
+	position, err := lastPosition(tx, t.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+	INSERT INTO todos (title, note, user_id, due_at, recurrence, parent_id, priority, position, list_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at, modified_at, version;`
+	next := &Todo{Title: t.Title, Note: t.Note, UserID: t.UserID, DueAt: MakeNullTime(&dueAt),
+		Recurrence: MakeNullString(following.String()), ParentID: t.ParentID, Priority: t.Priority, Position: position, ListID: t.ListID}
+	err = tx.QueryRow(sqlStatement, t.Title, t.Note, t.UserID, dueAt, following.String(), t.ParentID,
+		t.Priority, position, t.ListID).Scan(&next.ID, &next.CreatedAt, &next.ModifiedAt, &next.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = recordChanges(tx, nil, next, t.UserID, EventCreated); err != nil {
+		return nil, err
+	}
+
+	sqlStatement = `
+	INSERT INTO todos_tags (tag_id, todo_id)
+	SELECT tag_id, $2 FROM todos_tags WHERE todo_id = $1;`
+	if _, err = tx.Exec(sqlStatement, t.ID, next.ID); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	t.Log(`Should parse the supported subset of RRULEs into a canonical form`)
+	tests := []struct {
+		rule     string
+		expected string
+		valid    bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", true},
+		{"RRULE:freq=weekly;interval=2;byday=MO,TH", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", true},
+		{"FREQ=MONTHLY;COUNT=12", "FREQ=MONTHLY;COUNT=12", true},
+		{"FREQ=YEARLY;UNTIL=20301231", "FREQ=YEARLY;UNTIL=20301231T000000Z", true},
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY", true},
+		{"", "", false},
+		{"INTERVAL=2", "", false},
+		{"FREQ=HOURLY", "", false},
+		{"FREQ=DAILY;INTERVAL=0", "", false},
+		{"FREQ=WEEKLY;INTERVAL=20000000;BYDAY=MO", "", false},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20301231", "", false},
+		{"FREQ=MONTHLY;BYDAY=MO", "", false},
+		{"FREQ=WEEKLY;BYDAY=XX", "", false},
+		{"FREQ=WEEKLY;BYSETPOS=1", "", false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRecurrence(test.rule)
+		if !test.valid {
+			if err != ErrorInvalidRecurrence {
+				t.Errorf("%s: expected an invalid recurrence error but received %v", test.rule, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.rule, err.Error())
+			continue
+		}
+		if r.String() != test.expected {
+			t.Errorf("%s: expected %s but received %s", test.rule, test.expected, r.String())
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	t.Log(`Should find the due date of the next occurrence`)
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+	monday := date(2019, time.March, 11)
+
+	tests := []struct {
+		rule      string
+		from      time.Time
+		expected  time.Time
+		following string
+		ok        bool
+	}{
+		{"FREQ=DAILY", monday, date(2019, time.March, 12), "FREQ=DAILY", true},
+		{"FREQ=DAILY;INTERVAL=3", monday, date(2019, time.March, 14), "FREQ=DAILY;INTERVAL=3", true},
+		{"FREQ=WEEKLY", monday, date(2019, time.March, 18), "FREQ=WEEKLY", true},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", monday, date(2019, time.March, 14), "FREQ=WEEKLY;BYDAY=MO,TH", true},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", date(2019, time.March, 14), date(2019, time.March, 18), "FREQ=WEEKLY;BYDAY=MO,TH", true},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", date(2019, time.March, 14), date(2019, time.March, 25), "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", true},
+		{"FREQ=WEEKLY;BYDAY=SU", monday, date(2019, time.March, 17), "FREQ=WEEKLY;BYDAY=SU", true},
+		{"FREQ=WEEKLY;INTERVAL=3;BYDAY=TH,MO", date(2019, time.March, 17), date(2019, time.April, 1), "FREQ=WEEKLY;INTERVAL=3;BYDAY=TH,MO", true},
+		{"FREQ=WEEKLY;INTERVAL=1000;BYDAY=MO", monday, monday.AddDate(0, 0, 7000), "FREQ=WEEKLY;INTERVAL=1000;BYDAY=MO", true},
+		{"FREQ=MONTHLY", date(2019, time.January, 31), date(2019, time.March, 31), "FREQ=MONTHLY", true},
+		{"FREQ=YEARLY", date(2020, time.February, 29), date(2024, time.February, 29), "FREQ=YEARLY", true},
+		{"FREQ=MONTHLY;COUNT=3", monday, date(2019, time.April, 11), "FREQ=MONTHLY;COUNT=2", true},
+		{"FREQ=MONTHLY;COUNT=1", monday, time.Time{}, "", false},
+		{"FREQ=DAILY;UNTIL=20190312T093000Z", monday, date(2019, time.March, 12), "FREQ=DAILY;UNTIL=20190312T093000Z", true},
+		{"FREQ=DAILY;UNTIL=20190312", monday, time.Time{}, "", false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRecurrence(test.rule)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.rule, err.Error())
+			continue
+		}
+		next, following, ok := r.Next(test.from)
+		if ok != test.ok {
+			t.Errorf("%s: expected next occurrence to be %t", test.rule, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !next.Equal(test.expected) {
+			t.Errorf("%s: expected %s but received %s", test.rule, test.expected, next)
+		}
+		if following.String() != test.following {
+			t.Errorf("%s: expected following rule %s but received %s", test.rule, test.following, following.String())
+		}
+	}
+}
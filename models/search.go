@@ -0,0 +1,85 @@
+package models
+
+import (
+	"errors"
+)
+
+// Errors
+var (
+	ErrorEmptySearch = errors.New("Search query must not be empty")
+)
+
+// SearchResult is a todo matching a full-text search, along with how well it matched
+type SearchResult struct {
+	Todo *Todo
+	Rank float32
+	// Highlights are HTML escaped snippets of the title & note with matching terms wrapped in <mark> tags
+	TitleHighlight string
+	NoteHighlight  string
+}
+
+// Serialize converts the search result to a simple string map for conversion to JSON
+func (r *SearchResult) Serialize() map[string]interface{} {
+	mappedResult := r.Todo.Serialize()
+	mappedResult["rank"] = r.Rank
+	highlights := map[string]interface{}{}
+	if r.Todo.Title.Valid {
+		highlights["title"] = r.TitleHighlight
+	}
+	if r.Todo.Note.Valid {
+		highlights["note"] = r.NoteHighlight
+	}
+	mappedResult["highlights"] = highlights
+	return mappedResult
+}
+
+// htmlEscaped is an sql expression escaping the HTML special characters in a text column, so that the highlights made
+// from it can only contain the <mark> tags added by ts_headline
+func htmlEscaped(column string) string {
+	escaped := "COALESCE(" + column + ", '')"
+	for _, r := range [][2]string{{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&quot;"}, {"''", "&#39;"}} {
+		escaped = "replace(" + escaped + ", '" + r[0] + "', '" + r[1] + "')"
+	}
+	return escaped
+}
+
+// SearchTodos finds the todos which a given user can see whose title or note match a full-text search query,
+// best matches first
+func (db *DB) SearchTodos(userID uint, search string, limit int) ([]*SearchResult, error) {
+	if len(search) == 0 {
+		return nil, ErrorEmptySearch
+	}
+	query := TodoQuery{Limit: limit}
+	sqlStatement := `
+	SELECT ` + todoColumns + `,
+	ts_rank(search_vector, query) AS rank,
+	ts_headline('english', ` + htmlEscaped("title") + `, query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=TRUE'),
+	ts_headline('english', ` + htmlEscaped("note") + `, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3')
+	FROM todos, websearch_to_tsquery('english', $2) query
+	WHERE ` + accessibleBy("$1", RoleViewer) + ` AND search_vector @@ query
+	ORDER BY rank DESC, id ASC
+	LIMIT $3;`
+	rows, err := db.Query(sqlStatement, userID, search, query.pageSize())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0)
+	todos := make([]*Todo, 0)
+	for rows.Next() {
+		r := new(SearchResult)
+		if r.Todo, err = scanTodo(rows, &r.Rank, &r.TitleHighlight, &r.NoteHighlight); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+		todos = append(todos, r.Todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = db.loadTags(todos); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestSerializeSearchResult(t *testing.T) {
+	t.Log(`Should serialize search results with their rank and highlights`)
+	mockNow := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	result := SearchResult{
+		Todo: &Todo{
+			ID:         1,
+			Title:      MakeNullString("buy milk"),
+			CreatedAt:  mockNow,
+			ModifiedAt: mockNow,
+		},
+		Rank:           0.5,
+		TitleHighlight: "buy <mark>milk</mark>",
+	}
+
+	data, err := json.Marshal(result.Serialize())
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"createdAt":"2009-11-10T23:00:00Z","highlights":{"title":"buy \u003cmark\u003emilk\u003c/mark\u003e"},"id":1,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","rank":0.5,"title":"buy milk"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s but received %s", expected, string(data))
+	}
+}
+
+func TestSearchTodos(t *testing.T) {
+	t.Log(`Should search the todos a user can see by title and note, escaping the highlights`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	timestmp := time.Now()
+	columns := append(todoTableRows, "rank", "title_highlight", "note_highlight")
+	rows := sqlmock.NewRows(columns).
+		AddRow(4, "buy milk", "semi skimmed", timestmp, timestmp, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0,
+			0.6, "buy <mark>milk</mark>", "semi skimmed")
+
+	mock.ExpectQuery(`SELECT (.+) ts_headline\('english', replace\(replace\(replace\(replace\(replace\(COALESCE\(title, ''\), `+
+		`'&', '&amp;'\), '<', '&lt;'\), '>', '&gt;'\), '"', '&quot;'\), '''', '&#39;'\), query, .+ `+
+		`FROM todos, websearch_to_tsquery\('english', \$2\) query `+
+		`WHERE \(todos.deleted_at IS NULL AND \(todos.user_id = \$1 OR EXISTS .+\)\)\) AND search_vector @@ query.+`).
+		WithArgs(userID, "milk", resultsPerPage).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
+
+	db := DB{DB: mockDB}
+	results, err := db.SearchTodos(userID, "milk", 0)
+	if err != nil {
+		t.Errorf("failed to search todos: %s", err.Error())
+	}
+	if len(results) != 1 || results[0].Todo.ID != 4 || results[0].TitleHighlight != "buy <mark>milk</mark>" {
+		t.Errorf("failed to read search results")
+	}
+
+	t.Log(`Should reject empty searches`)
+	if _, err := db.SearchTodos(userID, "", 0); err != ErrorEmptySearch {
+		t.Errorf("Expected empty search error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
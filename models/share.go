@@ -0,0 +1,174 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ShareRole is what a user who has been granted a share may do with a todo or list
+type ShareRole string
+
+// Share roles
+const (
+	RoleViewer ShareRole = "viewer" // may read the todos
+	RoleEditor ShareRole = "editor" // may also update the todos
+)
+
+// ShareResource is the kind of thing which can be shared, either SharedTodo or SharedList
+type ShareResource struct {
+	table  string
+	column string // the column of the shares table referencing the resource
+}
+
+// Shareable resources
+var (
+	SharedTodo = ShareResource{table: "todos", column: "todo_id"}
+	SharedList = ShareResource{table: "lists", column: "list_id"}
+)
+
+// String names the kind of resource, e.g. for error messages
+func (r ShareResource) String() string {
+	return r.table[:len(r.table)-1]
+}
+
+// Share grants another user access to one of the owner's todos, or to all the todos in one of their lists
+type Share struct {
+	ID        uint
+	OwnerID   uint
+	User      User // the user the todo or list is shared with
+	Role      ShareRole
+	CreatedAt time.Time
+}
+
+// Errors
+var (
+	ErrorInvalidRole   = errors.New("Role must be either viewer or editor")
+	ErrorShareWithSelf = errors.New("Todos and lists can't be shared with their owner")
+)
+
+// ParseShareRole checks that a role is either viewer or editor
+func ParseShareRole(role string) (ShareRole, error) {
+	switch r := ShareRole(role); r {
+	case RoleViewer, RoleEditor:
+		return r, nil
+	}
+	return "", ErrorInvalidRole
+}
+
+// Serialize converts the share struct to a simple string map for conversion to JSON
+func (s *Share) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        s.ID,
+		"role":      s.Role,
+		"createdAt": s.CreatedAt,
+		"user":      s.User.Serialize(),
+	}
+}
+
+// accessibleBy is an sql condition on the todos table which holds when the todo isn't in the trash and the user
+// in the given argument owns it, or has been granted at least the given role on it or on its list
+func accessibleBy(userArg string, role ShareRole) string {
+	condition := fmt.Sprintf(`(todos.deleted_at IS NULL AND (todos.user_id = %[1]s OR EXISTS (
+		SELECT 1 FROM shares WHERE shares.user_id = %[1]s
+		AND (shares.todo_id = todos.id OR shares.list_id = todos.list_id)`, userArg)
+	if role == RoleEditor {
+		condition += ` AND shares.role = 'editor'`
+	}
+	return condition + `)))`
+}
+
+// GrantShare shares one of the owner's todos or lists with another user, replacing the role of any existing share
+func (db *DB) GrantShare(resource ShareResource, resourceID uint, s *Share) error {
+	if s.OwnerID == s.User.ID {
+		return ErrorShareWithSelf
+	}
+	sqlStatement := `
+	INSERT INTO shares (owner_id, user_id, ` + resource.column + `, role)
+	SELECT $2, $3, id, $4 FROM ` + resource.table + ` WHERE id = $1 AND user_id = $2
+	ON CONFLICT (user_id, ` + resource.column + `) DO UPDATE SET role = EXCLUDED.role
+	RETURNING id, created_at;`
+
+	err := db.QueryRow(sqlStatement, resourceID, s.OwnerID, s.User.ID, s.Role).Scan(&s.ID, &s.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrorRowsUnaffected
+	}
+	return err
+}
+
+// GetShares finds who one of the owner's todos or lists is shared with in an sql database
+func (db *DB) GetShares(resource ShareResource, resourceID, ownerID uint) ([]*Share, error) {
+	sqlStatement := `
+	SELECT shares.id, shares.owner_id, shares.role, shares.created_at,
+	users.id, users.first_name, users.last_name, users.email
+	FROM shares JOIN users ON users.id = shares.user_id
+	WHERE shares.` + resource.column + ` = $1 AND shares.owner_id = $2
+	ORDER BY shares.id;`
+	rows, err := db.Query(sqlStatement, resourceID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make([]*Share, 0)
+	for rows.Next() {
+		s := new(Share)
+		err = rows.Scan(&s.ID, &s.OwnerID, &s.Role, &s.CreatedAt,
+			&s.User.ID, &s.User.FirstName, &s.User.LastName, &s.User.Email)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// RevokeShare stops sharing one of the owner's todos or lists with a user
+func (db *DB) RevokeShare(resource ShareResource, resourceID, ownerID, userID uint) error {
+	sqlStatement := `
+	DELETE FROM shares
+	WHERE ` + resource.column + ` = $1 AND owner_id = $2 AND user_id = $3;`
+
+	res, err := db.Exec(sqlStatement, resourceID, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrorRowsUnaffected
+	}
+	return nil
+}
+
+// GetTodoAudience finds the users who can see a todo: its owner and anyone it, or its list, is shared with.
+// Todos in the trash are included, so that their deletion can be announced to everyone who saw them.
+func (db *DB) GetTodoAudience(todoID uint) ([]uint, error) {
+	sqlStatement := `
+	SELECT user_id FROM todos WHERE id = $1
+	UNION
+	SELECT shares.user_id FROM shares
+	JOIN todos ON shares.todo_id = todos.id OR shares.list_id = todos.list_id
+	WHERE todos.id = $1;`
+	rows, err := db.Query(sqlStatement, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := make([]uint, 0)
+	for rows.Next() {
+		var userID uint
+		if err = rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestParseShareRole(t *testing.T) {
+	t.Log(`should only accept viewer and editor roles`)
+	for _, role := range []string{"viewer", "editor"} {
+		if r, err := ParseShareRole(role); err != nil || string(r) != role {
+			t.Errorf("%s: expected a valid role but received %v, %v", role, r, err)
+		}
+	}
+	if _, err := ParseShareRole("owner"); err != ErrorInvalidRole {
+		t.Errorf("Expected an invalid role error but received %v", err)
+	}
+}
+
+func TestGrantShare(t *testing.T) {
+	t.Log(`should share a todo which belongs to the owner`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todoID, ownerID := uint(5), uint(1)
+	share := Share{OwnerID: ownerID, User: User{ID: 2}, Role: RoleEditor}
+	mock.ExpectQuery(`INSERT INTO shares \(owner_id, user_id, todo_id, role\) SELECT \$2, \$3, id, \$4 FROM todos .+ON CONFLICT \(user_id, todo_id\) DO UPDATE`).
+		WithArgs(todoID, ownerID, uint(2), RoleEditor).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, time.Now()))
+	mock.ExpectQuery(`INSERT INTO shares \(owner_id, user_id, list_id, role\) SELECT \$2, \$3, id, \$4 FROM lists .+`).
+		WithArgs(uint(9), ownerID, uint(2), RoleEditor).
+		WillReturnError(sql.ErrNoRows)
+
+	db := DB{DB: mockDB}
+	if err := db.GrantShare(SharedTodo, todoID, &share); err != nil {
+		t.Errorf("failed to share todo: %s", err.Error())
+	}
+	if share.ID != 3 {
+		t.Errorf("Expected share id 3 but received %d", share.ID)
+	}
+
+	t.Log(`should not share a list which belongs to someone else`)
+	if err := db.GrantShare(SharedList, 9, &share); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	t.Log(`should not share a todo with its owner`)
+	if err := db.GrantShare(SharedTodo, todoID, &Share{OwnerID: ownerID, User: User{ID: ownerID}}); err != ErrorShareWithSelf {
+		t.Errorf("Expected share with self error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetShares(t *testing.T) {
+	t.Log(`should list who a list is shared with`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	listID, ownerID := uint(4), uint(1)
+	mock.ExpectQuery(`SELECT (.+) FROM shares JOIN users ON users.id = shares.user_id WHERE shares.list_id = \$1 AND shares.owner_id = \$2`).
+		WithArgs(listID, ownerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "role", "created_at", "id", "first_name", "last_name", "email"}).
+			AddRow(1, ownerID, "viewer", time.Now(), 2, "Jane", nil, "jane@example.com"))
+
+	db := DB{DB: mockDB}
+	shares, err := db.GetShares(SharedList, listID, ownerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 || shares[0].Role != RoleViewer || shares[0].User.Email != "jane@example.com" {
+		t.Errorf("Expected a single viewer share but received %+v", shares)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevokeShare(t *testing.T) {
+	t.Log(`should revoke a share only once`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`DELETE FROM shares WHERE todo_id = \$1 AND owner_id = \$2 AND user_id = \$3`).
+		WithArgs(5, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM shares.+`).
+		WithArgs(5, 1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if err := db.RevokeShare(SharedTodo, 5, 1, 2); err != nil {
+		t.Errorf("failed to revoke share: %s", err.Error())
+	}
+	if err := db.RevokeShare(SharedTodo, 5, 1, 2); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateSharedTodo(t *testing.T) {
+	t.Log(`should only let editors update todos shared with them`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todo := Todo{ID: 5, UserID: 2, Title: MakeNullString("shared"), ModifiedAt: time.Now()}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$2 OR EXISTS \( `+
+		`SELECT 1 FROM shares WHERE shares.user_id = \$2 AND \(shares.todo_id = todos.id OR shares.list_id = todos.list_id\) `+
+		`AND shares.role = 'editor'\)\)\) FOR UPDATE`).
+		WithArgs(todo.ID, todo.UserID).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if _, err := db.UpdateTodo(todo); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTodoAudience(t *testing.T) {
+	t.Log(`should find the owner of a todo and everyone it is shared with`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectQuery(`SELECT user_id FROM todos WHERE id = \$1 UNION SELECT shares.user_id FROM shares ` +
+		`JOIN todos ON shares.todo_id = todos.id OR shares.list_id = todos.list_id WHERE todos.id = \$1`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1).AddRow(2))
+
+	db := DB{DB: mockDB}
+	userIDs, err := db.GetTodoAudience(5)
+	if err != nil {
+		t.Fatalf("failed to get audience: %s", err.Error())
+	}
+	if len(userIDs) != 2 || userIDs[0] != 1 || userIDs[1] != 2 {
+		t.Errorf("Expected users 1 and 2 but received %v", userIDs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
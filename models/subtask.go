@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// SubtaskPolicy decides what happens to the subtasks of a todo when it is deleted or completed
+type SubtaskPolicy string
+
+// Subtask policies
+const (
+	// SubtaskCascade deletes or completes all of a todo's descendants along with it
+	SubtaskCascade SubtaskPolicy = "cascade"
+	// SubtaskRestrict refuses to delete a todo with subtasks, or to complete one with outstanding subtasks
+	SubtaskRestrict SubtaskPolicy = "restrict"
+	// SubtaskDetach leaves subtasks untouched on completion, and moves them up to the deleted todo's parent on deletion
+	SubtaskDetach SubtaskPolicy = "detach"
+)
+
+// Errors
+var (
+	ErrorParentNotFound       = errors.New("Parent todo does not exist")
+	ErrorHasSubtasks          = errors.New("Todo has subtasks which must be deleted first")
+	ErrorHasOpenSubtasks      = errors.New("Todo has subtasks which must be completed first")
+	ErrorInvalidSubtaskPolicy = errors.New("Subtask policy must be one of cascade, restrict or detach")
+)
+
+// ParseSubtaskPolicy validates the name of a subtask policy
+func ParseSubtaskPolicy(policy string) (SubtaskPolicy, error) {
+	switch p := SubtaskPolicy(policy); p {
+	case SubtaskCascade, SubtaskRestrict, SubtaskDetach:
+		return p, nil
+	}
+	return "", ErrorInvalidSubtaskPolicy
+}
+
+// subtaskPolicy is the policy in force, cascading unless otherwise configured
+func (db *DB) subtaskPolicy() SubtaskPolicy {
+	if len(db.SubtaskPolicy) == 0 {
+		return SubtaskCascade
+	}
+	return db.SubtaskPolicy
+}
+
+// loadSubtasks fetches the direct children of a todo, each with counts of their own subtasks,
+// and sets the todo's progress from them
+func (db *DB) loadSubtasks(t *Todo) error {
+	sqlStatement := `
+	SELECT ` + todoColumns + `,
+	(SELECT COUNT(*) FROM todos AS subtasks WHERE subtasks.parent_id = todos.id AND subtasks.deleted_at IS NULL),
+	(SELECT COUNT(*) FROM todos AS subtasks WHERE subtasks.parent_id = todos.id AND subtasks.deleted_at IS NULL AND subtasks.is_done)
+	FROM todos WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL
+	ORDER BY id;`
+	rows, err := db.Query(sqlStatement, t.ID, t.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	t.Subtasks = make([]*Todo, 0)
+	for rows.Next() {
+		var total, done int
+		subtask, err := scanTodo(rows, &total, &done)
+		if err != nil {
+			return err
+		}
+		subtask.Progress = &Progress{Total: total, Done: done}
+		t.Subtasks = append(t.Subtasks, subtask)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	t.Progress = &Progress{Total: len(t.Subtasks)}
+	for _, subtask := range t.Subtasks {
+		if subtask.IsDone {
+			t.Progress.Done++
+		}
+	}
+	return nil
+}
+
+// beforeDeletingParent applies the subtask policy to the children of a todo about to be deleted
+func (db *DB) beforeDeletingParent(tx *sql.Tx, todoID, userID uint) error {
+	switch db.subtaskPolicy() {
+	case SubtaskRestrict:
+		sqlStatement := `
+		SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL);`
+		var hasSubtasks bool
+		if err := tx.QueryRow(sqlStatement, todoID, userID).Scan(&hasSubtasks); err != nil {
+			return err
+		}
+		if hasSubtasks {
+			return ErrorHasSubtasks
+		}
+	case SubtaskDetach:
+		sqlStatement := `
+		WITH detached AS (
+			UPDATE todos
+			SET parent_id = (SELECT parent_id FROM todos WHERE id = $1 AND user_id = $2)
+			WHERE parent_id = $1 AND user_id = $2
+			RETURNING id, parent_id
+		)
+		INSERT INTO todo_events (todo_id, user_id, action, changes)
+		SELECT id, $2, '` + EventUpdated + `', jsonb_build_object('parentId', jsonb_build_object('before', $1::INTEGER, 'after', parent_id))
+		FROM detached;`
+		if _, err := tx.Exec(sqlStatement, todoID, userID); err != nil {
+			return err
+		}
+	}
+	// with SubtaskCascade all descendants are deleted along with the todo
+	return nil
+}
+
+// completeSubtasks applies the subtask policy to the descendants of a todo which has just been completed by a user,
+// who may be an editor the todo is shared with rather than its owner
+func (db *DB) completeSubtasks(tx *sql.Tx, todoID, userID uint, currentTime time.Time) error {
+	switch db.subtaskPolicy() {
+	case SubtaskRestrict:
+		sqlStatement := `
+		SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = $1 AND deleted_at IS NULL AND NOT is_done);`
+		var hasOpenSubtasks bool
+		if err := tx.QueryRow(sqlStatement, todoID).Scan(&hasOpenSubtasks); err != nil {
+			return err
+		}
+		if hasOpenSubtasks {
+			return ErrorHasOpenSubtasks
+		}
+	case SubtaskCascade:
+		// only open subtasks are completed, so all of them change in the same way
+		changes, err := diffFields(
+			map[string]interface{}{"isDone": false, "completedAt": nil},
+			map[string]interface{}{"isDone": true, "completedAt": currentTime.UTC().Round(time.Microsecond)})
+		if err != nil {
+			return err
+		}
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		sqlStatement := `
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM todos WHERE parent_id = $1
+			UNION
+			SELECT todos.id FROM todos JOIN descendants ON todos.parent_id = descendants.id
+		), completed AS (
+			UPDATE todos
+			SET completed_at = $3, modified_at = $3, is_done = TRUE
+			WHERE id IN (SELECT id FROM descendants) AND deleted_at IS NULL AND NOT is_done
+			RETURNING id
+		)
+		INSERT INTO todo_events (todo_id, user_id, action, changes)
+		SELECT id, $2, '` + EventCompleted + `', $4 FROM completed;`
+		if _, err := tx.Exec(sqlStatement, todoID, userID, currentTime, changesJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
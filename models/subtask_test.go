@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestParseSubtaskPolicy(t *testing.T) {
+	t.Log(`Should only accept known subtask policies`)
+	for _, policy := range []string{"cascade", "restrict", "detach"} {
+		if p, err := ParseSubtaskPolicy(policy); err != nil || string(p) != policy {
+			t.Errorf("Expected %s to be a valid policy", policy)
+		}
+	}
+	if _, err := ParseSubtaskPolicy("orphan"); err != ErrorInvalidSubtaskPolicy {
+		t.Errorf("Expected invalid subtask policy error but received %v", err)
+	}
+}
+
+func TestSerializeSubtasks(t *testing.T) {
+	t.Log(`Should serialize a todo's parent, subtasks and progress`)
+	mockNow := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	todo := Todo{
+		ID:         2,
+		Title:      MakeNullString("parent"),
+		CreatedAt:  mockNow,
+		ModifiedAt: mockNow,
+		ParentID:   sql.NullInt64{Int64: 1, Valid: true},
+		Subtasks: []*Todo{
+			{ID: 3, Title: MakeNullString("child"), CreatedAt: mockNow, ModifiedAt: mockNow,
+				ParentID: sql.NullInt64{Int64: 2, Valid: true}},
+		},
+		Progress: &Progress{Total: 1, Done: 0},
+	}
+
+	data, err := json.Marshal(todo.Serialize())
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"createdAt":"2009-11-10T23:00:00Z","id":2,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","parentId":1,"progress":{"done":0,"total":1},"subtasks":[{"createdAt":"2009-11-10T23:00:00Z","id":3,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","parentId":2,"title":"child"}],"title":"parent"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s but received %s", expected, string(data))
+	}
+}
+
+func TestCreateSubtaskWithoutParent(t *testing.T) {
+	t.Log(`Should fail to create a subtask of a todo the user doesn't own`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	todo := Todo{
+		Title:    MakeNullString("subtask"),
+		UserID:   22,
+		ParentID: sql.NullInt64{Int64: 5, Valid: true},
+	}
+
+	mock.ExpectBegin()
+	expectEnsureInbox(mock, todo.UserID)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\), ''\) FROM todos`).
+		WithArgs(todo.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(""))
+	mock.ExpectQuery(`INSERT INTO todos .+ WHERE \$6::INTEGER IS NULL OR EXISTS .+`).
+		WithArgs(todo.Title, todo.Note, todo.UserID, todo.DueAt, todo.Recurrence, todo.ParentID, PriorityNone, "i", todo.ListID, false, todo.CompletedAt).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	if err := db.CreateTodo(&todo); err != ErrorParentNotFound {
+		t.Errorf("Expected parent not found error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteTodoSubtaskPolicies(t *testing.T) {
+	todoID, userID := uint(1), uint(2)
+
+	t.Log(`Should refuse to delete a todo with subtasks under the restrict policy`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE parent_id = \$1 AND user_id = \$2 AND deleted_at IS NULL\)`).
+		WithArgs(todoID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB, SubtaskPolicy: SubtaskRestrict}
+	if _, err := db.DeleteTodo(todoID, userID, 0); err != ErrorHasSubtasks {
+		t.Errorf("Expected has subtasks error but received %v", err)
+	}
+
+	t.Log(`Should move subtasks up to the grandparent under the detach policy`)
+	mock.ExpectBegin()
+	mock.ExpectExec(`WITH detached AS \( UPDATE todos SET parent_id = \(SELECT parent_id FROM todos WHERE id = \$1 AND user_id = \$2\) `+
+		`WHERE parent_id = \$1 AND user_id = \$2 RETURNING id, parent_id \) INSERT INTO todo_events .+ FROM detached`).
+		WithArgs(todoID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`WITH RECURSIVE descendants AS .+ UPDATE todos SET deleted_at = NOW\(\)`).
+		WithArgs(todoID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db.SubtaskPolicy = SubtaskDetach
+	if _, err := db.DeleteTodo(todoID, userID, 0); err != nil {
+		t.Errorf("Failed to delete todo: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCompleteTodoSubtaskPolicies(t *testing.T) {
+	todoID, userID := uint(1), uint(2)
+	currentTime := time.Now()
+
+	t.Log(`Should refuse to complete a todo with open subtasks under the restrict policy`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "parent", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos.+`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "parent", nil, currentTime, currentTime, nil, userID, currentTime, true, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventCompleted)
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE parent_id = \$1 AND deleted_at IS NULL AND NOT is_done\)`).
+		WithArgs(todoID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB, SubtaskPolicy: SubtaskRestrict}
+	if _, err := db.MarkTodoAsComplete(todoID, userID, currentTime); err != ErrorHasOpenSubtasks {
+		t.Errorf("Expected open subtasks error but received %v", err)
+	}
+
+	t.Log(`Should leave subtasks alone under the detach policy`)
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "parent", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos.+`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "parent", nil, currentTime, currentTime, nil, userID, currentTime, true, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventCompleted)
+	mock.ExpectCommit()
+
+	db.SubtaskPolicy = SubtaskDetach
+	if _, err := db.MarkTodoAsComplete(todoID, userID, currentTime); err != nil {
+		t.Errorf("Failed to complete todo: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,25 +1,223 @@
 package models
 
-// @TODO: implement tagging as a method to organise user todos
-
-//
-// import (
-// 	"time"
-// )
-//
-// // Tag defines the shape of a named tag items, which can have many chidren Todos
-// type Tag struct {
-// 	ID        string    `json: "id"`
-// 	Name      string    `json: "name"`
-// 	CreatedAt time.Time `json: "createdAt"`
-// 	Todos     []Todo.ID `json: "todos"`
-// }
-//
-// // TagStorer defines a data store agnostic interface for CRUD operations
-// type TagStorer interface {
-// 	GetAll() ([]Tag, error)
-// 	Get(id Tag.ID) (Tag, error)
-// 	Create(Tag) error
-// 	Update(Tag) error
-// 	Delete(id Tag.ID) error
-// }
+import (
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Tag defines the shape of a named tag, which a user can attach to many of their todos
+type Tag struct {
+	ID        uint
+	Name      string
+	UserID    uint
+	CreatedAt time.Time
+}
+
+// MaxTagNameLength is the most characters a tag's name may have, as the tags table stores it as VARCHAR(50)
+const MaxTagNameLength = 50
+
+// Errors
+var (
+	ErrorEmptyTag     = errors.New("Tag must have a non empty name")
+	ErrorDuplicateTag = errors.New("A tag with that name already exists")
+)
+
+// Serialize converts the tag struct to a simple string map for conversion to JSON
+func (t *Tag) Serialize() map[string]interface{} {
+	return map[string]interface{}{
+		"id":        t.ID,
+		"name":      t.Name,
+		"createdAt": t.CreatedAt,
+	}
+}
+
+// CreateTag inserts a single tag into an sql database
+func (db *DB) CreateTag(t *Tag) error {
+	if len(t.Name) == 0 {
+		return ErrorEmptyTag
+	}
+	sqlStatement := `
+	INSERT INTO tags (name, user_id)
+	VALUES ($1, $2)
+	RETURNING id, created_at;`
+
+	err := db.QueryRow(sqlStatement, t.Name, t.UserID).Scan(&t.ID, &t.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrorDuplicateTag
+	}
+	return err
+}
+
+// GetAllTags finds all the tags belonging to a given user in an sql database
+func (db *DB) GetAllTags(userID uint) ([]*Tag, error) {
+	sqlStatement := `
+	SELECT id, name, user_id, created_at FROM tags WHERE user_id = $1
+	ORDER BY name;`
+	rows, err := db.Query(sqlStatement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]*Tag, 0)
+	for rows.Next() {
+		t := new(Tag)
+		if err = rows.Scan(&t.ID, &t.Name, &t.UserID, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetTag finds a single tag from an sql database
+func (db *DB) GetTag(tagID, userID uint) (*Tag, error) {
+	sqlStatement := `
+	SELECT id, name, user_id, created_at FROM tags WHERE id = $1 AND user_id = $2`
+	t := new(Tag)
+	err := db.QueryRow(sqlStatement, tagID, userID).
+		Scan(&t.ID, &t.Name, &t.UserID, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// UpdateTag renames a single tag in an sql database
+func (db *DB) UpdateTag(t Tag) (*Tag, error) {
+	if len(t.Name) == 0 {
+		return nil, ErrorEmptyTag
+	}
+	sqlStatement := `
+	UPDATE tags
+	SET name = $3
+	WHERE id = $1 AND user_id = $2;`
+
+	res, err := db.Exec(sqlStatement, t.ID, t.UserID, t.Name)
+	if isUniqueViolation(err) {
+		return nil, ErrorDuplicateTag
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if count != 1 {
+		return nil, ErrorRowsUnaffected
+	}
+	return &t, nil
+}
+
+// DeleteTag removes a single tag, and with it all of its todo associations, from an sql database
+func (db *DB) DeleteTag(tagID, userID uint) (uint, error) {
+	sqlStatement := `
+	DELETE FROM tags
+	WHERE id = $1 AND user_id = $2;`
+	res, err := db.Exec(sqlStatement, tagID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count != 1 {
+		return 0, ErrorRowsUnaffected
+	}
+	return tagID, nil
+}
+
+// AddTagToTodo attaches a tag to a todo, provided both belong to the given user.
+// Attaching a tag which is already present is not an error.
+func (db *DB) AddTagToTodo(todoID, tagID, userID uint) error {
+	return addTagToTodo(db, todoID, tagID, userID)
+}
+
+// addTagToTodo attaches a tag to a todo, either directly or as part of a transaction, see AddTagToTodo
+func addTagToTodo(db execer, todoID, tagID, userID uint) error {
+	sqlStatement := `
+	INSERT INTO todos_tags (tag_id, todo_id)
+	SELECT tags.id, todos.id FROM tags, todos
+	WHERE tags.id = $1 AND tags.user_id = $3
+	AND todos.id = $2 AND todos.user_id = $3 AND todos.deleted_at IS NULL
+	ON CONFLICT (tag_id, todo_id) DO UPDATE SET tag_id = EXCLUDED.tag_id;`
+
+	res, err := db.Exec(sqlStatement, tagID, todoID, userID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrorRowsUnaffected
+	}
+	return nil
+}
+
+// RemoveTagFromTodo detaches a tag from a todo belonging to the given user
+func (db *DB) RemoveTagFromTodo(todoID, tagID, userID uint) error {
+	sqlStatement := `
+	DELETE FROM todos_tags
+	USING todos
+	WHERE todos_tags.todo_id = todos.id
+	AND todos_tags.tag_id = $1 AND todos_tags.todo_id = $2 AND todos.user_id = $3;`
+
+	res, err := db.Exec(sqlStatement, tagID, todoID, userID)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return ErrorRowsUnaffected
+	}
+	return nil
+}
+
+// loadTags fetches the tags for each of the given todos in a single query
+func (db *DB) loadTags(todos []*Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(todos))
+	byID := make(map[uint]*Todo, len(todos))
+	for i, t := range todos {
+		ids[i] = int64(t.ID)
+		byID[t.ID] = t
+	}
+
+	sqlStatement := `
+	SELECT todos_tags.todo_id, tags.id, tags.name, tags.user_id, tags.created_at
+	FROM tags JOIN todos_tags ON todos_tags.tag_id = tags.id
+	WHERE todos_tags.todo_id = ANY($1)
+	ORDER BY tags.name;`
+	rows, err := db.Query(sqlStatement, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID uint
+		tag := Tag{}
+		if err = rows.Scan(&todoID, &tag.ID, &tag.Name, &tag.UserID, &tag.CreatedAt); err != nil {
+			return err
+		}
+		if t, ok := byID[todoID]; ok {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"testing"
+	"time"
+)
+
+var tagTableRows = []string{"id", "name", "user_id", "created_at"}
+
+func TestSerializeTag(t *testing.T) {
+	t.Log(`should serialize tags correctly`)
+	mockNow := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	tag := Tag{ID: 3, Name: "work", UserID: 1, CreatedAt: mockNow}
+
+	data, err := json.Marshal(tag.Serialize())
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"createdAt":"2009-11-10T23:00:00Z","id":3,"name":"work"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s but received %s", expected, string(data))
+	}
+}
+
+func TestCreateTag(t *testing.T) {
+	t.Log(`should create a tag and read back its id`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	tag := Tag{Name: "work", UserID: 1}
+	mock.ExpectQuery(`INSERT INTO tags.+`).
+		WithArgs(tag.Name, tag.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(4, time.Now()))
+
+	db := DB{DB: mockDB}
+	if err := db.CreateTag(&tag); err != nil {
+		t.Errorf("failed to create tag: %s", err.Error())
+	}
+	if tag.ID != 4 {
+		t.Errorf("Expected tag id 4 but received %d", tag.ID)
+	}
+	if err := db.CreateTag(&Tag{UserID: 1}); err != ErrorEmptyTag {
+		t.Errorf("Expected empty tag error but received %v", err)
+	}
+
+	t.Log(`should refuse a tag with the same name as another of the user's tags`)
+	mock.ExpectQuery(`INSERT INTO tags.+`).
+		WithArgs("work", uint(1)).
+		WillReturnError(&pq.Error{Code: "23505"})
+	if err := db.CreateTag(&Tag{Name: "work", UserID: 1}); err != ErrorDuplicateTag {
+		t.Errorf("Expected duplicate tag error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetAllTags(t *testing.T) {
+	t.Log(`should get all of a user's tags`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	rows := sqlmock.NewRows(tagTableRows).
+		AddRow(1, "home", userID, time.Now()).
+		AddRow(2, "work", userID, time.Now())
+	mock.ExpectQuery(`SELECT (.+) FROM tags WHERE.+`).
+		WithArgs(userID).
+		WillReturnRows(rows)
+
+	db := DB{DB: mockDB}
+	tags, err := db.GetAllTags(userID)
+	if err != nil {
+		t.Errorf("failed to get tags: %s", err.Error())
+	}
+	if len(tags) != 2 {
+		t.Errorf("Expected 2 tags but received %d", len(tags))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTag(t *testing.T) {
+	t.Log(`should get a single tag`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	tagID, userID := uint(2), uint(1)
+	mock.ExpectQuery(`SELECT (.+) FROM tags WHERE.+`).
+		WithArgs(tagID, userID).
+		WillReturnRows(sqlmock.NewRows(tagTableRows).AddRow(tagID, "work", userID, time.Now()))
+
+	db := DB{DB: mockDB}
+	if _, err := db.GetTag(tagID, userID); err != nil {
+		t.Errorf("failed to get tag: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateTag(t *testing.T) {
+	t.Log(`should rename a single tag`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	tag := Tag{ID: 2, UserID: 1, Name: "renamed"}
+	mock.ExpectExec(`UPDATE tags.+`).
+		WithArgs(tag.ID, tag.UserID, tag.Name).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	db := DB{DB: mockDB}
+	if _, err := db.UpdateTag(tag); err != nil {
+		t.Errorf("failed to update tag: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	t.Log(`should delete a single tag`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`DELETE FROM tags.+`).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	db := DB{DB: mockDB}
+	if _, err := db.DeleteTag(2, 1); err != nil {
+		t.Errorf("failed to delete tag: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddTagToTodo(t *testing.T) {
+	t.Log(`should attach a tag to a todo`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	todoID, tagID, userID := uint(5), uint(2), uint(1)
+	mock.ExpectExec(`INSERT INTO todos_tags.+`).
+		WithArgs(tagID, todoID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO todos_tags.+`).
+		WithArgs(tagID, todoID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if err := db.AddTagToTodo(todoID, tagID, userID); err != nil {
+		t.Errorf("failed to attach tag: %s", err.Error())
+	}
+	t.Log(`should fail when the todo or tag belongs to someone else`)
+	if err := db.AddTagToTodo(todoID, tagID, userID); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRemoveTagFromTodo(t *testing.T) {
+	t.Log(`should detach a tag from a todo`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	todoID, tagID, userID := uint(5), uint(2), uint(1)
+	mock.ExpectExec(`DELETE FROM todos_tags.+`).
+		WithArgs(tagID, todoID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	db := DB{DB: mockDB}
+	if err := db.RemoveTagFromTodo(todoID, tagID, userID); err != nil {
+		t.Errorf("failed to detach tag: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
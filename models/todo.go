@@ -9,25 +9,48 @@ import (
 
 // Todo defines the shape of a single todo item
 type Todo struct {
-	ID          uint
-	Title       sql.NullString
-	Note        sql.NullString
-	CreatedAt   time.Time
-	ModifiedAt  time.Time
-	DueAt       pq.NullTime // Specific to postgres
-	UserID      uint
-	CompletedAt pq.NullTime // Specific to postgres
-	IsDone      bool
+	ID           uint
+	Title        sql.NullString
+	Note         sql.NullString
+	CreatedAt    time.Time
+	ModifiedAt   time.Time
+	DueAt        pq.NullTime // Specific to postgres
+	UserID       uint
+	CompletedAt  pq.NullTime // Specific to postgres
+	IsDone       bool
+	Recurrence   sql.NullString // an RRULE, see ParseRecurrence
+	ParentID     sql.NullInt64  // the todo this is a subtask of
+	Priority     Priority
+	Position     string // the todo's rank in the user's manual ordering, see RankBetween
+	ListID       sql.NullInt64
+	Version      int // incremented by every change to the todo, see ErrorVersionMismatch
+	CommentCount int
+	DeletedAt    pq.NullTime // when the todo was moved to the trash, only loaded for trashed todos
+	Tags         []Tag
+	Subtasks     []*Todo   // only loaded for single todos
+	Progress     *Progress // counts of subtasks, only loaded along with them
+	// NextOccurrence is the todo created by completing this recurring one, only set by the change which completed it
+	NextOccurrence *Todo
+}
+
+// Progress counts how many of a todo's direct subtasks are done
+type Progress struct {
+	Total int
+	Done  int
 }
 
 const (
 	resultsPerPage = 10 // the default page size for todos
+	// todoColumns lists the columns of the todos table, and the number of comments on each todo, in the order scanTodo reads them
+	todoColumns = `id, title, note, created_at, modified_at, due_at, user_id, completed_at, is_done, recurrence, parent_id, priority, position, list_id,
+	version, (SELECT COUNT(*) FROM comments WHERE comments.todo_id = todos.id) AS comment_count`
 )
 
 // Errors
 var (
-	ErrorEmptyTodo      = errors.New("Todo must have non empty title or note")
-	ErrorRowsUnaffected = errors.New("Rows were not changed successfully")
+	ErrorEmptyTodo       = errors.New("Todo must have non empty title or note")
+	ErrorRowsUnaffected  = errors.New("Rows were not changed successfully")
+	ErrorVersionMismatch = errors.New("Todo has been changed since it was fetched")
 )
 
 // Serialize converts the todo struct to a simple string map for conversion to JSON
@@ -51,139 +74,388 @@ func (t *Todo) Serialize() map[string]interface{} {
 	if t.CompletedAt.Valid {
 		mappedTodo["completedAt"] = t.CompletedAt.Time
 	}
+	if t.Recurrence.Valid {
+		mappedTodo["recurrence"] = t.Recurrence.String
+	}
+	if t.ParentID.Valid {
+		mappedTodo["parentId"] = t.ParentID.Int64
+	}
+	if t.Priority != PriorityNone {
+		mappedTodo["priority"] = t.Priority.String()
+	}
+	if len(t.Position) > 0 {
+		mappedTodo["position"] = t.Position
+	}
+	if t.ListID.Valid {
+		mappedTodo["listId"] = t.ListID.Int64
+	}
+	if t.Version > 0 {
+		mappedTodo["version"] = t.Version
+	}
+	if t.CommentCount > 0 {
+		mappedTodo["commentCount"] = t.CommentCount
+	}
+	if t.DeletedAt.Valid {
+		mappedTodo["deletedAt"] = t.DeletedAt.Time
+	}
+	if len(t.Tags) > 0 {
+		tags := make([]map[string]interface{}, len(t.Tags))
+		for i := range t.Tags {
+			tags[i] = t.Tags[i].Serialize()
+		}
+		mappedTodo["tags"] = tags
+	}
+	if t.Subtasks != nil {
+		subtasks := make([]map[string]interface{}, len(t.Subtasks))
+		for i, subtask := range t.Subtasks {
+			subtasks[i] = subtask.Serialize()
+		}
+		mappedTodo["subtasks"] = subtasks
+	}
+	if t.Progress != nil {
+		mappedTodo["progress"] = map[string]interface{}{
+			"total": t.Progress.Total,
+			"done":  t.Progress.Done,
+		}
+	}
 
 	return mappedTodo
 }
 
-// CreateTodo inserts a single todo into an sql database
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTodo reads a single todo selected using todoColumns, followed by any extra columns
+func scanTodo(row rowScanner, extra ...interface{}) (*Todo, error) {
+	t := new(Todo)
+	dest := append([]interface{}{&t.ID, &t.Title, &t.Note, &t.CreatedAt,
+		&t.ModifiedAt, &t.DueAt, &t.UserID, &t.CompletedAt, &t.IsDone, &t.Recurrence, &t.ParentID,
+		&t.Priority, &t.Position, &t.ListID, &t.Version, &t.CommentCount}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// queryTodos reads the todos selected by a query using todoColumns
+func (db *DB) queryTodos(sqlStatement string, args ...interface{}) ([]*Todo, error) {
+	rows, err := db.Query(sqlStatement, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTodos(rows)
+}
+
+// scanTodos reads and closes rows of todos selected using todoColumns
+func scanTodos(rows *sql.Rows) ([]*Todo, error) {
+	defer rows.Close()
+
+	todos := make([]*Todo, 0)
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// CreateTodo inserts a single todo, positioned after all the user's others, into an sql database and records its creation.
+// The todo is updated with the row as it was inserted, including its id and timestamps. Todos may be created already done,
+// e.g. when importing them, in which case they are completed now unless they have a CompletedAt.
+// A subtask's parent must belong to the same user. Todos without a list go into their parent's list,
+// or otherwise the user's inbox.
 func (db *DB) CreateTodo(t *Todo) error {
 	if len(t.Title.String) == 0 && len(t.Note.String) == 0 {
 		return ErrorEmptyTodo
 	}
-	sqlStatement := `
-	INSERT INTO todos (title, note, user_id)
-	VALUES ($1, $2, $3);`
-
-	res, err := db.Exec(sqlStatement, t.Title, t.Note, t.UserID)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	count, err := res.RowsAffected()
+	if err = createTodo(tx, t); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// createTodo inserts a todo as part of a transaction, see CreateTodo
+func createTodo(tx *sql.Tx, t *Todo) error {
+	if len(t.Title.String) == 0 && len(t.Note.String) == 0 {
+		return ErrorEmptyTodo
+	}
+	if t.ListID.Valid {
+		if err := ensureListOwner(tx, uint(t.ListID.Int64), t.UserID); err != nil {
+			return err
+		}
+	} else if err := ensureInbox(tx, t.UserID); err != nil {
+		return err
+	}
+	position, err := lastPosition(tx, t.UserID)
 	if err != nil {
 		return err
 	}
-	if count != 1 {
+	t.Position = position
+
+	sqlStatement := `
+	INSERT INTO todos (title, note, user_id, due_at, recurrence, parent_id, priority, position, list_id, is_done, completed_at)
+	SELECT $1::TEXT, $2::TEXT, $3::INTEGER, $4::TIMESTAMP, $5::TEXT, $6::INTEGER, $7::SMALLINT, $8::TEXT,
+	COALESCE($9::INTEGER, (SELECT list_id FROM todos WHERE id = $6),
+		(SELECT id FROM lists WHERE user_id = $3 AND is_inbox)),
+	$10::BOOLEAN, CASE WHEN $10 THEN COALESCE($11::TIMESTAMP, NOW()) END
+	WHERE $6::INTEGER IS NULL
+	OR EXISTS (SELECT 1 FROM todos WHERE id = $6 AND user_id = $3 AND deleted_at IS NULL)
+	RETURNING ` + todoColumns + `;`
+
+	created, err := scanTodo(tx.QueryRow(sqlStatement, t.Title, t.Note, t.UserID, t.DueAt, t.Recurrence, t.ParentID,
+		t.Priority, t.Position, t.ListID, t.IsDone, t.CompletedAt))
+	if err == sql.ErrNoRows && t.ParentID.Valid {
+		return ErrorParentNotFound
+	} else if err == sql.ErrNoRows {
 		return ErrorRowsUnaffected
+	} else if err != nil {
+		return err
 	}
+	*t = *created
 
-	return nil
+	return recordChanges(tx, nil, t, t.UserID, EventCreated)
 }
 
-// GetAllTodos finds all the todos for a given user and page in an sql database
-func (db *DB) GetAllTodos(userID, previousID uint) ([]*Todo, error) {
-	sqlStatement := `
-	SELECT * FROM todos WHERE user_id = $1 AND id > $3
-	LIMIT $2;`
-	rows, err := db.Query(sqlStatement, userID, resultsPerPage, previousID)
-
-	defer func() {
-		if err = rows.Close(); err != nil {
-			panic(err)
-		}
-	}()
-
-	todos := make([]*Todo, 0)
-	for rows.Next() {
-		t := new(Todo)
-		if err = rows.
-			Scan(&t.ID, &t.Title, &t.Note, &t.CreatedAt, &t.ModifiedAt, &t.DueAt, &t.UserID, &t.CompletedAt, &t.IsDone); err != nil {
+// GetAllTodos finds the page of todos matching a query which a given user owns or has been shared in an sql database
+func (db *DB) GetAllTodos(userID uint, query TodoQuery) ([]*Todo, error) {
+	clause, args, err := query.build([]interface{}{userID})
+	if err != nil {
+		return nil, err
+	}
+	if query.PreviousID > 0 {
+		// a page can't follow a todo which the user can't see
+		var exists bool
+		err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND `+accessibleBy("$2", RoleViewer)+`)`,
+			query.PreviousID, userID).Scan(&exists)
+		if err != nil {
 			return nil, err
 		}
-		todos = append(todos, t)
+		if !exists {
+			return nil, ErrorInvalidPrevious
+		}
 	}
-	if err = rows.Err(); err != nil {
+	sqlStatement := `
+	SELECT ` + todoColumns + ` FROM todos WHERE ` + accessibleBy("$1", RoleViewer) + clause + `;`
+	todos, err := db.queryTodos(sqlStatement, args...)
+	if err != nil {
 		return nil, err
 	}
 	if todos == nil {
 		return nil, errors.New("Empty DB")
 	}
+	if err = db.loadTags(todos); err != nil {
+		return nil, err
+	}
 	return todos, nil
 }
 
-// GetTodo finds a single todo from an sql database
+// GetTodo finds a single todo which the user owns or has been shared, along with its direct subtasks, from an sql database
 func (db *DB) GetTodo(todoID, userID uint) (*Todo, error) {
 	sqlStatement := `
-	SELECT * FROM todos WHERE id = $1 AND user_id = $2`
-	todo := new(Todo)
-	err := db.QueryRow(sqlStatement, todoID, userID).
-		Scan(&todo.ID, &todo.Title, &todo.Note, &todo.CreatedAt,
-			&todo.ModifiedAt, &todo.DueAt, &todo.UserID, &todo.CompletedAt, &todo.IsDone)
+	SELECT ` + todoColumns + ` FROM todos WHERE id = $1 AND ` + accessibleBy("$2", RoleViewer)
+	todo, err := scanTodo(db.QueryRow(sqlStatement, todoID, userID))
 	if err != nil {
 		return nil, err
 	}
+	if err = db.loadSubtasks(todo); err != nil {
+		return nil, err
+	}
+	if err = db.loadTags(append([]*Todo{todo}, todo.Subtasks...)); err != nil {
+		return nil, err
+	}
 	return todo, nil
 }
 
-// MarkTodoAsComplete changes the is_done field to true and adds a completed_at timestamp for a given todo in an sql database
-func (db *DB) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) error {
+// MarkTodoAsComplete changes the is_done field to true and adds a completed_at timestamp for a given todo in an sql database,
+// returning the completed todo. Completing a recurring todo which was not already done also creates its next occurrence,
+// and its subtasks are dealt with according to the subtask policy. The todo may belong to another user who has shared it
+// as an editor.
+func (db *DB) MarkTodoAsComplete(todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	todo, err := db.completeTodo(tx, todoID, userID, currentTime)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return todo, tx.Commit()
+}
+
+// completeTodo marks a todo as complete as part of a transaction, returning the completed todo, see MarkTodoAsComplete
+func (db *DB) completeTodo(tx *sql.Tx, todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	before, err := lockTodo(tx, todoID, userID, accessibleBy("$2", RoleEditor))
+	if err != nil {
+		return nil, err
+	}
+
 	sqlStatement := `
 	UPDATE todos
-	SET completed_at = $3, is_done = TRUE 
-	WHERE id = $1 AND user_id = $2;`
+	SET completed_at = $2, modified_at = $2, is_done = TRUE
+	WHERE id = $1
+	RETURNING ` + todoColumns + `;`
 
-	res, err := db.Exec(sqlStatement, todoID, userID, currentTime)
+	todo, err := scanTodo(tx.QueryRow(sqlStatement, todoID, currentTime))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err = recordChanges(tx, before, todo, userID, EventCompleted); err != nil {
+		return nil, err
 	}
 
-	count, err := res.RowsAffected()
+	if !before.IsDone {
+		if err = db.completeSubtasks(tx, todoID, userID, currentTime); err != nil {
+			return nil, err
+		}
+		if todo.NextOccurrence, err = scheduleNextOccurrence(tx, todo, currentTime); err != nil {
+			return nil, err
+		}
+	}
+	return todo, nil
+}
+
+// MarkTodoAsIncomplete reopens a completed todo, changing the is_done field to false and clearing its completed_at timestamp in an sql database.
+// The todo may belong to another user who has shared it as an editor.
+func (db *DB) MarkTodoAsIncomplete(todoID, userID uint, currentTime time.Time) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	if count != 1 {
-		return ErrorRowsUnaffected
+	if _, err = reopenTodo(tx, todoID, userID, currentTime); err != nil {
+		tx.Rollback()
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-// UpdateTodo changes the title and note of a single todo in an sql database
-func (db *DB) UpdateTodo(t Todo) (*Todo, error) {
+// reopenTodo reopens a todo as part of a transaction, returning the reopened todo, see MarkTodoAsIncomplete
+func reopenTodo(tx *sql.Tx, todoID, userID uint, currentTime time.Time) (*Todo, error) {
+	before, err := lockTodo(tx, todoID, userID, accessibleBy("$2", RoleEditor))
+	if err != nil {
+		return nil, err
+	}
+
 	sqlStatement := `
 	UPDATE todos
-	SET title = $3, note = $4, modified_at = $5
-	WHERE id = $1 AND user_id = $2;`
+	SET completed_at = NULL, modified_at = $2, is_done = FALSE
+	WHERE id = $1
+	RETURNING ` + todoColumns + `;`
 
-	res, err := db.Exec(sqlStatement, t.ID, t.UserID, t.Title, t.Note, t.ModifiedAt)
+	todo, err := scanTodo(tx.QueryRow(sqlStatement, todoID, currentTime))
 	if err != nil {
 		return nil, err
 	}
+	if err = recordChanges(tx, before, todo, userID, EventReopened); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
 
-	count, err := res.RowsAffected()
+// UpdateTodo changes the title, note, due date, recurrence and priority of a single todo in an sql database,
+// returning the todo as it is after the update. A null DueAt or Recurrence clears any existing value.
+// A non-zero Version must match the todo's current version. The todo may belong to another user who has shared it
+// as an editor, and the changes are recorded against the user making them.
+func (db *DB) UpdateTodo(t Todo) (*Todo, error) {
+	tx, err := db.Begin()
 	if err != nil {
 		return nil, err
 	}
-	if count != 1 {
-		return nil, ErrorRowsUnaffected
+
+	before, err := lockTodo(tx, t.ID, t.UserID, accessibleBy("$2", RoleEditor))
+	if err == nil && t.Version != 0 && t.Version != before.Version {
+		err = ErrorVersionMismatch
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
-	return &t, nil
-}
 
-// DeleteTodo removes a single todo from an sql database
-func (db *DB) DeleteTodo(todoID, userID uint) (uint, error) {
 	sqlStatement := `
-	DELETE FROM todos
-	WHERE id = $1 AND user_id = $2;`
-	res, err := db.Exec(sqlStatement, todoID, userID)
+	UPDATE todos
+	SET title = $2, note = $3, modified_at = $4, due_at = $5, recurrence = $6, priority = $7
+	WHERE id = $1
+	RETURNING ` + todoColumns + `;`
+
+	after, err := scanTodo(tx.QueryRow(sqlStatement, t.ID, t.Title, t.Note, t.ModifiedAt, t.DueAt, t.Recurrence, t.Priority))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = recordChanges(tx, before, after, t.UserID, EventUpdated); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// DeleteTodo moves a single todo to the trash in an sql database, dealing with its subtasks according to the subtask policy.
+// With the cascade policy its descendants are trashed along with it, and are restored along with it by RestoreTodo.
+// The deletion is recorded in the history of each trashed todo. A non-zero version must match the todo's current version.
+func (db *DB) DeleteTodo(todoID, userID uint, version int) (uint, error) {
+	tx, err := db.Begin()
 	if err != nil {
 		return 0, err
 	}
+	if err = db.deleteTodo(tx, todoID, userID, version); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return todoID, tx.Commit()
+}
+
+// deleteTodo moves a todo to the trash as part of a transaction, see DeleteTodo
+func (db *DB) deleteTodo(tx *sql.Tx, todoID, userID uint, version int) error {
+	if version != 0 {
+		todo, err := lockTodo(tx, todoID, userID, ownedBy)
+		if err != nil {
+			return err
+		}
+		if todo.Version != version {
+			return ErrorVersionMismatch
+		}
+	}
+	if err := db.beforeDeletingParent(tx, todoID, userID); err != nil {
+		return err
+	}
+
+	sqlStatement := `
+	WITH RECURSIVE descendants AS (
+		SELECT id FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		UNION
+		SELECT todos.id FROM todos JOIN descendants ON todos.parent_id = descendants.id
+		WHERE todos.deleted_at IS NULL
+	), trashed AS (
+		UPDATE todos
+		SET deleted_at = NOW()
+		WHERE id IN (SELECT id FROM descendants)
+		RETURNING id
+	)
+	INSERT INTO todo_events (todo_id, user_id, action)
+	SELECT id, $2, '` + EventDeleted + `' FROM trashed;`
+	res, err := tx.Exec(sqlStatement, todoID, userID)
+	if err != nil {
+		return err
+	}
 
 	count, err := res.RowsAffected()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if count != 1 {
-		return 0, ErrorRowsUnaffected
+	if count == 0 {
+		return ErrorRowsUnaffected
 	}
-	return todoID, nil
+	return nil
 }
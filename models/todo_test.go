@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -18,7 +19,9 @@ type TodoTest struct {
 
 var todoTableRows = []string{"id", "title", "note",
 	"created_at", "modified_at", "due_at",
-	"user_id", "completed_at", "is_done"}
+	"user_id", "completed_at", "is_done", "recurrence", "parent_id", "priority", "position", "list_id", "version", "comment_count"}
+
+var todoTagRows = []string{"todo_id", "id", "name", "user_id", "created_at"}
 
 func TestSerialize(t *testing.T) {
 	t.Log(`Should serialize todos correctly`)
@@ -35,7 +38,7 @@ func TestSerialize(t *testing.T) {
 		IsDone:      false,
 	}
 
-	todoTests := make([]TodoTest, 4)
+	todoTests := make([]TodoTest, 5)
 
 	todoTests[0].Todo = todo
 	todoTests[0].Expected = `{"createdAt":"2009-11-10T23:00:00Z","id":1,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","note":"example note","title":"example title"}`
@@ -57,6 +60,11 @@ func TestSerialize(t *testing.T) {
 	todoTests[3].Expected = `{"createdAt":"2009-11-10T23:00:00Z","id":1,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","note":"example note"}`
 	todo.Title.Valid = true
 
+	todo.Tags = []Tag{{ID: 3, Name: "work", UserID: 22, CreatedAt: mockNow}}
+	todoTests[4].Todo = todo
+	todoTests[4].Expected = `{"createdAt":"2009-11-10T23:00:00Z","id":1,"isDone":false,"modifiedAt":"2009-11-10T23:00:00Z","note":"example note","tags":[{"createdAt":"2009-11-10T23:00:00Z","id":3,"name":"work"}],"title":"example title"}`
+	todo.Tags = nil
+
 	for _, test := range todoTests {
 		serialTodo := test.Todo.Serialize()
 
@@ -81,7 +89,7 @@ func TestCreateTodoEmpty(t *testing.T) {
 	t.Log(`Should fail to create an empty todo`)
 
 	var mockDB *sql.DB
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
 	emptyTodo := Todo{
 		Title: MakeNullString(""),
@@ -109,11 +117,20 @@ func TestCreateTodo(t *testing.T) {
 		UserID: 22,
 	}
 
-	mock.ExpectExec(`INSERT INTO todos`).
-		WithArgs(todo.Title, todo.Note, todo.UserID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	db := DB{mockDB}
+	mock.ExpectBegin()
+	expectEnsureInbox(mock, todo.UserID)
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\), ''\) FROM todos WHERE user_id = \$1`).
+		WithArgs(todo.UserID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("i"))
+	createdAt := time.Now()
+	mock.ExpectQuery(`INSERT INTO todos .+ RETURNING id, title, note, created_at, (.+)`).
+		WithArgs(todo.Title, todo.Note, todo.UserID, todo.DueAt, todo.Recurrence, todo.ParentID, PriorityNone, "r", todo.ListID, false, todo.CompletedAt).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(1, "asd", "example note", createdAt, createdAt, nil, todo.UserID, nil, false, nil, nil, 0, "r", 3, 1, 0))
+	expectTodoEvent(mock, 1, todo.UserID, EventCreated)
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
 
 	t.Log(`Should create a normal todo with no title`)
 	// mockNow := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
@@ -121,6 +138,12 @@ func TestCreateTodo(t *testing.T) {
 	if err := db.CreateTodo(&todo); err != nil {
 		t.Error(err)
 	}
+	if todo.ListID.Int64 != 3 {
+		t.Errorf("Expected the todo to be read back in the inbox but received %+v", todo.ListID)
+	}
+	if !todo.CreatedAt.Equal(createdAt) || todo.Version != 1 {
+		t.Errorf("Expected the inserted row to be read back but received %+v", todo)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -136,17 +159,20 @@ func TestGetAllTodosEmpty(t *testing.T) {
 	defer mockDB.Close()
 
 	userID := uint(1)
-	prevID := uint(0)
+	prevID := uint(3)
 
 	rows := sqlmock.NewRows(todoTableRows)
 
-	mock.ExpectQuery(`SELECT \* FROM todos WHERE.+`).
-		WithArgs(userID, resultsPerPage, prevID).
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND .+\)`).
+		WithArgs(prevID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE \(todos.deleted_at IS NULL AND \(todos.user_id = \$1 OR EXISTS .+\)\)\) AND \(id, id\) > .+ ORDER BY id ASC, id ASC.+`).
+		WithArgs(userID, prevID, resultsPerPage).
 		WillReturnRows(rows)
 
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
-	todos, err := db.GetAllTodos(userID, prevID)
+	todos, err := db.GetAllTodos(userID, TodoQuery{PreviousID: prevID})
 	if err != nil {
 		t.Errorf("failed to get todo list")
 		t.Fail()
@@ -171,7 +197,7 @@ func TestGetAllTodos(t *testing.T) {
 	defer mockDB.Close()
 
 	userID := uint(1)
-	prevID := uint(0)
+	prevID := uint(3)
 
 	timestmp := time.Now()
 
@@ -180,20 +206,29 @@ func TestGetAllTodos(t *testing.T) {
 	rows := sqlmock.NewRows(todoTableRows)
 	for i := 1; i < numberOfRows+1; i++ {
 		rows.
-			AddRow(i, "title 1", "hello", timestmp, timestmp, timestmp, userID, timestmp, false)
+			AddRow(i, "title 1", "hello", timestmp, timestmp, timestmp, userID, timestmp, false, nil, nil, 0, "i", nil, 1, 0)
 	}
 
-	mock.ExpectQuery(`SELECT \* FROM todos WHERE.+`).
-		WithArgs(userID, resultsPerPage, prevID).
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND .+\)`).
+		WithArgs(prevID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE \(todos.deleted_at IS NULL AND \(todos.user_id = \$1 OR EXISTS .+\)\)\) AND \(id, id\) > .+ ORDER BY id ASC, id ASC.+`).
+		WithArgs(userID, prevID, resultsPerPage).
 		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows).
+			AddRow(2, 7, "work", userID, timestmp))
 
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
-	todos, err := db.GetAllTodos(userID, prevID)
+	todos, err := db.GetAllTodos(userID, TodoQuery{PreviousID: prevID})
 	if err != nil {
 		t.Errorf("failed to get todo list")
 		t.Fail()
 	}
+	if len(todos[1].Tags) != 1 || todos[1].Tags[0].Name != "work" {
+		t.Errorf("failed to load the tags for each todo")
+	}
 	if len(todos) != numberOfRows {
 		t.Errorf("failed to get the correct number of todos")
 		t.Fail()
@@ -204,6 +239,63 @@ func TestGetAllTodos(t *testing.T) {
 	}
 }
 
+func TestGetAllTodosFilteredAndSorted(t *testing.T) {
+	t.Log(`Should filter, sort and paginate a list of todos`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	isDone := false
+	dueBefore := time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)
+	query := TodoQuery{
+		IsDone:     &isDone,
+		DueBefore:  &dueBefore,
+		Tag:        "work",
+		Sort:       "dueAt",
+		Descending: true,
+		PreviousID: 12,
+		Limit:      500,
+	}
+
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE id = \$1 AND \(todos.deleted_at IS NULL AND .+\)`).
+		WithArgs(query.PreviousID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE \(todos.deleted_at IS NULL AND \(todos.user_id = \$1 OR EXISTS .+\)\)\) AND is_done = \$2 AND due_at < \$3 `+
+		`AND EXISTS \(.+tags.name = \$4\) `+
+		`AND \(COALESCE\(due_at, '-infinity'\), id\) < \(SELECT COALESCE\(due_at, '-infinity'\), id FROM todos WHERE id = \$5 `+
+		`AND \(todos.deleted_at IS NULL AND \(todos.user_id = \$1 OR .+\)\)\)\)\s+`+
+		`ORDER BY COALESCE\(due_at, '-infinity'\) DESC, id DESC\s+LIMIT \$6`).
+		WithArgs(userID, isDone, dueBefore, "work", query.PreviousID, maxResultsPerPage).
+		WillReturnRows(sqlmock.NewRows(todoTableRows))
+
+	db := DB{DB: mockDB}
+
+	if _, err := db.GetAllTodos(userID, query); err != nil {
+		t.Errorf("failed to get todo list: %s", err.Error())
+	}
+
+	t.Log(`Should reject unknown sort fields`)
+	if _, err := db.GetAllTodos(userID, TodoQuery{Sort: "password"}); err != ErrorInvalidSort {
+		t.Errorf("Expected invalid sort error but received %v", err)
+	}
+
+	t.Log(`Should reject a previous todo which the user can't see`)
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM todos WHERE id = \$1 AND .+\)`).
+		WithArgs(uint(13), userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if _, err := db.GetAllTodos(userID, TodoQuery{PreviousID: 13}); err != ErrorInvalidPrevious {
+		t.Errorf("Expected invalid previous error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestGetTodo(t *testing.T) {
 	t.Log(`Should get a single todos`)
 	mockDB, mock, err := sqlmock.New()
@@ -219,21 +311,35 @@ func TestGetTodo(t *testing.T) {
 	timestmp := time.Now()
 
 	rows := sqlmock.NewRows(todoTableRows).
-		AddRow(1, "title 1", "hello", timestmp, timestmp, timestmp, userID, timestmp, false)
+		AddRow(1, "title 1", "hello", timestmp, timestmp, timestmp, userID, timestmp, false, nil, nil, 0, "i", nil, 1, 0)
 
-	mock.ExpectQuery(`SELECT \* FROM todos WHERE.+`).
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = .+`).
 		WithArgs(todoID, userID).
 		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE parent_id = \$1 AND user_id = \$2.+`).
+		WithArgs(todoID, userID).
+		WillReturnRows(sqlmock.NewRows(append(todoTableRows, "total", "done")).
+			AddRow(2, "subtask 1", nil, timestmp, timestmp, nil, userID, nil, false, nil, todoID, 0, "i", nil, 1, 0, 0, 0).
+			AddRow(3, "subtask 2", nil, timestmp, timestmp, nil, userID, timestmp, true, nil, todoID, 0, "i", nil, 1, 0, 2, 1))
+	mock.ExpectQuery(`SELECT (.+) FROM tags JOIN todos_tags.+`).
+		WillReturnRows(sqlmock.NewRows(todoTagRows))
 
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
 	todo, err := db.GetTodo(todoID, userID)
 
-	t.Log(todo.Serialize())
-
 	if err != nil {
 		t.Errorf("failed to get todo list")
-		t.Fail()
+		t.FailNow()
+	}
+
+	t.Log(todo.Serialize())
+
+	if len(todo.Subtasks) != 2 || todo.Progress.Total != 2 || todo.Progress.Done != 1 {
+		t.Errorf("failed to load subtasks and progress")
+	}
+	if todo.Subtasks[1].Progress.Total != 2 || todo.Subtasks[1].Progress.Done != 1 {
+		t.Errorf("failed to load the progress of subtasks")
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -255,15 +361,136 @@ func TestMarkTodoAsComplete(t *testing.T) {
 
 	currentTime := time.Now()
 
-	mock.ExpectExec(`UPDATE todos.+`).
-		WithArgs(todoID, userID, currentTime).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "title 1", "hello", currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos.+`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "title 1", "hello", currentTime, currentTime, nil, userID, currentTime, true, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventCompleted)
+	mock.ExpectExec(`WITH RECURSIVE descendants.+UPDATE todos.+INSERT INTO todo_events`).
+		WithArgs(todoID, userID, currentTime, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
+
+	if _, err := db.MarkTodoAsComplete(todoID, userID, currentTime); err != nil {
+		t.Errorf("Failed to mark todo as done: %s", err.Error())
+		t.Fail()
+	}
 
-	db := DB{mockDB}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
 
-	if err := db.MarkTodoAsComplete(todoID, userID, currentTime); err != nil {
+func TestMarkRecurringTodoAsComplete(t *testing.T) {
+	t.Log(`Should create the next occurrence when completing a recurring todo`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	todoID := uint(1)
+
+	currentTime := time.Now()
+	dueAt := time.Date(2019, time.March, 11, 9, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "weekly report", nil, currentTime, currentTime, dueAt, userID, nil, false, "FREQ=WEEKLY;COUNT=3", nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos.+`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "weekly report", nil, currentTime, currentTime, dueAt, userID, currentTime, true, "FREQ=WEEKLY;COUNT=3", nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventCompleted)
+	mock.ExpectExec(`WITH RECURSIVE descendants.+UPDATE todos.+`).
+		WithArgs(todoID, userID, currentTime, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(position\), ''\) FROM todos`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow("i"))
+	mock.ExpectQuery(`INSERT INTO todos \(title, note, user_id, due_at, recurrence, parent_id, priority, position, list_id\).+RETURNING id`).
+		WithArgs(MakeNullString("weekly report"), sql.NullString{}, userID, dueAt.AddDate(0, 0, 7), "FREQ=WEEKLY;COUNT=2", sql.NullInt64{},
+			PriorityNone, "r", sql.NullInt64{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "modified_at", "version"}).AddRow(2, currentTime, currentTime, 1))
+	expectTodoEvent(mock, 2, userID, EventCreated)
+	mock.ExpectExec(`INSERT INTO todos_tags.+`).
+		WithArgs(todoID, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
+
+	todo, err := db.MarkTodoAsComplete(todoID, userID, currentTime)
+	if err != nil {
 		t.Errorf("Failed to mark todo as done: %s", err.Error())
 		t.Fail()
+	} else if todo.NextOccurrence == nil || todo.NextOccurrence.ID != 2 {
+		t.Errorf("Expected the next occurrence to be returned but received %+v", todo.NextOccurrence)
+	}
+
+	t.Log(`Should not create another occurrence when the todo was already done`)
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "weekly report", nil, currentTime, currentTime, dueAt, userID, currentTime, true, "FREQ=WEEKLY;COUNT=3", nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos.+`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "weekly report", nil, currentTime, currentTime, dueAt, userID, currentTime, true, "FREQ=WEEKLY;COUNT=3", nil, 0, "i", nil, 1, 0))
+	mock.ExpectCommit()
+
+	if _, err := db.MarkTodoAsComplete(todoID, userID, currentTime); err != nil {
+		t.Errorf("Failed to mark todo as done: %s", err.Error())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMarkTodoAsIncomplete(t *testing.T) {
+	t.Log(`Should reopen a single completed todo`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Error(err)
+		t.Fail()
+	}
+	defer mockDB.Close()
+
+	userID := uint(1)
+	todoID := uint(1)
+
+	currentTime := time.Now()
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID,
+		todoID, "title 1", nil, currentTime, currentTime, nil, userID, currentTime, true, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos SET completed_at = NULL, modified_at = \$2, is_done = FALSE WHERE id = \$1 RETURNING`).
+		WithArgs(todoID, currentTime).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todoID, "title 1", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 1, 0))
+	expectTodoEvent(mock, todoID, userID, EventReopened)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM todos WHERE id = \$1 AND .+ FOR UPDATE`).
+		WithArgs(todoID, userID).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+
+	if err := db.MarkTodoAsIncomplete(todoID, userID, currentTime); err != nil {
+		t.Errorf("Failed to mark todo as not done: %s", err.Error())
+		t.Fail()
+	}
+	if err := db.MarkTodoAsIncomplete(todoID, userID, currentTime); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -286,13 +513,23 @@ func TestUpdateTodo(t *testing.T) {
 		UserID:     1,
 		ID:         1,
 		ModifiedAt: time.Now(),
+		DueAt:      pq.NullTime{Time: time.Now(), Valid: true},
+		Recurrence: MakeNullString("FREQ=DAILY"),
+		Priority:   PriorityHigh,
 	}
 
-	mock.ExpectExec(`UPDATE todos.+`).
-		WithArgs(todo.ID, todo.UserID, todo.Title, todo.Note, todo.ModifiedAt).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	db := DB{mockDB}
+	mock.ExpectBegin()
+	expectLockTodo(mock, todo.ID, todo.UserID,
+		todo.ID, "title", "note", todo.ModifiedAt, todo.ModifiedAt, nil, todo.UserID, nil, false, nil, nil, 0, "i", nil, 1, 0)
+	mock.ExpectQuery(`UPDATE todos SET title = \$2, .+ WHERE id = \$1 RETURNING`).
+		WithArgs(todo.ID, todo.Title, todo.Note, todo.ModifiedAt, todo.DueAt, todo.Recurrence, todo.Priority).
+		WillReturnRows(sqlmock.NewRows(todoTableRows).
+			AddRow(todo.ID, "modified title", "changed note", todo.ModifiedAt, todo.ModifiedAt, todo.DueAt.Time, todo.UserID,
+				nil, false, "FREQ=DAILY", nil, PriorityHigh, "i", nil, 1, 0))
+	expectTodoEvent(mock, todo.ID, todo.UserID, EventUpdated)
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
 	if _, err := db.UpdateTodo(todo); err != nil {
 		t.Errorf("Failed to mark todo as done: %s", err.Error())
 		t.Fail()
@@ -304,7 +541,7 @@ func TestUpdateTodo(t *testing.T) {
 }
 
 func TestDeleteTodo(t *testing.T) {
-	t.Log(`Should delete a single todo`)
+	t.Log(`Should move a single todo and its subtasks to the trash`)
 	mockDB, mock, err := sqlmock.New()
 	if err != nil {
 		t.Error(err)
@@ -314,12 +551,15 @@ func TestDeleteTodo(t *testing.T) {
 	todoID := uint(1)
 	userID := uint(1)
 
-	mock.ExpectExec(`DELETE FROM todos.+`).
+	mock.ExpectBegin()
+	mock.ExpectExec(`WITH RECURSIVE descendants AS \(.+\), trashed AS \( UPDATE todos SET deleted_at = NOW\(\) WHERE id IN \(SELECT id FROM descendants\) `+
+		`RETURNING id \) INSERT INTO todo_events \(todo_id, user_id, action\) SELECT id, \$2, 'deleted' FROM trashed`).
 		WithArgs(todoID, userID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
 
-	db := DB{mockDB}
-	if _, err := db.DeleteTodo(todoID, userID); err != nil {
+	db := DB{DB: mockDB}
+	if _, err := db.DeleteTodo(todoID, userID, 0); err != nil {
 		t.Errorf("Failed to delete todo: %s", err.Error())
 		t.Fail()
 	}
@@ -328,3 +568,36 @@ func TestDeleteTodo(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestTodoVersionMismatch(t *testing.T) {
+	t.Log(`Should refuse to change a todo which has been changed since the expected version`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	todoID, userID := uint(1), uint(2)
+	currentTime := time.Now()
+	row := []driver.Value{todoID, "title", nil, currentTime, currentTime, nil, userID, nil, false, nil, nil, 0, "i", nil, 3, 0}
+
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID, row...)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	expectLockTodo(mock, todoID, userID, row...)
+	mock.ExpectRollback()
+
+	db := DB{DB: mockDB}
+	todo := Todo{ID: todoID, UserID: userID, Title: MakeNullString("new title"), Version: 2}
+	if _, err := db.UpdateTodo(todo); err != ErrorVersionMismatch {
+		t.Errorf("Expected version mismatch error but received %v", err)
+	}
+	if _, err := db.DeleteTodo(todoID, userID, 2); err != ErrorVersionMismatch {
+		t.Errorf("Expected version mismatch error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
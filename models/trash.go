@@ -0,0 +1,139 @@
+package models
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// GetTrash finds the todos a user has deleted which haven't been purged yet, most recently deleted first.
+// Subtasks trashed along with their parent are left out as they are restored with it.
+func (db *DB) GetTrash(userID uint) ([]*Todo, error) {
+	sqlStatement := `
+	SELECT ` + todoColumns + `, deleted_at
+	FROM todos
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM todos AS parents
+		WHERE parents.id = todos.parent_id AND parents.deleted_at = todos.deleted_at
+	)
+	ORDER BY deleted_at DESC, id;`
+	rows, err := db.Query(sqlStatement, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := make([]*Todo, 0)
+	for rows.Next() {
+		var deletedAt pq.NullTime
+		t, err := scanTodo(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		t.DeletedAt = deletedAt
+		todos = append(todos, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err = db.loadTags(todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// RestoreTodo takes one of the user's todos out of the trash, along with any subtasks trashed at the same time.
+// If its parent is still in the trash the todo is restored as a top level todo. The restoration is recorded in the history
+// of each restored todo.
+func (db *DB) RestoreTodo(todoID, userID uint) (uint, error) {
+	sqlStatement := `
+	WITH RECURSIVE restored AS (
+		SELECT id, deleted_at FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		UNION
+		SELECT todos.id, todos.deleted_at FROM todos JOIN restored ON todos.parent_id = restored.id
+		WHERE todos.deleted_at = restored.deleted_at
+	), untrashed AS (
+		UPDATE todos
+		SET deleted_at = NULL,
+		parent_id = CASE WHEN todos.id = $1 AND EXISTS (
+			SELECT 1 FROM todos AS parents WHERE parents.id = todos.parent_id AND parents.deleted_at IS NOT NULL
+		) THEN NULL ELSE todos.parent_id END
+		WHERE id IN (SELECT id FROM restored)
+		RETURNING id
+	)
+	INSERT INTO todo_events (todo_id, user_id, action)
+	SELECT id, $2, '` + EventRestored + `' FROM untrashed;`
+
+	res, err := db.Exec(sqlStatement, todoID, userID)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrorRowsUnaffected
+	}
+	return todoID, nil
+}
+
+// purge permanently deletes the trashed todos matching the roots condition, along with their descendants,
+// then deletes the contents of their attachments from the blob store
+func (db *DB) purge(roots string, args ...interface{}) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	var blobKeys []string
+	if db.Blobs != nil {
+		if blobKeys, err = attachmentKeys(tx, roots, args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	sqlStatement := `
+	DELETE FROM todos
+	WHERE ` + roots + `;`
+	res, err := tx.Exec(sqlStatement, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	if db.Blobs != nil {
+		db.deleteBlobs(blobKeys)
+	}
+	return count, nil
+}
+
+// PurgeTodo permanently deletes one of the user's trashed todos
+func (db *DB) PurgeTodo(todoID, userID uint) (uint, error) {
+	count, err := db.purge(`id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`, todoID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if count != 1 {
+		return 0, ErrorRowsUnaffected
+	}
+	return todoID, nil
+}
+
+// EmptyTrash permanently deletes all of the user's trashed todos, returning how many were deleted
+func (db *DB) EmptyTrash(userID uint) (int64, error) {
+	return db.purge(`user_id = $1 AND deleted_at IS NOT NULL`, userID)
+}
+
+// PurgeTrash permanently deletes every user's todos which have been in the trash for longer than the retention period,
+// returning how many were deleted
+func (db *DB) PurgeTrash(retention time.Duration) (int64, error) {
+	return db.purge(`deleted_at < NOW() - make_interval(secs => $1)`, retention.Seconds())
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"testing"
+	"time"
+)
+
+func TestGetTrash(t *testing.T) {
+	t.Log(`should list the user's trashed todos without the subtasks trashed along with them`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	deletedAt := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT (.+), deleted_at FROM todos WHERE user_id = \$1 AND deleted_at IS NOT NULL ` +
+		`AND NOT EXISTS \( SELECT 1 FROM todos AS parents WHERE parents.id = todos.parent_id AND parents.deleted_at = todos.deleted_at \) ` +
+		`ORDER BY deleted_at DESC, id`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(append(todoTableRows, "deleted_at")).
+			AddRow(4, "buy milk", nil, deletedAt, deletedAt, nil, 1, nil, false, nil, nil, 0, "i", nil, 1, 0, deletedAt))
+	mock.ExpectQuery(`SELECT todos_tags.todo_id, .+`).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_id", "id", "name", "user_id", "created_at"}))
+
+	db := DB{DB: mockDB}
+	todos, err := db.GetTrash(1)
+	if err != nil {
+		t.Fatalf("failed to get trash: %s", err.Error())
+	}
+	if len(todos) != 1 || todos[0].Serialize()["deletedAt"] != deletedAt {
+		t.Errorf("Expected one todo with its deletion time but received %+v", todos)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRestoreTodo(t *testing.T) {
+	t.Log(`should restore a trashed todo along with the subtasks trashed at the same time`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectExec(`WITH RECURSIVE restored AS \( SELECT id, deleted_at FROM todos WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NOT NULL `+
+		`UNION .+ WHERE todos.deleted_at = restored.deleted_at \), untrashed AS \( UPDATE todos SET deleted_at = NULL, parent_id = CASE .+ END `+
+		`WHERE id IN \(SELECT id FROM restored\) RETURNING id \) INSERT INTO todo_events \(todo_id, user_id, action\) SELECT id, \$2, 'restored'`).
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`WITH RECURSIVE restored AS .+`).
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := DB{DB: mockDB}
+	if _, err := db.RestoreTodo(4, 1); err != nil {
+		t.Errorf("failed to restore todo: %s", err.Error())
+	}
+	if _, err := db.RestoreTodo(5, 1); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPurgeTodo(t *testing.T) {
+	t.Log(`should permanently delete a trashed todo and then the blobs of its attachments and those of its subtasks`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`WITH RECURSIVE descendants AS \( SELECT id FROM todos WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NOT NULL .+\) `+
+		`SELECT storage_key FROM attachments WHERE todo_id IN \(SELECT id FROM descendants\)`).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("todos/1/abc").AddRow("todos/2/def"))
+	mock.ExpectExec(`DELETE FROM todos WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NOT NULL`).
+		WithArgs(1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`WITH RECURSIVE descendants AS .+`).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key"}))
+	mock.ExpectExec(`DELETE FROM todos .+`).
+		WithArgs(3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	blobs := mockBlobs{"todos/1/abc": nil, "todos/2/def": nil, "todos/3/ghi": nil}
+	db := DB{DB: mockDB, Blobs: blobs}
+	if _, err := db.PurgeTodo(1, 1); err != nil {
+		t.Errorf("failed to purge todo: %s", err.Error())
+	}
+	if _, ok := blobs["todos/3/ghi"]; len(blobs) != 1 || !ok {
+		t.Errorf("Expected only the blobs of the purged todos to be removed but received %v", blobs)
+	}
+	if _, err := db.PurgeTodo(3, 1); err != ErrorRowsUnaffected {
+		t.Errorf("Expected rows unaffected error but received %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+// secondsArg matches a number of seconds given as a float
+type secondsArg float64
+
+func (s secondsArg) Match(v driver.Value) bool {
+	seconds, ok := v.(float64)
+	return ok && seconds == float64(s)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	t.Log(`should purge every user's todos trashed for longer than the retention period`)
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM todos WHERE deleted_at < NOW\(\) - make_interval\(secs => \$1\)`).
+		WithArgs(secondsArg(3600)).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+	mock.ExpectCommit()
+
+	db := DB{DB: mockDB}
+	count, err := db.PurgeTrash(time.Hour)
+	if err != nil {
+		t.Errorf("failed to purge trash: %s", err.Error())
+	}
+	if count != 7 {
+		t.Errorf("Expected 7 todos to be purged but received %d", count)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -39,15 +39,28 @@ func (db *DB) GetUser(email string) (*User, error) {
 	return u, nil
 }
 
-// CreateUser inserts a single new user into an sql database
+// CreateUser inserts a single new user into an sql database along with their inbox list, so that a user never exists
+// without one
 func (db *DB) CreateUser(u *User) (*User, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
 	sqlStatement := `
 	INSERT INTO users (email, first_name, last_name, password_hash)
 	VALUES ($1, $2, $3, $4)
 	RETURNING id;`
 
-	err := db.QueryRow(sqlStatement, u.Email, u.FirstName, u.LastName, u.Password).Scan(&u.ID)
+	err = tx.QueryRow(sqlStatement, u.Email, u.FirstName, u.LastName, u.Password).Scan(&u.ID)
+	if err == nil {
+		err = ensureInbox(tx, u.ID)
+	}
 	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 	return u, nil
@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"strings"
@@ -71,7 +72,7 @@ func TestGetUser(t *testing.T) {
 		WithArgs(userEmail).
 		WillReturnRows(rows)
 
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
 	user, err := db.GetUser(userEmail)
 
@@ -88,7 +89,7 @@ func TestGetUser(t *testing.T) {
 }
 
 func TestCreateUser(t *testing.T) {
-	t.Log(`should create a new application user`)
+	t.Log(`should create a new application user along with their inbox`)
 
 	mockDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -104,11 +105,14 @@ func TestCreateUser(t *testing.T) {
 		Password:  "hashed_password",
 	}
 
+	mock.ExpectBegin()
 	mock.ExpectQuery(`INSERT INTO users.+`).
 		WithArgs(user.Email, user.FirstName.String, user.LastName.String, user.Password).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectEnsureInbox(mock, 1)
+	mock.ExpectCommit()
 
-	db := DB{mockDB}
+	db := DB{DB: mockDB}
 
 	registeredUser, err := db.CreateUser(&user)
 
@@ -119,6 +123,18 @@ func TestCreateUser(t *testing.T) {
 
 	t.Log(registeredUser.Serialize())
 
+	t.Log(`should not create the user when their inbox can't be created`)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO users.+`).
+		WithArgs(user.Email, user.FirstName.String, user.LastName.String, user.Password).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	expectEnsureInbox(mock, 2).WillReturnError(errors.New("connection refused"))
+	mock.ExpectRollback()
+
+	if _, err := db.CreateUser(&user); err == nil {
+		t.Errorf("Expected an error creating the inbox")
+	}
+
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"github.com/lib/pq"
+	"time"
 )
 
 // MakeNullString is a convenience function for creating nullable strings
@@ -11,3 +13,21 @@ func MakeNullString(s string) sql.NullString {
 		Valid:  true,
 	}
 }
+
+// MakeNullTime is a convenience function for creating nullable timestamps, where nil is treated as null.
+// Times are normalised to UTC as the todos table stores timestamps without a time zone.
+func MakeNullTime(t *time.Time) pq.NullTime {
+	if t == nil {
+		return pq.NullTime{}
+	}
+	return pq.NullTime{
+		Time:  t.UTC(),
+		Valid: true,
+	}
+}
+
+// isUniqueViolation reports whether an error is postgres refusing a row which would break a unique constraint
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
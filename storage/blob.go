@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// BlobStore keeps the contents of uploaded files, addressed by a slash separated key
+type BlobStore interface {
+	// Put stores size bytes read from content under the key, replacing anything already there
+	Put(key string, content io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under the key, which the caller must close
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under the key. Deleting a missing blob is not an error.
+	Delete(key string) error
+}
+
+// Errors
+var (
+	ErrorBlobNotFound = errors.New("Blob not found")
+	ErrorInvalidKey   = errors.New("Blob keys must be relative slash separated paths")
+)
+
+// validKey rejects keys which could escape the store, such as absolute paths or those containing `..`
+func validKey(key string) bool {
+	if len(key) == 0 || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if len(part) == 0 || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
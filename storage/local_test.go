@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	t.Log(`should reject keys which could escape the store`)
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"todos/1/abc", true},
+		{"file.txt", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"todos/../../etc/passwd", false},
+		{"todos//abc", false},
+		{"todos/./abc", false},
+		{`todos\abc`, false},
+	}
+	for _, test := range tests {
+		if validKey(test.key) != test.valid {
+			t.Errorf("Expected validKey(%q) to be %t", test.key, test.valid)
+		}
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	t.Log(`should put, get and delete blobs beneath the directory`)
+	dir, err := ioutil.TempDir("", "gotodos-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put("todos/1/abc", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("failed to put blob: %s", err.Error())
+	}
+
+	content, err := store.Get("todos/1/abc")
+	if err != nil {
+		t.Fatalf("failed to get blob: %s", err.Error())
+	}
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "hello" {
+		t.Errorf("Expected hello but received %s", data)
+	}
+
+	if err = store.Delete("todos/1/abc"); err != nil {
+		t.Errorf("failed to delete blob: %s", err.Error())
+	}
+	if _, err = store.Get("todos/1/abc"); err != ErrorBlobNotFound {
+		t.Errorf("Expected blob not found error but received %v", err)
+	}
+	if err = store.Delete("todos/1/abc"); err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed but received %v", err)
+	}
+	if err = store.Put("../abc", strings.NewReader("hello"), 5, "text/plain"); err != ErrorInvalidKey {
+		t.Errorf("Expected invalid key error but received %v", err)
+	}
+}
+
+func TestLocalStoreShortContent(t *testing.T) {
+	t.Log(`should not keep a blob which is shorter than its declared size`)
+	dir, err := ioutil.TempDir("", "gotodos-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &LocalStore{Dir: dir}
+	if err = store.Put("abc", strings.NewReader("hel"), 5, "text/plain"); err == nil {
+		t.Error("Expected an error for truncated content")
+	}
+	if _, err = store.Get("abc"); err != ErrorBlobNotFound {
+		t.Errorf("Expected blob not found error but received %v", err)
+	}
+}
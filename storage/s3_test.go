@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a stand-in for an S3 compatible service which keeps objects in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	t.Log(`should store objects in the bucket with signed requests`)
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := NewS3Store(server.URL+"/", "attachments", "eu-west-2", "AKID", "secret")
+	store.now = func() time.Time { return time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC) }
+
+	if err := store.Put("todos/1/abc", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("failed to put object: %s", err.Error())
+	}
+	if string(fake.objects["/attachments/todos/1/abc"]) != "hello" {
+		t.Errorf("Expected the object to be stored path style but received %v", fake.objects)
+	}
+
+	content, err := store.Get("todos/1/abc")
+	if err != nil {
+		t.Fatalf("failed to get object: %s", err.Error())
+	}
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "hello" {
+		t.Errorf("Expected hello but received %s", data)
+	}
+
+	if err = store.Delete("todos/1/abc"); err != nil {
+		t.Errorf("failed to delete object: %s", err.Error())
+	}
+	if _, err = store.Get("todos/1/abc"); err != ErrorBlobNotFound {
+		t.Errorf("Expected blob not found error but received %v", err)
+	}
+
+	signature := regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=AKID/20091110/eu-west-2/s3/aws4_request, ` +
+		`SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+	for _, auth := range fake.auth {
+		if !signature.MatchString(auth) {
+			t.Errorf("Unexpected Authorization header %s", auth)
+		}
+	}
+}
+
+func TestS3Signature(t *testing.T) {
+	t.Log(`should sign the same request identically and change the signature with the secret`)
+	store := NewS3Store("http://localhost:9000", "attachments", "us-east-1", "AKID", "secret")
+	at := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	sign := func(s *S3Store) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost:9000/attachments/todos/1/abc", nil)
+		s.sign(req, at)
+		if req.Header.Get("x-amz-date") != "20091110T230000Z" {
+			t.Errorf("Unexpected x-amz-date %s", req.Header.Get("x-amz-date"))
+		}
+		return req.Header.Get("Authorization")
+	}
+	first := sign(store)
+	if first != sign(store) {
+		t.Error("Expected signing to be deterministic")
+	}
+	other := *store
+	other.SecretKey = "other"
+	if first == sign(&other) {
+		t.Error("Expected the signature to depend on the secret key")
+	}
+}